@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+const (
+	defaultBarcodeResults = 20
+	maxBarcodeResults     = 50
+)
+
+// barcodeHandler looks up branded products by barcode, a page at a time. The page
+// number starts at 0, and every page comes from the provider that found the barcode.
+func barcodeHandler(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	code, ok := services.NormalizeBarcode(r.PathValue("code"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid request: %q is not an EAN-8, UPC-A, EAN-13 or GTIN-14 barcode", r.PathValue("code")), http.StatusBadRequest)
+		return
+	}
+
+	page, err := queryInt(r, "page", 0)
+	if err != nil || page < 0 {
+		http.Error(w, "Invalid request: page must be a number from 0", http.StatusBadRequest)
+		return
+	}
+	maxResults, err := queryInt(r, "max_results", defaultBarcodeResults)
+	if err != nil || maxResults < 1 {
+		http.Error(w, "Invalid request: max_results must be a positive number", http.StatusBadRequest)
+		return
+	}
+	maxResults = min(maxResults, maxBarcodeResults)
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	result, err := foodProvider.SearchFoodByBarcode(ctx, code, page, maxResults)
+	if err != nil {
+		log.Printf("❌ Barcode lookup for %s failed: %v", code, err)
+		writePipelineError(w, ctx, err, "Failed to look up barcode")
+		return
+	}
+	log.Printf("🏷️ Barcode %s page %d: %d products from %s", code, page, len(result.Foods), result.ProviderName)
+
+	// Only a barcode without any products is not found; a page past the end is empty
+	if result.Foods == nil {
+		result.Foods = []models.Food{}
+	}
+	response := models.BarcodeResponse{Success: result.Total() > 0, Data: result}
+	switch {
+	case !response.Success:
+		response.Message = fmt.Sprintf("No products found for barcode %s", code)
+	case len(result.Foods) == 0:
+		response.Message = fmt.Sprintf("Page %d is past the last page of products for barcode %s", page, code)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !response.Success {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// queryInt reads an integer query parameter, returning def when it is absent
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
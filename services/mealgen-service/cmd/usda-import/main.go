@@ -0,0 +1,95 @@
+// Command usda-import loads USDA FoodData Central exports into the local food store
+// the service searches when LOCAL_FOOD_DB is set.
+//
+//	go run ./cmd/usda-import -db foods.db FoodData_Central_sr_legacy_food_csv_2018-04.zip
+//
+// Each argument may be a directory or zip of the CSV export, or a JSON export (plain
+// or zipped). Foods already in the store are replaced, so an import can be re-run
+// with newer data.
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+func main() {
+	defaultDB := os.Getenv("LOCAL_FOOD_DB")
+	if defaultDB == "" {
+		defaultDB = "foods.db"
+	}
+	dbPath := flag.String("db", defaultDB, "local food store to import into")
+	types := flag.String("types", strings.Join(services.DefaultUSDADataTypes, ","), "comma-separated data types: foundation, sr_legacy, survey, branded")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] export...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	store, err := services.OpenLocalFoodStore(*dbPath)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	defer store.Close()
+
+	dataTypes := strings.Split(*types, ",")
+	var total services.USDAImportStats
+	for _, arg := range flag.Args() {
+		stats, err := importPath(ctx, store, arg, dataTypes)
+		total.Imported += stats.Imported
+		total.Skipped += stats.Skipped
+		if err != nil {
+			log.Fatalf("❌ Failed to import %s: %v", arg, err)
+		}
+		log.Printf("✅ %s: imported %d foods, skipped %d", arg, stats.Imported, stats.Skipped)
+	}
+
+	count, err := store.Count(ctx)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	log.Printf("✅ Imported %d foods (%d skipped); %s now holds %d foods", total.Imported, total.Skipped, *dbPath, count)
+}
+
+// importPath opens a directory, zip archive or single JSON file as a file system
+func importPath(ctx context.Context, store *services.LocalFoodStore, path string, dataTypes []string) (services.USDAImportStats, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return services.USDAImportStats{}, err
+	}
+
+	var fsys fs.FS
+	root := "."
+	switch {
+	case info.IsDir():
+		fsys = os.DirFS(path)
+	case strings.EqualFold(filepath.Ext(path), ".zip"):
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return services.USDAImportStats{}, err
+		}
+		defer archive.Close()
+		fsys = archive
+	default:
+		fsys = os.DirFS(filepath.Dir(path))
+		root = filepath.Base(path)
+	}
+	return services.ImportUSDA(ctx, store, fsys, root, dataTypes)
+}
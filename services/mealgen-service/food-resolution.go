@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+// recoverMissingFoods fills in foods the first lookups missed. Each missing name is
+// retried with simpler query variants; what is still missing is replaced by a food of
+// the same class suggested by the LLM, recorded as a swap so the meal reports it.
+func recoverMissingFoods(ctx context.Context, profile *services.ComplianceProfile, names map[string]bool, foodResults map[string]*models.Food, swaps map[string]complianceSwap, stats *foodFetchStats) {
+	// missing maps each name still without a food to the name the LLM asked for
+	missing := make(map[string]string)
+	for original := range names {
+		name := original
+		if swap, ok := swaps[original]; ok {
+			if swap.replacement == "" {
+				continue
+			}
+			name = swap.replacement
+		}
+		if foodResults[name] == nil {
+			missing[name] = original
+		}
+	}
+	if len(missing) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	for name, food := range resolveWithVariants(ctx, profile, mapKeys(missing)) {
+		log.Printf("🔎 Resolved %s by searching %q", name, food.Match.Variant)
+		foodResults[name] = food
+		delete(stats.unresolved, name)
+		delete(missing, name)
+	}
+	if len(missing) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	request := make([]services.MissingFood, 0, len(missing))
+	classes := make(map[string]string, len(missing))
+	for _, name := range mapKeys(missing) {
+		classes[name], _ = foodClasses.ClassifyName(name)
+		request = append(request, services.MissingFood{Name: name, Class: classes[name]})
+	}
+	replacements, err := geminiService.ReplaceMissingFoods(ctx, request, profile, mapKeys(missing))
+	if err != nil {
+		log.Printf("⚠️ No replacements for %d missing foods: %v", len(missing), err)
+		return
+	}
+
+	toFetch := make(map[string]bool, len(replacements))
+	for name, replacement := range replacements {
+		if reasons := profile.Violations(replacement); len(reasons) > 0 {
+			log.Printf("⚠️ Rejected replacement %s for %s: %v", replacement, name, reasons)
+			delete(replacements, name)
+			continue
+		}
+		toFetch[replacement] = true
+	}
+	fetched, fetchStats := batchFetchFoods(ctx, toFetch)
+	stats.cacheHits += fetchStats.cacheHits
+	stats.cacheMisses += fetchStats.cacheMisses
+	for name, food := range resolveWithVariants(ctx, profile, mapKeys(fetchStats.unresolved)) {
+		fetched[name] = food
+	}
+
+	for _, name := range mapKeys(replacements) {
+		replacement := replacements[name]
+		food := fetched[replacement]
+		if food == nil {
+			continue
+		}
+		if reasons := profile.FoodViolations(*food); len(reasons) > 0 {
+			log.Printf("⚠️ Rejected replacement %s for %s: %v", replacement, name, reasons)
+			continue
+		}
+		// Keep the meal's structure: a protein stays a protein
+		if class := classes[name]; class != "" && class != services.ClassMixed && foodClasses.Classify(*food).Class != class {
+			log.Printf("⚠️ Rejected replacement %s for %s: not a %s food", replacement, name, class)
+			continue
+		}
+
+		original := missing[name]
+		swap := swaps[original]
+		swap.replacement = replacement
+		swap.reasons = append(swap.reasons, fmt.Sprintf("no food data found for %q", name))
+		swaps[original] = swap
+		foodResults[replacement] = food
+		delete(stats.unresolved, name)
+		log.Printf("🔁 Replaced missing food %s with %s", name, replacement)
+	}
+}
+
+// resolveWithVariants retries names that found nothing with the simpler searches from
+// services.FoodQueryVariants. Candidates are still ranked against the original name, so
+// "(cooked)" keeps preferring cooked foods. Foods that break the profile are skipped.
+func resolveWithVariants(ctx context.Context, profile *services.ComplianceProfile, names []string) map[string]*models.Food {
+	results := make(map[string]*models.Food)
+	semaphore := make(chan struct{}, 10)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-semaphore }()
+
+			for _, variant := range services.FoodQueryVariants(name) {
+				searchResult, cached, err := foodCache.SearchFood(ctx, variant)
+				if err != nil || len(searchResult.Foods) == 0 {
+					continue
+				}
+				food := services.SelectBestFood(name, searchResult.Foods)
+				if len(profile.FoodViolations(*food)) > 0 {
+					continue
+				}
+				food.Match.Provider = searchResult.ProviderName
+				food.Match.Cached = cached
+				food.Match.Variant = variant
+
+				mutex.Lock()
+				results[name] = food
+				mutex.Unlock()
+				return
+			}
+		}(name)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// mapKeys returns a map's keys in sorted order
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
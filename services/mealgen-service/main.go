@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -19,15 +21,44 @@ import (
 var (
 	once          sync.Once
 	geminiService *services.GeminiService
-	foodService   *services.FoodService
+	foodProvider  *services.FoodProviderChain
+	foodCache     *services.FoodCache
+	planStore     services.PlanStore // nil when PLAN_STORE=none
+	healthRules   *services.HealthRuleSet
+	foodClasses   *services.FoodClassifier
+
+	// requestTimeout bounds the whole pipeline for a single request (REQUEST_TIMEOUT)
+	requestTimeout = defaultRequestTimeout
 )
 
+const defaultRequestTimeout = 2 * time.Minute
+
 func enableCORS(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 }
 
+// requestContext derives the working context for a request. It is cancelled when the
+// client disconnects or when the configured request deadline passes.
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), requestTimeout)
+}
+
+// writePipelineError reports a failed request, distinguishing client disconnects and
+// deadline expiry from provider failures
+func writePipelineError(w http.ResponseWriter, ctx context.Context, err error, message string) {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Printf("⏱️ Request deadline exceeded: %v", err)
+		http.Error(w, fmt.Sprintf("%s: request timed out after %s", message, requestTimeout), http.StatusGatewayTimeout)
+	case errors.Is(ctx.Err(), context.Canceled):
+		log.Printf("🔌 Client disconnected, abandoning request: %v", err)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
+
 func mealGenHandler(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 
@@ -43,16 +74,41 @@ func mealGenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := geminiService.GenerateMeals(reqBody)
+	targets := services.CompleteDailyTargets(&reqBody)
+	if len(targets.Computed) > 0 {
+		log.Printf("🧮 Computed daily targets %v: %.0f kcal", targets.Computed, targets.Calories)
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	if err := resolvePinnedFoods(ctx, reqBody.PinnedFoods, ""); err != nil {
+		writePinError(w, ctx, err)
+		return
+	}
+
+	response, err := geminiService.GenerateMeals(ctx, reqBody)
 	if err != nil {
-		log.Printf("Error calling Gemini API: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to generate response: %v", err), http.StatusInternalServerError)
+		log.Printf("Error calling LLM provider: %v", err)
+		writePipelineError(w, ctx, err, "Failed to generate response")
 		return
 	}
 
-	log.Printf("Gemini API response received successfully")
+	log.Printf("LLM response received successfully")
 
-	result := swapFoodItems(*response)
+	profile, health := planProfiles(reqBody)
+	result := swapFoodItems(ctx, *response, profile, health, reqBody.PinnedFoods)
+	if ctx.Err() != nil {
+		writePipelineError(w, ctx, ctx.Err(), "Failed to resolve foods")
+		return
+	}
+	result.Targets = &targets
+	result.Nutrition = services.AddNutritionTotals(result.Data, referenceIntakesFor(reqBody))
+	if reqBody.IncludeGroceryList {
+		groceryList := services.BuildGroceryList(result.Data)
+		result.GroceryList = &groceryList
+	}
+	savePlan(ctx, reqBody, &result)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
@@ -90,33 +146,199 @@ func mealRegenerationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := geminiService.RegenerateMeal(reqBody)
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	if err := resolvePinnedFoods(ctx, reqBody.PinnedFoods, reqBody.OriginalMeal.MealName); err != nil {
+		writePinError(w, ctx, err)
+		return
+	}
+
+	response, err := geminiService.RegenerateMeal(ctx, reqBody)
 	if err != nil {
-		log.Printf("Error calling Gemini API for regeneration: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to regenerate meal: %v", err), http.StatusInternalServerError)
+		log.Printf("Error calling LLM provider for regeneration: %v", err)
+		writePipelineError(w, ctx, err, "Failed to regenerate meal")
 		return
 	}
 
-	log.Printf("Gemini API regeneration response received successfully")
+	log.Printf("LLM regeneration response received successfully")
 
-	result := processRegenerationResponse(*response, reqBody)
+	result := processRegenerationResponse(ctx, *response, reqBody)
+	if ctx.Err() != nil {
+		writePipelineError(w, ctx, ctx.Err(), "Failed to resolve foods")
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
 
-// Optimized swapFoodItems with caching, better concurrency, reduced allocations, and timing tracking
-func swapFoodItems(llmResponse models.MealPlanLLMResponse) models.MealPlanAPIResponse {
+func servingSelectionHandler(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var reqBody models.ServingSelectionRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(reqBody.Meals) == 0 {
+		http.Error(w, "Invalid request: no meals provided", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	choices, err := geminiService.SelectServings(ctx, reqBody)
+	if err != nil {
+		log.Printf("Error calling LLM provider for serving selection: %v", err)
+		writePipelineError(w, ctx, err, "Failed to select servings")
+		return
+	}
+
+	result := applyServingChoices(reqBody, *choices)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// groceryListHandler consolidates the foods of a generated plan into a shopping list.
+// The body is the plan response (only "data" is read). JSON by default; CSV when
+// ?format=csv is given or the client accepts text/csv.
+func groceryListHandler(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var reqBody models.GroceryListRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(reqBody.Data) == 0 {
+		http.Error(w, "Invalid request: no plan days provided", http.StatusBadRequest)
+		return
+	}
+
+	list := services.BuildGroceryList(reqBody.Data)
+	log.Printf("🛒 Grocery list built: %d items over %d days", list.ItemCount, list.Days)
+
+	if r.URL.Query().Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="grocery-list.csv"`)
+		if err := services.WriteGroceryListCSV(w, list); err != nil {
+			log.Printf("Error writing grocery list CSV: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.GroceryListResponse{
+		Success: true,
+		Data:    list,
+		Message: "Grocery list created successfully",
+	})
+}
+
+// applyServingChoices scales each chosen serving by its percentage adjustment and
+// recalculates the meal macros from the adjusted servings
+func applyServingChoices(reqBody models.ServingSelectionRequest, choices models.ServingSelectionLLMResponse) models.ServingSelectionResponse {
+	result := models.ServingSelectionResponse{
+		Success: true,
+		Data:    make(map[string]models.MealServingChoices, len(reqBody.Meals)),
+		Message: "Serving selection completed successfully",
+	}
+	if choices.Fallback {
+		result.Fallback = true
+		result.Message = "Serving selection output was unusable; first servings were used"
+	}
+
+	for i, meal := range reqBody.Meals {
+		mealChoices := models.MealServingChoices{
+			MealName:    meal.MealName,
+			MealTime:    meal.MealTime,
+			Meridiem:    meal.Meridiem,
+			MacroTarget: meal.MacroTarget,
+			Foods:       make([]models.FoodServingChoice, 0, len(meal.Foods)),
+		}
+
+		adjustedFoods := make([]models.Food, 0, len(meal.Foods))
+		for j, food := range meal.Foods {
+			if len(food.Servings) == 0 {
+				continue
+			}
+			choice := choices.Meals[i].Foods[j]
+
+			serving := food.Servings[0]
+			for _, candidate := range food.Servings {
+				if candidate.ServingID == choice.ServingID {
+					serving = candidate
+					break
+				}
+			}
+			serving = ensureServingFields(serving, food.Servings)
+
+			// The adjustment changes how many units are eaten; the per-unit metric amount stays as listed
+			factor := 1.0 + choice.PercentageAdjustment/100.0
+			adjusted := scaleServing(serving, factor)
+			adjusted.MetricServingAmount = serving.MetricServingAmount
+			adjusted.NumberOfUnits = fmt.Sprintf("%.3f", parseFloatDefault(serving.NumberOfUnits)*factor)
+
+			mealChoices.Foods = append(mealChoices.Foods, models.FoodServingChoice{
+				FoodID:               food.FoodID,
+				FoodName:             food.FoodName,
+				ServingID:            serving.ServingID,
+				PercentageAdjustment: choice.PercentageAdjustment,
+				SelectedServing:      adjusted,
+			})
+
+			adjustedFood := food
+			adjustedFood.Servings = []models.Serving{adjusted}
+			adjustedFoods = append(adjustedFoods, adjustedFood)
+		}
+		mealChoices.Macros = calculateMealMacros(adjustedFoods)
+
+		// Keep meals with a repeated name apart
+		key := meal.MealName
+		if _, exists := result.Data[key]; exists || key == "" {
+			key = fmt.Sprintf("%s %d", meal.MealName, i+1)
+		}
+		result.Data[key] = mealChoices
+	}
+
+	return result
+}
+
+// Optimized swapFoodItems with caching, better concurrency, reduced allocations, and timing tracking.
+// Foods that break the profile's diet or allergy rules are replaced and reported, and
+// pinned products are added to their meals.
+func swapFoodItems(ctx context.Context, llmResponse models.MealPlanLLMResponse, profile *services.ComplianceProfile, health *services.HealthProfile, pins []models.PinnedFood) models.MealPlanAPIResponse {
 	// Start total timing
 	totalStart := time.Now()
 
 	result := models.MealPlanAPIResponse{
-		Success:        true,
-		Message:        llmResponse.Message,
-		Data:           make(map[string]models.DayAPIMeals, len(llmResponse.Data)),
-		Prepare:        llmResponse.Prepare,
-		Cook:           llmResponse.Cook,
-		WeightAssemble: llmResponse.WeightAssemble,
+		Success:           !llmResponse.Fallback,
+		Message:           llmResponse.Message,
+		Fallback:          llmResponse.Fallback,
+		ValidationErrors:  llmResponse.ValidationErrors,
+		EquipmentWarnings: llmResponse.EquipmentWarnings,
+		Health:            health.Summary(),
+		Data:              make(map[string]models.DayAPIMeals, len(llmResponse.Data)),
+		Prepare:           llmResponse.Prepare,
+		Cook:              llmResponse.Cook,
+		WeightAssemble:    llmResponse.WeightAssemble,
 	}
 
 	// Step 1: Data Collection Timing
@@ -141,43 +363,74 @@ func swapFoodItems(llmResponse models.MealPlanLLMResponse) models.MealPlanAPIRes
 
 	// Step 2: Food Fetching Timing
 	foodFetchingStart := time.Now()
-	foodResults := batchFetchFoods(uniqueFoods)
+	foodResults, swaps, fetchStats := resolveCompliantFoods(ctx, profile, uniqueFoods)
 	foodFetchingTime := time.Since(foodFetchingStart)
 
 	// Step 3: Serving Optimization Timing
 	servingOptimizationStart := time.Now()
 
 	// Process all meals with pre-fetched food data
+	incompleteMeals := 0
 	for _, mealData := range allMeals {
 		mealItem := mealData.mealItem
+
+		// Initialize day data if not exists
+		if _, exists := result.Data[mealData.dayKey]; !exists {
+			result.Data[mealData.dayKey] = models.DayAPIMeals{
+				Date:  mealData.dayMeals.Date,
+				Meals: make([]models.MealAPIItems, len(mealData.dayMeals.Meals)),
+			}
+		}
+
+		// Reserved slots are placeholders carrying their estimated macros
+		if mealItem.Reserved != nil {
+			result.Data[mealData.dayKey].Meals[mealData.mealIndex] = models.MealAPIItems{
+				MealName:    mealItem.MealName,
+				MealTime:    mealItem.MealTime,
+				Meridiem:    mealItem.Meridiem,
+				MacroTarget: mealItem.MacroTarget,
+				Macros:      mealItem.Reserved.Estimated,
+				Reserved:    mealItem.Reserved,
+				Foods:       []models.Food{},
+			}
+			continue
+		}
+
+		var substitutions []models.Substitution
+		mealItem.Foods, substitutions = applyComplianceSwaps(mealItem.Foods, swaps, mealData.dayMeals.Date, mealItem.MealName)
+		result.Substitutions = append(result.Substitutions, substitutions...)
 		foods := make([]models.Food, 0, len(mealItem.Foods))
+		var missing []string
 
 		// Build foods list from pre-fetched results
 		for _, foodWithPortion := range mealItem.Foods {
 			if food, exists := foodResults[foodWithPortion.Name]; exists && food != nil {
-				// Filter servings to keep only gram-based ones, use first as selected
-				food.Servings = filterGramServings(food.Servings)
+				// Convert servings to grams, use the first as selected
+				food.Servings = gramServings(*food)
 				if len(food.Servings) > 0 {
 					// Ensure first serving has all required fields populated
 					food.Servings[0] = ensureServingFields(food.Servings[0], food.Servings)
 				}
+				food.Category = foodClasses.Classify(*food).Class
 				foods = append(foods, *food)
+				continue
 			}
+			result.Unresolved = append(result.Unresolved, models.UnresolvedFood{
+				Date:     mealData.dayMeals.Date,
+				MealName: mealItem.MealName,
+				Food:     foodWithPortion.Name,
+				Reason:   fetchStats.unresolvedReason(foodWithPortion.Name),
+			})
+			missing = append(missing, foodWithPortion.Name)
 		}
 
 		// Select gram-based servings and adjust based on portion ratios
 		optimizedFoods := adjustServingsByPortionRatio(foods, mealItem.Foods, mealItem.MacroTarget.Calories)
+		optimizedFoods = append(pinnedMealFoods(pins, mealData.dayKey, mealItem.MealName), optimizedFoods...)
 
-		// Rebalance macros to correct low fats and excess carbs while keeping realism
-		optimizedFoods = rebalanceMealFoods(optimizedFoods, mealItem.MacroTarget)
-
-		// Initialize day data if not exists
-		if _, exists := result.Data[mealData.dayKey]; !exists {
-			result.Data[mealData.dayKey] = models.DayAPIMeals{
-				Date:  mealData.dayMeals.Date,
-				Meals: make([]models.MealAPIItems, len(mealData.dayMeals.Meals)),
-			}
-		}
+		// Solve gram amounts for all foods together against the meal targets, around
+		// any pinned products, and round to amounts that can be weighed or counted
+		optimizedFoods, residual := fitMealPortions(optimizedFoods, mealItem.MacroTarget)
 
 		// Calculate total macros for the meal
 		totalMacros := calculateMealMacros(optimizedFoods)
@@ -188,11 +441,30 @@ func swapFoodItems(llmResponse models.MealPlanLLMResponse) models.MealPlanAPIRes
 			Meridiem:    mealItem.Meridiem,
 			MacroTarget: mealItem.MacroTarget,
 			Macros:      totalMacros,
+			Residual:    &residual,
 			Foods:       optimizedFoods,
+
+			Incomplete:   len(missing) > 0,
+			MissingFoods: missing,
+		}
+		if len(missing) > 0 {
+			incompleteMeals++
 		}
 	}
 	servingOptimizationTime := time.Since(servingOptimizationStart)
 
+	// A meal missing one of its foods no longer has the structure it was planned with
+	if incompleteMeals > 0 {
+		result.Success = false
+		result.Message = fmt.Sprintf("%d meals are missing foods that could not be resolved", incompleteMeals)
+	}
+
+	// Check the solved portions against health-condition and life-stage rules
+	for key, day := range result.Data {
+		health.CheckDay(&day)
+		result.Data[key] = day
+	}
+
 	// Step 4: Response Build Timing
 	responseBuildStart := time.Now()
 	totalDuration := time.Since(totalStart)
@@ -205,13 +477,15 @@ func swapFoodItems(llmResponse models.MealPlanLLMResponse) models.MealPlanAPIRes
 		FoodFetchingTime:    formatDuration(foodFetchingTime),
 		ServingOptimization: formatDuration(servingOptimizationTime),
 		ResponseBuildTime:   formatDuration(responseBuildTime),
+		CacheHits:           fetchStats.cacheHits,
+		CacheMisses:         fetchStats.cacheMisses,
 	}
 
 	return result
 }
 
 // processRegenerationResponse processes regeneration response and returns single meal object
-func processRegenerationResponse(llmResponse models.RegenerationLLMResponse, reqBody models.RegenerationRequest) models.RegenerationResponse {
+func processRegenerationResponse(ctx context.Context, llmResponse models.RegenerationLLMResponse, reqBody models.RegenerationRequest) models.RegenerationResponse {
 	// Start total timing
 	totalStart := time.Now()
 
@@ -225,31 +499,50 @@ func processRegenerationResponse(llmResponse models.RegenerationLLMResponse, req
 
 	// Step 2: Food Fetching Timing
 	foodFetchingStart := time.Now()
-	foodResults := batchFetchFoods(uniqueFoods)
+	health := healthRules.ProfileFor(reqBody.HealthConditions, reqBody.LifePhases)
+	profile := services.NewComplianceProfile(reqBody.DietType, reqBody.FoodsToAvoid)
+	profile.UseClassifier(foodClasses)
+	health.AddExclusionsTo(profile)
+	foodResults, swaps, fetchStats := resolveCompliantFoods(ctx, profile, uniqueFoods)
 	foodFetchingTime := time.Since(foodFetchingStart)
 
 	// Step 3: Serving Optimization Timing
 	servingOptimizationStart := time.Now()
 
+	// Replace anything that breaks the diet or the foods to avoid
+	mealFoods, substitutions := applyComplianceSwaps(llmResponse.Data.Foods, swaps, "", reqBody.OriginalMeal.MealName)
+
 	// Build foods list from pre-fetched results
-	foods := make([]models.Food, 0, len(llmResponse.Data.Foods))
-	for _, foodWithPortion := range llmResponse.Data.Foods {
+	foods := make([]models.Food, 0, len(mealFoods))
+	var unresolved []models.UnresolvedFood
+	var missing []string
+	for _, foodWithPortion := range mealFoods {
 		if food, exists := foodResults[foodWithPortion.Name]; exists && food != nil {
-			// Filter servings to keep only gram-based ones, use first as selected
-			food.Servings = filterGramServings(food.Servings)
+			// Convert servings to grams, use the first as selected
+			food.Servings = gramServings(*food)
 			if len(food.Servings) > 0 {
 				// Ensure first serving has all required fields populated
 				food.Servings[0] = ensureServingFields(food.Servings[0], food.Servings)
 			}
+			food.Category = foodClasses.Classify(*food).Class
 			foods = append(foods, *food)
+			continue
 		}
+		unresolved = append(unresolved, models.UnresolvedFood{
+			MealName: reqBody.OriginalMeal.MealName,
+			Food:     foodWithPortion.Name,
+			Reason:   fetchStats.unresolvedReason(foodWithPortion.Name),
+		})
+		missing = append(missing, foodWithPortion.Name)
 	}
 
 	// Select gram-based servings and adjust based on portion ratios
-	optimizedFoods := adjustServingsByPortionRatio(foods, llmResponse.Data.Foods, llmResponse.Data.MacroTarget.Calories)
+	optimizedFoods := adjustServingsByPortionRatio(foods, mealFoods, llmResponse.Data.MacroTarget.Calories)
+	optimizedFoods = append(pinnedMealFoods(reqBody.PinnedFoods, "", reqBody.OriginalMeal.MealName), optimizedFoods...)
 
-	// Rebalance macros to correct low fats and excess carbs while keeping realism
-	optimizedFoods = rebalanceMealFoods(optimizedFoods, llmResponse.Data.MacroTarget)
+	// Solve gram amounts for all foods together against the meal targets, around any
+	// pinned products
+	optimizedFoods, residual := fitMealPortions(optimizedFoods, llmResponse.Data.MacroTarget)
 
 	// Calculate total macros for the meal
 	totalMacros := calculateMealMacros(optimizedFoods)
@@ -270,20 +563,35 @@ func processRegenerationResponse(llmResponse models.RegenerationLLMResponse, req
 	log.Printf("Regeneration Response - Calculated Macros: Calories=%.1f, Protein=%.1f, Carbs=%.1f, Fat=%.1f",
 		totalMacros.Calories, totalMacros.Proteins, totalMacros.Carbs, totalMacros.Fats)
 
+	nutrients := services.MealNutrients(optimizedFoods)
+
 	// Create regeneration response - always use original meal data to ensure consistency
 	result := models.RegenerationResponse{
-		Success:        true,
-		Message:        llmResponse.Message,
-		Prepare:        llmResponse.Prepare,
-		Cook:           llmResponse.Cook,
-		WeightAssemble: llmResponse.WeightAssemble,
+		Success:           !llmResponse.Fallback,
+		Message:           llmResponse.Message,
+		Fallback:          llmResponse.Fallback,
+		ValidationErrors:  llmResponse.ValidationErrors,
+		EquipmentWarnings: llmResponse.EquipmentWarnings,
+		Health:            health.Summary(),
+		Substitutions:     substitutions,
+		Unresolved:        unresolved,
+		Prepare:           llmResponse.Prepare,
+		Cook:              llmResponse.Cook,
+		WeightAssemble:    llmResponse.WeightAssemble,
 		Data: models.RegenerationMealData{
 			MealName:    reqBody.OriginalMeal.MealName,    // Always use original
 			MealTime:    reqBody.OriginalMeal.MealTime,    // Always use original
 			Meridiem:    reqBody.OriginalMeal.Meridiem,    // Always use original
 			MacroTarget: reqBody.OriginalMeal.MacroTarget, // Always use original
 			Macros:      totalMacros,
+			Residual:    &residual,
 			Foods:       optimizedFoods,
+			Nutrients:   &nutrients,
+
+			Incomplete:   len(missing) > 0,
+			MissingFoods: missing,
+
+			HealthViolations: health.CheckMeal(optimizedFoods),
 		},
 		Timing: &models.TimingInfo{
 			TotalDuration:       formatDuration(totalDuration),
@@ -291,9 +599,16 @@ func processRegenerationResponse(llmResponse models.RegenerationLLMResponse, req
 			FoodFetchingTime:    formatDuration(foodFetchingTime),
 			ServingOptimization: formatDuration(servingOptimizationTime),
 			ResponseBuildTime:   formatDuration(responseBuildTime),
+			CacheHits:           fetchStats.cacheHits,
+			CacheMisses:         fetchStats.cacheMisses,
 		},
 	}
 
+	if len(missing) > 0 {
+		result.Success = false
+		result.Message = "Could not resolve " + strings.Join(missing, ", ")
+	}
+
 	return result
 }
 
@@ -316,54 +631,106 @@ type mealProcessingData struct {
 	dayMeals  models.DayLLMMeals
 }
 
-// batchFetchFoods efficiently fetches all unique foods with controlled concurrency
-func batchFetchFoods(uniqueFoods map[string]bool) map[string]*models.Food {
+// foodFetchStats counts food cache activity for a single batch fetch and says why
+// any food could not be resolved
+type foodFetchStats struct {
+	cacheHits   int
+	cacheMisses int
+	unresolved  map[string]string // food name -> reason
+}
+
+// merge adds another fetch's counts and unresolved foods
+func (s *foodFetchStats) merge(other foodFetchStats) {
+	s.cacheHits += other.cacheHits
+	s.cacheMisses += other.cacheMisses
+	for name, reason := range other.unresolved {
+		if s.unresolved == nil {
+			s.unresolved = make(map[string]string)
+		}
+		s.unresolved[name] = reason
+	}
+}
+
+// unresolvedReason explains why a food has no result
+func (s foodFetchStats) unresolvedReason(name string) string {
+	if reason, ok := s.unresolved[name]; ok {
+		return reason
+	}
+	return "no match found"
+}
+
+// batchFetchFoods efficiently fetches all unique foods with controlled concurrency.
+// Pending lookups are skipped once ctx is cancelled.
+func batchFetchFoods(ctx context.Context, uniqueFoods map[string]bool) (map[string]*models.Food, foodFetchStats) {
 	foodResults := make(map[string]*models.Food, len(uniqueFoods))
+	stats := foodFetchStats{unresolved: make(map[string]string)}
 
 	// Use a semaphore to limit concurrent requests (max 10 concurrent)
 	semaphore := make(chan struct{}, 10)
 	var wg sync.WaitGroup
 	var mutex sync.Mutex
 
-	// Track API calls
-	apiCalls := 0
-
 	for foodName := range uniqueFoods {
-		apiCalls++
 		wg.Add(1)
 		go func(name string) {
 			defer wg.Done()
 
-			// Acquire semaphore
-			semaphore <- struct{}{}
+			// Acquire semaphore, giving up if the request is gone
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				mutex.Lock()
+				stats.unresolved[name] = ctx.Err().Error()
+				mutex.Unlock()
+				return
+			}
 			defer func() { <-semaphore }()
 
-			// Fetch food data
-			searchResult, err := foodService.SearchFood(name)
+			// Fetch food data, served from the cache when possible
+			searchResult, cached, err := foodCache.SearchFood(ctx, name)
 			var food *models.Food
 			if err == nil && len(searchResult.Foods) > 0 {
-				food = &searchResult.Foods[0]
+				// Rank every candidate; the returned copy never aliases the cached result
+				food = services.SelectBestFood(name, searchResult.Foods)
+				food.Match.Provider = searchResult.ProviderName
+				food.Match.Cached = cached
 			}
 
 			// Store result thread-safely
 			mutex.Lock()
 			foodResults[name] = food
+			switch {
+			case err != nil:
+				log.Printf("⚠️ No food data for %s: %v", name, err)
+				stats.unresolved[name] = err.Error()
+			case food == nil:
+				stats.unresolved[name] = "no match found"
+			}
+			if cached {
+				stats.cacheHits++
+			} else {
+				stats.cacheMisses++
+			}
 			mutex.Unlock()
 		}(foodName)
 	}
 
 	wg.Wait()
 
+	if ctx.Err() != nil {
+		log.Printf("Food fetching stopped early: %v", ctx.Err())
+	}
+
 	// Log performance metrics
-	log.Printf("Food fetching: %d API calls", apiCalls)
+	log.Printf("Food fetching: %d unique foods, %d cache hits, %d API calls, %d unresolved", len(uniqueFoods), stats.cacheHits, stats.cacheMisses, len(stats.unresolved))
 
-	return foodResults
+	return foodResults, stats
 }
 
 // ensureServingFields ensures that the selected serving has all required fields populated
 func ensureServingFields(selectedServing models.Serving, availableServings []models.Serving) models.Serving {
 	// If the selected serving is empty or missing key fields, use the first available serving
-	if selectedServing.ServingID == "" || selectedServing.Calories == "" {
+	if selectedServing.ServingID == "" || !selectedServing.Nutrients().Known(models.NutrientCalories) {
 		if len(availableServings) > 0 {
 			selectedServing = availableServings[0]
 		}
@@ -389,101 +756,15 @@ func ensureServingFields(selectedServing models.Serving, availableServings []mod
 	if selectedServing.NumberOfUnits == "" {
 		selectedServing.NumberOfUnits = "1"
 	}
-	if selectedServing.Calories == "" {
-		selectedServing.Calories = "0"
-	}
-	if selectedServing.Protein == "" {
-		selectedServing.Protein = "0"
-	}
-	if selectedServing.Carbohydrate == "" {
-		selectedServing.Carbohydrate = "0"
-	}
-	if selectedServing.Fat == "" {
-		selectedServing.Fat = "0"
-	}
-	if selectedServing.Sugar == "" {
-		selectedServing.Sugar = "0"
-	}
-	if selectedServing.Fiber == "" {
-		selectedServing.Fiber = "0"
-	}
-	if selectedServing.SaturatedFat == "" {
-		selectedServing.SaturatedFat = "0"
-	}
-	if selectedServing.MonounsaturatedFat == "" {
-		selectedServing.MonounsaturatedFat = "0"
-	}
-	if selectedServing.PolyunsaturatedFat == "" {
-		selectedServing.PolyunsaturatedFat = "0"
-	}
-	if selectedServing.Cholesterol == "" {
-		selectedServing.Cholesterol = "0"
-	}
-	if selectedServing.Sodium == "" {
-		selectedServing.Sodium = "0"
-	}
-	if selectedServing.Potassium == "" {
-		selectedServing.Potassium = "0"
-	}
-	if selectedServing.Calcium == "" {
-		selectedServing.Calcium = "0"
-	}
-	if selectedServing.Iron == "" {
-		selectedServing.Iron = "0"
-	}
-	if selectedServing.VitaminA == "" {
-		selectedServing.VitaminA = "0"
-	}
-	if selectedServing.VitaminB == "" {
-		selectedServing.VitaminB = "0"
-	}
-	if selectedServing.VitaminC == "" {
-		selectedServing.VitaminC = "0"
-	}
-	if selectedServing.VitaminD == "" {
-		selectedServing.VitaminD = "0"
-	}
+	// Missing nutrients stay unknown and are written as empty strings in the response
+	selectedServing.SetNutrients(selectedServing.Nutrients())
 
 	return selectedServing
 }
 
 // calculateMealMacros calculates the total macros for all foods in a meal
 func calculateMealMacros(foods []models.Food) models.MacroTarget {
-	var totalCalories, totalCarbs, totalProteins, totalFats float64
-
-	for _, food := range foods {
-		// Use first serving (which is now the selected gram-based serving)
-		if len(food.Servings) > 0 {
-			serving := food.Servings[0]
-
-			// Parse and add calories
-			if calories, err := strconv.ParseFloat(serving.Calories, 64); err == nil {
-				totalCalories += calories
-			}
-
-			// Parse and add carbs
-			if carbs, err := strconv.ParseFloat(serving.Carbohydrate, 64); err == nil {
-				totalCarbs += carbs
-			}
-
-			// Parse and add protein
-			if protein, err := strconv.ParseFloat(serving.Protein, 64); err == nil {
-				totalProteins += protein
-			}
-
-			// Parse and add fat
-			if fat, err := strconv.ParseFloat(serving.Fat, 64); err == nil {
-				totalFats += fat
-			}
-		}
-	}
-
-	return models.MacroTarget{
-		Calories: totalCalories,
-		Carbs:    totalCarbs,
-		Proteins: totalProteins,
-		Fats:     totalFats,
-	}
+	return services.SumNutrients(foods).Macros()
 }
 
 // adjustServingsByPortionRatio selects gram-based servings and adjusts them based on portion ratios
@@ -495,8 +776,12 @@ func adjustServingsByPortionRatio(foods []models.Food, foodWithPortions []models
 
 		// Use first serving (which is now the selected gram-based serving)
 		if len(food.Servings) > 0 {
-			// Find the portion ratio for this food
-			portionRatio := findPortionRatio(food.FoodName, foodWithPortions)
+			// Find the portion ratio for this food, keyed by the LLM name it was matched from
+			lookupName := food.FoodName
+			if food.Match != nil {
+				lookupName = food.Match.Query
+			}
+			portionRatio := findPortionRatio(lookupName, foodWithPortions)
 
 			// Calculate target calories for this food
 			targetCaloriesForFood := (targetCalories * float64(portionRatio)) / 100.0
@@ -523,192 +808,21 @@ func findPortionRatio(foodName string, foodWithPortions []models.FoodWithPortion
 
 // adjustServingForTargetCalories adjusts a serving to match target calories
 func adjustServingForTargetCalories(serving models.Serving, targetCalories float64) models.Serving {
-	// Parse current calories and serving amount
-	currentCalories, err := strconv.ParseFloat(serving.Calories, 64)
-	if err != nil || currentCalories == 0 {
-		return serving // Return original if can't parse
-	}
-
-	currentAmount, err := strconv.ParseFloat(serving.MetricServingAmount, 64)
-	if err != nil || currentAmount == 0 {
-		return serving // Return original if can't parse
-	}
-
-	// Calculate the multiplier needed
-	multiplier := targetCalories / currentCalories
-
-	// Adjust all nutritional values by the multiplier
-	adjustedServing := serving
-
-	// Update serving amount
-	adjustedServing.MetricServingAmount = fmt.Sprintf("%.3f", currentAmount*multiplier)
-
-	// Update all nutritional values
-	adjustedServing = adjustNutritionalValue(adjustedServing, "calories", currentCalories*multiplier)
-	adjustedServing = adjustNutritionalValue(adjustedServing, "protein", parseAndMultiply(serving.Protein, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "carbohydrate", parseAndMultiply(serving.Carbohydrate, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "fat", parseAndMultiply(serving.Fat, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "sugar", parseAndMultiply(serving.Sugar, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "fiber", parseAndMultiply(serving.Fiber, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "saturated_fat", parseAndMultiply(serving.SaturatedFat, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "monounsaturated_fat", parseAndMultiply(serving.MonounsaturatedFat, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "polyunsaturated_fat", parseAndMultiply(serving.PolyunsaturatedFat, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "cholesterol", parseAndMultiply(serving.Cholesterol, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "sodium", parseAndMultiply(serving.Sodium, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "potassium", parseAndMultiply(serving.Potassium, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "calcium", parseAndMultiply(serving.Calcium, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "iron", parseAndMultiply(serving.Iron, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "vitamin_a", parseAndMultiply(serving.VitaminA, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "vitamin_b", parseAndMultiply(serving.VitaminB, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "vitamin_c", parseAndMultiply(serving.VitaminC, multiplier))
-	adjustedServing = adjustNutritionalValue(adjustedServing, "vitamin_d", parseAndMultiply(serving.VitaminD, multiplier))
-
-	return adjustedServing
-}
-
-// parseAndMultiply parses a string value and multiplies it by the multiplier
-func parseAndMultiply(value string, multiplier float64) float64 {
-	if parsed, err := strconv.ParseFloat(value, 64); err == nil {
-		return parsed * multiplier
+	currentCalories, ok := serving.Nutrients().Get(models.NutrientCalories)
+	if !ok || currentCalories == 0 || parseFloatDefault(serving.MetricServingAmount) == 0 {
+		return serving // Return original if the calories or amount are unknown
 	}
-	return 0
+	return scaleServing(serving, targetCalories/currentCalories)
 }
 
-// adjustNutritionalValue updates a nutritional value in the serving
-func adjustNutritionalValue(serving models.Serving, field string, newValue float64) models.Serving {
-	valueStr := fmt.Sprintf("%.3f", newValue)
-
-	switch field {
-	case "calories":
-		serving.Calories = valueStr
-	case "protein":
-		serving.Protein = valueStr
-	case "carbohydrate":
-		serving.Carbohydrate = valueStr
-	case "fat":
-		serving.Fat = valueStr
-	case "sugar":
-		serving.Sugar = valueStr
-	case "fiber":
-		serving.Fiber = valueStr
-	case "saturated_fat":
-		serving.SaturatedFat = valueStr
-	case "monounsaturated_fat":
-		serving.MonounsaturatedFat = valueStr
-	case "polyunsaturated_fat":
-		serving.PolyunsaturatedFat = valueStr
-	case "cholesterol":
-		serving.Cholesterol = valueStr
-	case "sodium":
-		serving.Sodium = valueStr
-	case "potassium":
-		serving.Potassium = valueStr
-	case "calcium":
-		serving.Calcium = valueStr
-	case "iron":
-		serving.Iron = valueStr
-	case "vitamin_a":
-		serving.VitaminA = valueStr
-	case "vitamin_b":
-		serving.VitaminB = valueStr
-	case "vitamin_c":
-		serving.VitaminC = valueStr
-	case "vitamin_d":
-		serving.VitaminD = valueStr
+// gramServings converts every serving of the food to grams, most exact first, so the
+// first serving can always be scaled by weight
+func gramServings(food models.Food) []models.Serving {
+	servings := services.GramServings(food)
+	if len(servings) > 0 && servings[0].HouseholdMeasure != "" {
+		log.Printf("⚖️ %s: using %s %s converted to grams", food.FoodName, servings[0].MetricServingAmount, servings[0].HouseholdMeasure)
 	}
-
-	return serving
-}
-
-// filterGramServings filters servings to keep only gram-based ones
-func filterGramServings(servings []models.Serving) []models.Serving {
-	var gramServings []models.Serving
-	for _, serving := range servings {
-		// Check if this is a gram-based serving by looking at the measurement description
-		descriptionLower := strings.ToLower(serving.MeasurementDescription)
-
-		// Look for servings with gram-based descriptions
-		if descriptionLower == "g" || descriptionLower == "gram" || descriptionLower == "grams" {
-			gramServings = append(gramServings, serving)
-		}
-	}
-
-	// If no gram servings found, return the original list (fallback to first serving)
-	if len(gramServings) == 0 && len(servings) > 0 {
-		return []models.Serving{servings[0]}
-	}
-
-	return gramServings
-}
-
-// findGramServing finds a gram-based serving from the available servings (deprecated - use filterGramServings)
-func findGramServing(servings []models.Serving) *models.Serving {
-	for _, serving := range servings {
-		// Check if this is a gram-based serving by looking at the measurement description
-		descriptionLower := strings.ToLower(serving.MeasurementDescription)
-
-		// Look for servings with gram-based descriptions
-		if descriptionLower == "g" || descriptionLower == "gram" || descriptionLower == "grams" {
-			return &serving
-		}
-	}
-	return nil
-}
-
-// rebalanceMealFoods adjusts servings to increase fats if under target and trim starchy carbs if over target
-func rebalanceMealFoods(foods []models.Food, target models.MacroTarget) []models.Food {
-	const tolerance = 0.05 // 5% tolerance
-
-	// Run a couple of light passes to avoid drastic swings
-	for pass := 0; pass < 2; pass++ {
-		totals := calculateMealMacros(foods)
-
-		// If fats are under target, try increasing a whole-food fat first
-		fatLowerBound := target.Fats * (1.0 - tolerance)
-		if totals.Fats < fatLowerBound {
-			neededFat := fatLowerBound - totals.Fats
-			// Prefer whole-food fats; fallback to higher-fat proteins if needed
-			idx := findBestFatFoodIndex(foods)
-			if idx >= 0 && len(foods[idx].Servings) > 0 {
-				serving := foods[idx].Servings[0]
-				fatPerUnit := parseFloatDefault(serving.Fat)
-				if fatPerUnit > 0 {
-					// Increase by a modest factor proportional to needed grams
-					// Cap to avoid unrealistic portions
-					factor := 1.0 + minFloat(0.6, neededFat/fatPerUnit*0.8)
-					foods[idx].Servings[0] = scaleServing(serving, factor)
-				}
-			}
-		}
-
-		// If carbs exceed target, trim starchy carbs first
-		carbUpperBound := target.Carbs * (1.0 + tolerance)
-		if totals.Carbs > carbUpperBound {
-			excessCarb := totals.Carbs - carbUpperBound
-			starchyIndexes := findStarchyCarbIndexes(foods)
-			if len(starchyIndexes) > 0 {
-				// Compute total carbs from starchy sources
-				var starchCarbs float64
-				for _, i := range starchyIndexes {
-					if len(foods[i].Servings) > 0 {
-						starchCarbs += parseFloatDefault(foods[i].Servings[0].Carbohydrate)
-					}
-				}
-				if starchCarbs > 0 {
-					// Reduce starchy carbs proportionally; cap reduction per pass
-					reductionFrac := minFloat(0.35, excessCarb/starchCarbs)
-					factor := 1.0 - reductionFrac
-					for _, i := range starchyIndexes {
-						if len(foods[i].Servings) > 0 {
-							foods[i].Servings[0] = scaleServing(foods[i].Servings[0], factor)
-						}
-					}
-				}
-			}
-		}
-	}
-
-	return foods
+	return servings
 }
 
 // scaleServing multiplies serving amount and all nutrient fields by factor
@@ -718,25 +832,8 @@ func scaleServing(serving models.Serving, factor float64) models.Serving {
 	}
 	currentAmount := parseFloatDefault(serving.MetricServingAmount)
 	serving.MetricServingAmount = fmt.Sprintf("%.3f", currentAmount*factor)
-
-	serving.Calories = fmt.Sprintf("%.3f", parseFloatDefault(serving.Calories)*factor)
-	serving.Protein = fmt.Sprintf("%.3f", parseFloatDefault(serving.Protein)*factor)
-	serving.Carbohydrate = fmt.Sprintf("%.3f", parseFloatDefault(serving.Carbohydrate)*factor)
-	serving.Fat = fmt.Sprintf("%.3f", parseFloatDefault(serving.Fat)*factor)
-	serving.Sugar = fmt.Sprintf("%.3f", parseFloatDefault(serving.Sugar)*factor)
-	serving.Fiber = fmt.Sprintf("%.3f", parseFloatDefault(serving.Fiber)*factor)
-	serving.SaturatedFat = fmt.Sprintf("%.3f", parseFloatDefault(serving.SaturatedFat)*factor)
-	serving.MonounsaturatedFat = fmt.Sprintf("%.3f", parseFloatDefault(serving.MonounsaturatedFat)*factor)
-	serving.PolyunsaturatedFat = fmt.Sprintf("%.3f", parseFloatDefault(serving.PolyunsaturatedFat)*factor)
-	serving.Cholesterol = fmt.Sprintf("%.3f", parseFloatDefault(serving.Cholesterol)*factor)
-	serving.Sodium = fmt.Sprintf("%.3f", parseFloatDefault(serving.Sodium)*factor)
-	serving.Potassium = fmt.Sprintf("%.3f", parseFloatDefault(serving.Potassium)*factor)
-	serving.Calcium = fmt.Sprintf("%.3f", parseFloatDefault(serving.Calcium)*factor)
-	serving.Iron = fmt.Sprintf("%.3f", parseFloatDefault(serving.Iron)*factor)
-	serving.VitaminA = fmt.Sprintf("%.3f", parseFloatDefault(serving.VitaminA)*factor)
-	serving.VitaminB = fmt.Sprintf("%.3f", parseFloatDefault(serving.VitaminB)*factor)
-	serving.VitaminC = fmt.Sprintf("%.3f", parseFloatDefault(serving.VitaminC)*factor)
-	serving.VitaminD = fmt.Sprintf("%.3f", parseFloatDefault(serving.VitaminD)*factor)
+	serving.HouseholdAmount *= factor
+	serving.SetNutrients(serving.Nutrients().Scale(factor))
 	return serving
 }
 
@@ -748,68 +845,6 @@ func parseFloatDefault(s string) float64 {
 	return v
 }
 
-// findBestFatFoodIndex finds an index of a likely whole-food fat; prioritizes avocado, nuts, seeds, nut butters, cheese; falls back to high-fat proteins
-func findBestFatFoodIndex(foods []models.Food) int {
-	bestIdx := -1
-	// Primary fat sources
-	for i, f := range foods {
-		if isWholeFoodFat(f.FoodName) {
-			bestIdx = i
-			break
-		}
-	}
-	if bestIdx != -1 {
-		return bestIdx
-	}
-	// Fallback: high-fat proteins like salmon, beef, eggs
-	for i, f := range foods {
-		name := strings.ToLower(f.FoodName)
-		if strings.Contains(name, "salmon") || strings.Contains(name, "beef") || strings.Contains(name, "egg") || strings.Contains(name, "whole milk") || strings.Contains(name, "cheese") {
-			return i
-		}
-	}
-	return -1
-}
-
-func isWholeFoodFat(name string) bool {
-	n := strings.ToLower(name)
-	fatKeywords := []string{"avocado", "almond", "walnut", "pecan", "cashew", "pistachio", "hazelnut", "macadamia", "peanut", "nut butter", "peanut butter", "almond butter", "tahini", "sesame", "sunflower seed", "pumpkin seed", "chia", "flax", "hemp", "olive oil", "olives", "cheese"}
-	for _, k := range fatKeywords {
-		if strings.Contains(n, k) {
-			return true
-		}
-	}
-	return false
-}
-
-func findStarchyCarbIndexes(foods []models.Food) []int {
-	var idxs []int
-	for i, f := range foods {
-		if isStarchyCarb(f.FoodName) {
-			idxs = append(idxs, i)
-		}
-	}
-	return idxs
-}
-
-func isStarchyCarb(name string) bool {
-	n := strings.ToLower(name)
-	starch := []string{"rice", "oat", "oatmeal", "potato", "sweet potato", "pasta", "quinoa", "bread", "tortilla", "corn", "couscous", "barley"}
-	for _, k := range starch {
-		if strings.Contains(n, k) {
-			return true
-		}
-	}
-	return false
-}
-
-func minFloat(a, b float64) float64 {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 func generateProgramSSEHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("📥 Received SSE request from %s", r.RemoteAddr)
 	enableCORS(w)
@@ -836,6 +871,15 @@ func generateProgramSSEHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	// Pinned products are looked up before the stream starts, so a bad barcode is a 400
+	if err := resolvePinnedFoods(ctx, reqBody.PinnedFoods, ""); err != nil {
+		writePinError(w, ctx, err)
+		return
+	}
+
 	// Set headers for SSE
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -847,60 +891,8 @@ func generateProgramSSEHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate the meal plan
-	response, err := geminiService.GenerateMeals(reqBody)
-	if err != nil {
-		fmt.Fprintf(w, "data: Error: %v\n\n", err)
-		flusher.Flush()
-		return
-	}
-
-	result := swapFoodItems(*response)
-
-	// Stream the data for each day
-	for dayKey, dayData := range result.Data {
-		// Send DAY_START marker
-		fmt.Fprintf(w, "data: <DAY_START>\n\n")
-		flusher.Flush()
-
-		// Stream each meal
-		for _, meal := range dayData.Meals {
-			// Send MEAL_START marker
-			fmt.Fprintf(w, "data: <MEAL_START>\n\n")
-			flusher.Flush()
-
-			// Create a single meal response
-			mealResponse := map[string]interface{}{
-				"day":   dayKey,
-				"meals": []models.MealAPIItems{meal},
-			}
-
-			// Send the meal data as JSON
-			mealJSON, err := json.Marshal(mealResponse)
-			if err != nil {
-				log.Printf("Error marshaling meal: %v", err)
-				continue
-			}
-
-			fmt.Fprintf(w, "data: %s\n\n", string(mealJSON))
-			flusher.Flush()
-
-			// Send MEAL_END marker
-			fmt.Fprintf(w, "data: <MEAL_END>\n\n")
-			flusher.Flush()
-
-			// Small delay between meals for better UX
-			time.Sleep(100 * time.Millisecond)
-		}
-
-		// Send DAY_END marker
-		fmt.Fprintf(w, "data: <DAY_END>\n\n")
-		flusher.Flush()
-	}
-
-	// Send completion marker
-	fmt.Fprintf(w, "data: <MEAL_PLAN_END>\n\n")
-	flusher.Flush()
+	// Generate and stream the plan day by day
+	streamMealPlan(ctx, w, flusher, reqBody)
 }
 
 func generateProgramSSEPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -930,6 +922,15 @@ func generateProgramSSEPostHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("📦 Request decoded successfully")
 	log.Printf("User: %s, Age: %d, Meals: %s, Diet: %s", reqBody.Name, reqBody.Age, reqBody.MealsPerDay, reqBody.DietType)
 
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	// Pinned products are looked up before the stream starts, so a bad barcode is a 400
+	if err := resolvePinnedFoods(ctx, reqBody.PinnedFoods, ""); err != nil {
+		writePinError(w, ctx, err)
+		return
+	}
+
 	// Set headers for SSE
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -941,64 +942,9 @@ func generateProgramSSEPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate the meal plan
-	log.Println("🔄 Calling Gemini API...")
-	response, err := geminiService.GenerateMeals(reqBody)
-	if err != nil {
-		log.Printf("❌ Error from Gemini API: %v", err)
-		fmt.Fprintf(w, "data: Error: %v\n\n", err)
-		flusher.Flush()
-		return
-	}
-
-	log.Println("✅ Gemini API response received")
-	result := swapFoodItems(*response)
-
+	// Generate and stream the plan day by day
 	log.Println("🚀 Starting to stream meal data...")
-	// Stream the data for each day
-	for dayKey, dayData := range result.Data {
-		// Send DAY_START marker
-		fmt.Fprintf(w, "data: <DAY_START>\n\n")
-		flusher.Flush()
-
-		// Stream each meal
-		for _, meal := range dayData.Meals {
-			// Send MEAL_START marker
-			fmt.Fprintf(w, "data: <MEAL_START>\n\n")
-			flusher.Flush()
-
-			// Create a single meal response
-			mealResponse := map[string]interface{}{
-				"day":   dayKey,
-				"meals": []models.MealAPIItems{meal},
-			}
-
-			// Send the meal data as JSON
-			mealJSON, err := json.Marshal(mealResponse)
-			if err != nil {
-				log.Printf("Error marshaling meal: %v", err)
-				continue
-			}
-
-			fmt.Fprintf(w, "data: %s\n\n", string(mealJSON))
-			flusher.Flush()
-
-			// Send MEAL_END marker
-			fmt.Fprintf(w, "data: <MEAL_END>\n\n")
-			flusher.Flush()
-
-			// Small delay between meals for better UX
-			time.Sleep(100 * time.Millisecond)
-		}
-
-		// Send DAY_END marker
-		fmt.Fprintf(w, "data: <DAY_END>\n\n")
-		flusher.Flush()
-	}
-
-	// Send completion marker
-	fmt.Fprintf(w, "data: <MEAL_PLAN_END>\n\n")
-	flusher.Flush()
+	streamMealPlan(ctx, w, flusher, reqBody)
 	log.Println("✅ Streaming completed")
 }
 
@@ -1018,12 +964,21 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "OK")
 }
 
+// providerHealthHandler reports the state of each food provider in lookup order
+func providerHealthHandler(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"providers": foodProvider.Health()})
+}
+
 func rootHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "mealgen-service endpoint")
 }
 
-func init() {
+// initServices reads the configuration and builds the shared services. It runs from
+// main rather than init so tests can use the package without a configured environment.
+func initServices() {
 	once.Do(func() {
 		log.Println("Initializing mealgen-service...")
 
@@ -1032,22 +987,55 @@ func init() {
 			log.Printf("Warning: Failed to load .env file: %v (this is normal for Cloud Run)", err)
 		}
 
-		// Get API keys from environment variables
-		geminiApiKey := os.Getenv("GEMINI_API_KEY")
-		foodApiKey := os.Getenv("FOOD_API_KEY")
+		foodProviderConfig := services.FoodProviderConfigFromEnv()
+
+		// Validate required API keys; a local food store lets the service run offline
+		if foodProviderConfig.APIKey == "" && foodProviderConfig.LocalDB == "" {
+			log.Fatal("❌ FOOD_API_KEY or LOCAL_FOOD_DB is required! Please add one to your .env file or set as environment variable")
+		}
 
-		// Validate required API keys
-		if geminiApiKey == "" {
-			log.Fatal("❌ GEMINI_API_KEY is required! Please add it to your .env file or set as environment variable")
+		llmConfig := services.LLMConfigFromEnv()
+		llmProvider, err := services.NewLLMProvider(llmConfig)
+		if err != nil {
+			log.Fatalf("❌ Failed to configure LLM provider: %v", err)
 		}
-		if foodApiKey == "" {
-			log.Fatal("❌ FOOD_API_KEY is required! Please add it to your .env file or set as environment variable")
+
+		if v, err := time.ParseDuration(os.Getenv("REQUEST_TIMEOUT")); err == nil && v > 0 {
+			requestTimeout = v
 		}
+		portionIncrements = services.PortionIncrementsFromEnv()
 
 		log.Println("Environment variables validated successfully")
+		log.Printf("Using LLM provider: %s", llmProvider.Name())
 
-		foodService = services.NewFoodService(foodApiKey)
-		geminiService = services.NewGeminiService(geminiApiKey, foodService)
+		// The cache sits in front of the chain: local store, food API, then a second API
+		foodProvider, err = services.NewFoodProviderChain(foodProviderConfig)
+		if err != nil {
+			log.Fatalf("❌ Failed to configure food providers: %v", err)
+		}
+		log.Printf("Using food providers: %s", foodProvider.Name())
+
+		foodCache, err = services.NewFoodCache(foodProvider, services.FoodCacheConfigFromEnv())
+		if err != nil {
+			log.Fatalf("❌ Failed to initialise food cache: %v", err)
+		}
+		healthRules, err = services.LoadHealthRules(os.Getenv("HEALTH_RULES_PATH"))
+		if err != nil {
+			log.Fatalf("❌ Failed to load health rules: %v", err)
+		}
+		log.Printf("Loaded %d health rules", len(healthRules.Rules))
+		foodClasses, err = services.LoadFoodClassifier(os.Getenv("FOOD_CLASSES_PATH"))
+		if err != nil {
+			log.Fatalf("❌ Failed to load food classes: %v", err)
+		}
+		geminiService = services.NewGeminiService(llmProvider, foodProvider, llmConfig.RepairAttempts, healthRules, foodClasses)
+
+		planStoreConfig := services.PlanStoreConfigFromEnv()
+		planStore, err = services.NewPlanStore(planStoreConfig)
+		if err != nil {
+			log.Fatalf("❌ Failed to initialise plan store: %v", err)
+		}
+		log.Printf("Using plan store: %s", planStoreConfig.Backend)
 
 		log.Println("Services initialized successfully")
 		log.Println("Ready to accept requests")
@@ -1055,6 +1043,8 @@ func init() {
 }
 
 func main() {
+	initServices()
+
 	// Get port from environment variable, default to 8080 for local development
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -1063,11 +1053,26 @@ func main() {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /health", healthHandler)
+	mux.HandleFunc("GET /health/providers", providerHealthHandler)
 	mux.HandleFunc("GET /", rootHandler)
 	mux.HandleFunc("OPTIONS /", corsPreflightHandler)
 	mux.HandleFunc("POST /", mealGenHandler)
 	mux.HandleFunc("OPTIONS /regenerate", corsPreflightHandler)
 	mux.HandleFunc("POST /regenerate", mealRegenerationHandler)
+	mux.HandleFunc("OPTIONS /serving-selection", corsPreflightHandler)
+	mux.HandleFunc("POST /serving-selection", servingSelectionHandler)
+	mux.HandleFunc("OPTIONS /grocery-list", corsPreflightHandler)
+	mux.HandleFunc("POST /grocery-list", groceryListHandler)
+	mux.HandleFunc("OPTIONS /swap", corsPreflightHandler)
+	mux.HandleFunc("POST /swap", swapHandler)
+	mux.HandleFunc("GET /foods/barcode/{code}", barcodeHandler)
+	mux.HandleFunc("OPTIONS /foods/barcode/{code}", corsPreflightHandler)
+	mux.HandleFunc("GET /plans/{id}", planHandler)
+	mux.HandleFunc("OPTIONS /plans/{id}", corsPreflightHandler)
+	mux.HandleFunc("POST /plans/{id}/regenerate", planRegenerationHandler)
+	mux.HandleFunc("OPTIONS /plans/{id}/regenerate", corsPreflightHandler)
+	mux.HandleFunc("GET /users/{id}/plans", userPlansHandler)
+	mux.HandleFunc("OPTIONS /users/{id}/plans", corsPreflightHandler)
 	mux.HandleFunc("GET /program/generate-program", generateProgramSSEHandler)
 	mux.HandleFunc("OPTIONS /program/generate-program", corsPreflightHandler)
 	mux.HandleFunc("POST /program/generate-program", generateProgramSSEPostHandler)
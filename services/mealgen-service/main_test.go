@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+// TestMain gives the package the built-in food classes and default portion increments;
+// tests that need the LLM, food providers or a plan store set them up themselves
+func TestMain(m *testing.M) {
+	var err error
+	foodClasses, err = services.LoadFoodClassifier("")
+	if err != nil {
+		log.Fatalf("failed to load food classes: %v", err)
+	}
+	portionIncrements = services.PortionIncrements{}
+	os.Exit(m.Run())
+}
+
+// testFood builds a food with a single serving of grams, from macros per 100 g
+func testFood(name string, grams, calories, protein, carbs, fat float64) models.Food {
+	format := func(per100g float64) string {
+		return strconv.FormatFloat(per100g*grams/100, 'f', 3, 64)
+	}
+	return models.Food{
+		FoodName: name,
+		Servings: []models.Serving{{
+			ServingDescription:     strconv.FormatFloat(grams, 'f', -1, 64) + " g",
+			MeasurementDescription: "g",
+			MetricServingAmount:    strconv.FormatFloat(grams, 'f', 3, 64),
+			MetricServingUnit:      "g",
+			NumberOfUnits:          strconv.FormatFloat(grams, 'f', 3, 64),
+			Calories:               format(calories),
+			Protein:                format(protein),
+			Carbohydrate:           format(carbs),
+			Fat:                    format(fat),
+		}},
+	}
+}
+
+func foodGrams(food models.Food) float64 {
+	return parseFloatDefault(food.Servings[0].MetricServingAmount)
+}
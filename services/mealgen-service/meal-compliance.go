@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+// planProfiles builds the diet and allergy profile for a plan request, with the foods
+// banned by its health rules added, and the health profile the meals are checked against
+func planProfiles(reqBody models.RequestBody) (*services.ComplianceProfile, *services.HealthProfile) {
+	health := healthRules.ProfileFor(reqBody.SelectedHealthConditions, reqBody.SelectedLifeStages)
+	profile := services.NewComplianceProfile(reqBody.DietType, reqBody.FoodAllergies)
+	profile.UseClassifier(foodClasses)
+	health.AddExclusionsTo(profile)
+	return profile, health
+}
+
+// referenceIntakesFor picks the reference intakes for the user on a plan request
+func referenceIntakesFor(reqBody models.RequestBody) *services.ReferenceIntakes {
+	return services.ReferenceIntakesFor(reqBody.Age, reqBody.Gender, reqBody.SelectedLifeStages)
+}
+
+// maxComplianceRounds bounds how many times a replacement is itself replaced when the
+// food it resolves to still breaks the profile
+const maxComplianceRounds = 3
+
+// complianceSwap is the replacement chosen for one non-compliant food name
+type complianceSwap struct {
+	replacement string // empty when no compliant alternative was found
+	reasons     []string
+}
+
+// resolveCompliantFoods resolves food names and replaces every food whose requested or
+// resolved name breaks the profile, or that no lookup could find. It returns the
+// resolved foods keyed by the final name and the swap chosen for each replaced name.
+func resolveCompliantFoods(ctx context.Context, profile *services.ComplianceProfile, names map[string]bool) (map[string]*models.Food, map[string]complianceSwap, foodFetchStats) {
+	swaps := make(map[string]complianceSwap)
+	if profile.Empty() {
+		foodResults, stats := batchFetchFoods(ctx, names)
+		recoverMissingFoods(ctx, profile, names, foodResults, swaps, &stats)
+		return foodResults, swaps, stats
+	}
+
+	// Every name ever tried, so a replacement never cycles back to a rejected food
+	tried := make(map[string]bool, len(names))
+	for name := range names {
+		tried[services.NormalizeFoodName(name)] = true
+	}
+
+	// origin maps a name being fetched back to the name the LLM asked for
+	origin := make(map[string]string, len(names))
+	toFetch := make(map[string]bool, len(names))
+
+	replace := func(original, name string, reasons []string) {
+		swap := swaps[original]
+		swap.reasons = append(swap.reasons, reasons...)
+		swap.replacement = ""
+		if replacement, ok := profile.Substitute(name, tried); ok {
+			tried[services.NormalizeFoodName(replacement)] = true
+			swap.replacement = replacement
+			origin[replacement] = original
+			toFetch[replacement] = true
+		}
+		swaps[original] = swap
+	}
+
+	// Catch what the name alone gives away before spending a lookup on it
+	for name := range names {
+		if reasons := profile.Violations(name); len(reasons) > 0 {
+			replace(name, name, reasons)
+			continue
+		}
+		origin[name] = name
+		toFetch[name] = true
+	}
+
+	foodResults := make(map[string]*models.Food, len(names))
+	var stats foodFetchStats
+	for round := 0; len(toFetch) > 0; round++ {
+		fetching := toFetch
+		toFetch = make(map[string]bool)
+
+		fetched, roundStats := batchFetchFoods(ctx, fetching)
+		stats.merge(roundStats)
+
+		for name := range fetching {
+			food := fetched[name]
+			if food == nil {
+				continue
+			}
+
+			// The matched food can reveal what the name did not, e.g. "protein pudding",
+			// or its macros can place it in a class the diet rules out
+			reasons := profile.FoodViolations(*food)
+			if len(reasons) == 0 {
+				foodResults[name] = food
+				continue
+			}
+			for i, reason := range reasons {
+				reasons[i] = fmt.Sprintf("%s in matched food %q", reason, food.FoodName)
+			}
+
+			original := origin[name]
+			if round+1 >= maxComplianceRounds {
+				swap := swaps[original]
+				swap.reasons = append(swap.reasons, reasons...)
+				swap.replacement = ""
+				swaps[original] = swap
+				continue
+			}
+			replace(original, name, reasons)
+		}
+	}
+
+	recoverMissingFoods(ctx, profile, names, foodResults, swaps, &stats)
+
+	for original, swap := range swaps {
+		if swap.replacement != "" && foodResults[swap.replacement] == nil {
+			log.Printf("⚠️ No compliant food resolved for %s", original)
+		}
+	}
+
+	return foodResults, swaps, stats
+}
+
+// applyComplianceSwaps rewrites one meal's foods with the chosen swaps and reports each
+// substitution. A replacement already present in the meal is not added twice.
+func applyComplianceSwaps(foods []models.FoodWithPortion, swaps map[string]complianceSwap, date, mealName string) ([]models.FoodWithPortion, []models.Substitution) {
+	if len(swaps) == 0 {
+		return foods, nil
+	}
+
+	present := make(map[string]bool, len(foods))
+	for _, food := range foods {
+		present[food.Name] = true
+	}
+
+	result := make([]models.FoodWithPortion, 0, len(foods))
+	var substitutions []models.Substitution
+	for _, food := range foods {
+		swap, ok := swaps[food.Name]
+		if !ok {
+			result = append(result, food)
+			continue
+		}
+
+		substitutions = append(substitutions, models.Substitution{
+			Date:        date,
+			MealName:    mealName,
+			Original:    food.Name,
+			Replacement: swap.replacement,
+			Reasons:     swap.reasons,
+		})
+		if swap.replacement == "" || present[swap.replacement] {
+			continue
+		}
+		present[swap.replacement] = true
+		food.Name = swap.replacement
+		result = append(result, food)
+	}
+
+	return result, substitutions
+}
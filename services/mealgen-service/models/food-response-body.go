@@ -1,5 +1,10 @@
 package models
 
+import (
+	"strconv"
+	"strings"
+)
+
 type FoodAPIResult struct {
 	ProviderName string `json:"provider_name"`
 	SearchTag    string `json:"search_tag"`
@@ -7,14 +12,48 @@ type FoodAPIResult struct {
 	MaxResults   string `json:"max_results"`   //Total results fetched
 	TotalResults string `json:"total_results"` //Total available results
 	Foods        []Food `json:"foods"`
+
+	// Provisional marks a poor match returned while a provider that might have done
+	// better was failing; it is not cached
+	Provisional bool `json:"-"`
+}
+
+// Total is the number of results available across all pages, or the number on this
+// page when the provider did not say
+func (r *FoodAPIResult) Total() int {
+	if total, err := strconv.Atoi(strings.TrimSpace(r.TotalResults)); err == nil && total >= len(r.Foods) {
+		return total
+	}
+	return len(r.Foods)
 }
 
 type Food struct {
-	FoodID    string    `json:"food_id"`
-	FoodName  string    `json:"food_name"`
-	FoodType  string    `json:"food_type"`
-	BrandName string    `json:"brand_name"`
-	Servings  []Serving `json:"servings"`
+	FoodID    string     `json:"food_id"`
+	FoodName  string     `json:"food_name"`
+	FoodType  string     `json:"food_type"`
+	BrandName string     `json:"brand_name"`
+	Servings  []Serving  `json:"servings"`
+	Match     *FoodMatch `json:"match,omitempty"`    // Why this search result was chosen
+	Category  string     `json:"category,omitempty"` // Food class, e.g. protein or starchy_carb
+	Pinned    bool       `json:"pinned,omitempty"`   // Placed by barcode at its label amount
+}
+
+// BarcodeResponse is a page of products found for a barcode
+type BarcodeResponse struct {
+	Success bool           `json:"success"`
+	Data    *FoodAPIResult `json:"data,omitempty"`
+	Message string         `json:"message,omitempty"`
+}
+
+// FoodMatch explains how a food was picked from the search results for an LLM food name
+type FoodMatch struct {
+	Query      string   `json:"query"`
+	Score      float64  `json:"score"`
+	Reasons    []string `json:"reasons,omitempty"`
+	Candidates int      `json:"candidates"`
+	Provider   string   `json:"provider,omitempty"` // Food source that answered the search
+	Cached     bool     `json:"cached,omitempty"`   // Answer came from the food cache
+	Variant    string   `json:"variant,omitempty"`  // Simplified search that found the food when the query did not
 }
 
 type Serving struct {
@@ -25,6 +64,10 @@ type Serving struct {
 	MetricServingUnit      string `json:"metric_serving_unit"`
 	NumberOfUnits          string `json:"number_of_units"`
 
+	// Household measure a gram serving was converted from, kept for display
+	HouseholdMeasure string  `json:"household_measure,omitempty"` // e.g. "cup" or "large"
+	HouseholdAmount  float64 `json:"household_amount,omitempty"`  // How many of the measure, scaled with the serving
+
 	// Macro Nutrients
 	Calories     string `json:"calories"`
 	Protein      string `json:"protein"`
@@ -50,4 +93,6 @@ type Serving struct {
 	VitaminB string `json:"vitamin_b"`
 	VitaminC string `json:"vitamin_c"`
 	VitaminD string `json:"vitamin_d"`
+
+	nutrients *NutrientVector // Set once the nutrients have been adjusted; see SetNutrients
 }
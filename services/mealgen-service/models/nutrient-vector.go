@@ -0,0 +1,210 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Nutrient indexes a NutrientVector
+type Nutrient int
+
+const (
+	NutrientCalories Nutrient = iota
+	NutrientProtein
+	NutrientCarbohydrate
+	NutrientFat
+	NutrientSugar
+	NutrientFiber
+	NutrientSaturatedFat
+	NutrientMonounsaturatedFat
+	NutrientPolyunsaturatedFat
+	NutrientCholesterol
+	NutrientSodium
+	NutrientPotassium
+	NutrientCalcium
+	NutrientIron
+	NutrientVitaminA
+	NutrientVitaminB
+	NutrientVitaminC
+	NutrientVitaminD
+	nutrientCount
+)
+
+// Names match the Serving JSON fields
+var nutrientNames = [nutrientCount]string{
+	"calories", "protein", "carbohydrate", "fat", "sugar", "fiber",
+	"saturated_fat", "monounsaturated_fat", "polyunsaturated_fat", "cholesterol",
+	"sodium", "potassium", "calcium", "iron",
+	"vitamin_a", "vitamin_b", "vitamin_c", "vitamin_d",
+}
+
+var nutrientUnits = [nutrientCount]string{
+	"kcal", "g", "g", "g", "g", "g",
+	"g", "g", "g", "mg",
+	"mg", "mg", "mg", "mg",
+	"", "", "", "",
+}
+
+func (n Nutrient) String() string { return nutrientNames[n] }
+
+// Unit is the unit the food data reports the nutrient in; empty for vitamins, whose
+// units vary by source
+func (n Nutrient) Unit() string { return nutrientUnits[n] }
+
+// NutrientByName looks a nutrient up by its Serving JSON name
+func NutrientByName(name string) (Nutrient, bool) {
+	for i, n := range nutrientNames {
+		if n == name {
+			return Nutrient(i), true
+		}
+	}
+	return 0, false
+}
+
+// NutrientVector is the typed form of a serving's nutrients. A nutrient the source did
+// not report is unknown rather than zero. For sums, a nutrient is known if any food
+// reported it and partial if some foods did not.
+type NutrientVector struct {
+	values  [nutrientCount]float64
+	known   [nutrientCount]bool
+	partial [nutrientCount]bool
+	foods   int // Servings summed into the vector
+}
+
+// Get returns the amount and whether it is known
+func (v NutrientVector) Get(n Nutrient) (float64, bool) {
+	return v.values[n], v.known[n]
+}
+
+// Value returns the amount, or zero when unknown
+func (v NutrientVector) Value(n Nutrient) float64 {
+	return v.values[n]
+}
+
+func (v NutrientVector) Known(n Nutrient) bool {
+	return v.known[n]
+}
+
+// Partial reports whether a summed nutrient is missing from some of the foods
+func (v NutrientVector) Partial(n Nutrient) bool {
+	return v.partial[n]
+}
+
+// Set records a known amount
+func (v *NutrientVector) Set(n Nutrient, amount float64) {
+	v.values[n] = amount
+	v.known[n] = true
+	v.foods = max(v.foods, 1)
+}
+
+// Scale multiplies every known amount by factor
+func (v NutrientVector) Scale(factor float64) NutrientVector {
+	return v.Map(func(x float64) float64 { return x * factor })
+}
+
+// Map applies fn to every known amount
+func (v NutrientVector) Map(fn func(float64) float64) NutrientVector {
+	for i := range v.values {
+		if v.known[i] {
+			v.values[i] = fn(v.values[i])
+		}
+	}
+	return v
+}
+
+// Add sums two vectors, keeping track of nutrients only some foods report
+func (v NutrientVector) Add(o NutrientVector) NutrientVector {
+	if v.foods == 0 {
+		return o
+	}
+	if o.foods == 0 {
+		return v
+	}
+	for i := range v.values {
+		v.values[i] += o.values[i]
+		v.partial[i] = v.partial[i] || o.partial[i] || v.known[i] != o.known[i]
+		v.known[i] = v.known[i] || o.known[i]
+	}
+	v.foods += o.foods
+	return v
+}
+
+// Macros returns the calorie and macro amounts, with unknowns as zero
+func (v NutrientVector) Macros() MacroTarget {
+	return MacroTarget{
+		Calories: v.values[NutrientCalories],
+		Proteins: v.values[NutrientProtein],
+		Carbs:    v.values[NutrientCarbohydrate],
+		Fats:     v.values[NutrientFat],
+	}
+}
+
+// Totals converts the vector to its API form, with unknowns as zero
+func (v NutrientVector) Totals() NutrientTotals {
+	return NutrientTotals{
+		Calories:           v.values[NutrientCalories],
+		Protein:            v.values[NutrientProtein],
+		Carbohydrate:       v.values[NutrientCarbohydrate],
+		Fat:                v.values[NutrientFat],
+		Sugar:              v.values[NutrientSugar],
+		Fiber:              v.values[NutrientFiber],
+		SaturatedFat:       v.values[NutrientSaturatedFat],
+		MonounsaturatedFat: v.values[NutrientMonounsaturatedFat],
+		PolyunsaturatedFat: v.values[NutrientPolyunsaturatedFat],
+		Cholesterol:        v.values[NutrientCholesterol],
+		Sodium:             v.values[NutrientSodium],
+		Potassium:          v.values[NutrientPotassium],
+		Calcium:            v.values[NutrientCalcium],
+		Iron:               v.values[NutrientIron],
+		VitaminA:           v.values[NutrientVitaminA],
+		VitaminB:           v.values[NutrientVitaminB],
+		VitaminC:           v.values[NutrientVitaminC],
+		VitaminD:           v.values[NutrientVitaminD],
+	}
+}
+
+// Nutrients returns the serving's typed nutrients. Values that are empty or do not
+// parse are unknown.
+func (s Serving) Nutrients() NutrientVector {
+	if s.nutrients != nil {
+		return *s.nutrients
+	}
+	v := NutrientVector{foods: 1}
+	for i, field := range s.nutrientFields() {
+		if amount, err := strconv.ParseFloat(strings.TrimSpace(*field), 64); err == nil {
+			v.values[i] = amount
+			v.known[i] = true
+		}
+	}
+	return v
+}
+
+// SetNutrients replaces the serving's nutrients. The string fields are rewritten too,
+// with unknown amounts left empty, and the typed amounts are kept at full precision.
+func (s *Serving) SetNutrients(v NutrientVector) {
+	s.SetNutrientFields(v)
+	v.foods = 1
+	s.nutrients = &v
+}
+
+// SetNutrientFields writes the nutrients straight into the string fields. Unknown
+// amounts are left empty, in responses and stored plans alike, so they are never
+// mistaken for a real zero and stay unknown when read back.
+func (s *Serving) SetNutrientFields(v NutrientVector) {
+	s.nutrients = nil
+	for i, field := range s.nutrientFields() {
+		*field = ""
+		if v.known[i] {
+			*field = strconv.FormatFloat(v.values[i], 'f', 3, 64)
+		}
+	}
+}
+
+func (s *Serving) nutrientFields() [nutrientCount]*string {
+	return [nutrientCount]*string{
+		&s.Calories, &s.Protein, &s.Carbohydrate, &s.Fat, &s.Sugar, &s.Fiber,
+		&s.SaturatedFat, &s.MonounsaturatedFat, &s.PolyunsaturatedFat, &s.Cholesterol,
+		&s.Sodium, &s.Potassium, &s.Calcium, &s.Iron,
+		&s.VitaminA, &s.VitaminB, &s.VitaminC, &s.VitaminD,
+	}
+}
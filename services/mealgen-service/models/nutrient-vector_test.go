@@ -0,0 +1,40 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestServingJSONKeepsUnknownNutrientsEmpty(t *testing.T) {
+	var v NutrientVector
+	v.Set(NutrientCalories, 165)
+	v.Set(NutrientProtein, 31)
+	v.Set(NutrientSodium, 0) // A real zero
+	var serving Serving
+	serving.SetNutrients(v)
+
+	data, err := json.Marshal(serving)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire map[string]any
+	if err := json.Unmarshal(data, &wire); err != nil {
+		t.Fatal(err)
+	}
+	for field, want := range map[string]string{"calories": "165.000", "sodium": "0.000", "fiber": "", "vitamin_d": ""} {
+		if wire[field] != want {
+			t.Errorf("%s = %q, want %q", field, wire[field], want)
+		}
+	}
+
+	var decoded Serving
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	got := decoded.Nutrients()
+	for n := NutrientCalories; n <= NutrientVitaminD; n++ {
+		if got.Known(n) != v.Known(n) || got.Value(n) != v.Value(n) {
+			t.Errorf("%s after a round trip = %v (known %v), want %v (known %v)", n, got.Value(n), got.Known(n), v.Value(n), v.Known(n))
+		}
+	}
+}
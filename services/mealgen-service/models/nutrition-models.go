@@ -0,0 +1,56 @@
+package models
+
+// NutrientTotals sums the nutrients of the selected servings. Units follow Serving:
+// kcal, grams for macros, sugar, fibre and fats, mg for cholesterol and minerals.
+type NutrientTotals struct {
+	Calories           float64 `json:"calories"`
+	Protein            float64 `json:"protein"`
+	Carbohydrate       float64 `json:"carbohydrate"`
+	Fat                float64 `json:"fat"`
+	Sugar              float64 `json:"sugar"`
+	Fiber              float64 `json:"fiber"`
+	SaturatedFat       float64 `json:"saturated_fat"`
+	MonounsaturatedFat float64 `json:"monounsaturated_fat"`
+	PolyunsaturatedFat float64 `json:"polyunsaturated_fat"`
+	Cholesterol        float64 `json:"cholesterol"`
+	Sodium             float64 `json:"sodium"`
+	Potassium          float64 `json:"potassium"`
+	Calcium            float64 `json:"calcium"`
+	Iron               float64 `json:"iron"`
+	VitaminA           float64 `json:"vitamin_a"`
+	VitaminB           float64 `json:"vitamin_b"`
+	VitaminC           float64 `json:"vitamin_c"`
+	VitaminD           float64 `json:"vitamin_d"`
+}
+
+// Intake comparison statuses
+const (
+	IntakeShortfall = "shortfall"
+	IntakeOK        = "ok"
+	IntakeExcess    = "excess"
+	IntakeUnknown   = "unknown" // No food reported the nutrient
+)
+
+// IntakeComparison compares one nutrient with its reference intake
+type IntakeComparison struct {
+	Nutrient        string  `json:"nutrient"`
+	Unit            string  `json:"unit"`
+	Amount          float64 `json:"amount"`
+	Target          float64 `json:"target"`          // RDA or adequate intake
+	Upper           float64 `json:"upper,omitempty"` // Tolerable upper intake, when one exists
+	PercentOfTarget float64 `json:"percent_of_target"`
+	Status          string  `json:"status"`               // shortfall, ok, excess or unknown
+	Incomplete      bool    `json:"incomplete,omitempty"` // Some foods did not report the nutrient
+}
+
+// PlanNutrition summarises the nutrients of a whole plan. Intake compares the daily
+// average with the reference intakes for the user's age, gender and life stage.
+type PlanNutrition struct {
+	Days           int                `json:"days"`
+	Totals         NutrientTotals     `json:"totals"`
+	DailyAverage   NutrientTotals     `json:"daily_average"`
+	ReferenceGroup string             `json:"reference_group"` // e.g. "female 19-50, pregnancy"
+	Intake         []IntakeComparison `json:"intake"`
+	Shortfalls     []string           `json:"shortfalls,omitempty"`
+	Excesses       []string           `json:"excesses,omitempty"`
+}
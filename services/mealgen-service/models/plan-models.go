@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// Stored plan models
+type StoredPlan struct {
+	ID        string              `json:"id"`
+	UserID    string              `json:"user_id,omitempty"`
+	Request   RequestBody         `json:"request"`
+	Plan      MealPlanAPIResponse `json:"plan"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+type StoredPlanSummary struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id,omitempty"`
+	Days      int       `json:"days"`
+	Dates     []string  `json:"dates"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type StoredPlanResponse struct {
+	Success bool        `json:"success"`
+	Data    *StoredPlan `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+type UserPlansResponse struct {
+	Success bool                `json:"success"`
+	Data    []StoredPlanSummary `json:"data"`
+	Limit   int                 `json:"limit"`
+	Offset  int                 `json:"offset"`
+	Message string              `json:"message,omitempty"`
+}
+
+// PlanMealRegenerationRequest regenerates one meal of a stored plan. Diet, allergies and
+// likes come from the stored request, so only the meal and the style are needed.
+type PlanMealRegenerationRequest struct {
+	Day               string   `json:"day"`        // Key of the day in the plan's "data"
+	MealIndex         int      `json:"meal_index"` // Position of the meal within the day
+	FoodsToRegenerate []string `json:"food_to_regenerate,omitempty"`
+	MealStyle         string   `json:"meal_style_option,omitempty"`
+	FoodsToAvoid      []string `json:"foods_to_avoid,omitempty"` // Added to the stored allergies
+}
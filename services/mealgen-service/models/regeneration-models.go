@@ -8,15 +8,17 @@ type RegenerationRequest struct {
 	FoodsToAvoid      []string     `json:"foods_to_avoid"`
 	FoodsToLike       []string     `json:"foods_to_like"`
 	OriginalMeal      OriginalMeal `json:"meal"` // Changed from "original_meal" to "meal"
+	Cuisines          []Cuisine    `json:"cuisines,omitempty"`
+	KitchenTools      []string     `json:"kitchen_tools,omitempty"`
+	HealthConditions  []string     `json:"health_conditions,omitempty"`
+	LifePhases        []string     `json:"life_phases,omitempty"`
+	PinnedFoods       []PinnedFood `json:"pinned_foods,omitempty"` // Without a meal name they go in the regenerated meal
 
 	// Additional fields that may be present but not used in regeneration
-	TreatMeals   interface{} `json:"treat_meals,omitempty"`
-	SocialMeals  interface{} `json:"social_meals,omitempty"`
-	IsDrinks     bool        `json:"is_drinks,omitempty"`
-	DrinkEntries interface{} `json:"drink_entries,omitempty"`
-	Cuisines     []string    `json:"cuisines,omitempty"`
-	KitchenTools []string    `json:"kitchen_tools,omitempty"`
-	LifePhases   []string    `json:"life_phases,omitempty"`
+	TreatMeals   *MealOption  `json:"treat_meals,omitempty"`
+	SocialMeals  *MealOption  `json:"social_meals,omitempty"`
+	IsDrinks     bool         `json:"is_drinks,omitempty"`
+	DrinkEntries []DrinkEntry `json:"drink_entries,omitempty"`
 }
 
 type OriginalMeal struct {
@@ -30,32 +32,48 @@ type OriginalMeal struct {
 
 // Regeneration response models
 type RegenerationResponse struct {
-	Success        bool                    `json:"success"`
-	Data           RegenerationMealData    `json:"data"`
-	Message        string                  `json:"message,omitempty"`
-	Timing         *TimingInfo             `json:"timing,omitempty"`
-	Prepare        []PrepareCookSection    `json:"prepare,omitempty"`
-	Cook           []PrepareCookSection    `json:"cook,omitempty"`
-	WeightAssemble []WeightAssembleSection `json:"weight_assemble,omitempty"`
+	Success           bool                    `json:"success"`
+	PlanID            string                  `json:"plan_id,omitempty"` // Set when a stored plan was updated
+	Data              RegenerationMealData    `json:"data"`
+	Message           string                  `json:"message,omitempty"`
+	Fallback          bool                    `json:"fallback,omitempty"`
+	ValidationErrors  []string                `json:"validation_errors,omitempty"`
+	Substitutions     []Substitution          `json:"substitutions,omitempty"`
+	Unresolved        []UnresolvedFood        `json:"unresolved,omitempty"`
+	EquipmentWarnings []EquipmentWarning      `json:"equipment_warnings,omitempty"`
+	Health            *HealthRulesApplied     `json:"health,omitempty"`
+	Timing            *TimingInfo             `json:"timing,omitempty"`
+	Prepare           []PrepareCookSection    `json:"prepare,omitempty"`
+	Cook              []PrepareCookSection    `json:"cook,omitempty"`
+	WeightAssemble    []WeightAssembleSection `json:"weight_assemble,omitempty"`
 }
 
 type RegenerationMealData struct {
-	MealName    string      `json:"meal_name"`
-	MealTime    string      `json:"meal_time"`
-	Meridiem    string      `json:"meridiem"`
-	MacroTarget MacroTarget `json:"macro_target"`
-	Macros      MacroTarget `json:"macros"`
-	Foods       []Food      `json:"foods"`
+	MealName    string       `json:"meal_name"`
+	MealTime    string       `json:"meal_time"`
+	Meridiem    string       `json:"meridiem"`
+	MacroTarget MacroTarget  `json:"macro_target"`
+	Macros      MacroTarget  `json:"macros"`
+	Residual    *MacroTarget `json:"residual,omitempty"` // Macros minus MacroTarget after portion solving
+	Foods       []Food       `json:"foods"`
+
+	Incomplete       bool              `json:"incomplete,omitempty"`    // Some foods could not be resolved and are missing
+	MissingFoods     []string          `json:"missing_foods,omitempty"` // The foods left out
+	HealthViolations []HealthViolation `json:"health_violations,omitempty"`
+	Nutrients        *NutrientTotals   `json:"nutrients,omitempty"`
 }
 
 // Internal LLM response models for regeneration
 type RegenerationLLMResponse struct {
-	Success        bool                    `json:"success"`
-	Message        string                  `json:"message"`
-	Data           RegenerationLLMData     `json:"data"`
-	Prepare        []PrepareCookSection    `json:"prepare,omitempty"`
-	Cook           []PrepareCookSection    `json:"cook,omitempty"`
-	WeightAssemble []WeightAssembleSection `json:"weight_assemble,omitempty"`
+	Success           bool                    `json:"success"`
+	Message           string                  `json:"message"`
+	Data              RegenerationLLMData     `json:"data"`
+	Fallback          bool                    `json:"fallback,omitempty" llm:"-"`
+	ValidationErrors  []string                `json:"validation_errors,omitempty" llm:"-"`
+	EquipmentWarnings []EquipmentWarning      `json:"equipment_warnings,omitempty" llm:"-"`
+	Prepare           []PrepareCookSection    `json:"prepare,omitempty"`
+	Cook              []PrepareCookSection    `json:"cook,omitempty"`
+	WeightAssemble    []WeightAssembleSection `json:"weight_assemble,omitempty"`
 }
 
 type RegenerationLLMData struct {
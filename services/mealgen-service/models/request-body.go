@@ -1,7 +1,10 @@
 package models
 
+import "encoding/json"
+
 type RequestBody struct {
 	// User Profile
+	UserID string `json:"user_id,omitempty"` // Owner of the stored plan
 	Name   string `json:"name"`
 	Age    int    `json:"age"`
 	Gender string `json:"gender"`
@@ -9,6 +12,9 @@ type RequestBody struct {
 	Height int    `json:"height"`
 	Goal   string `json:"goal"`
 
+	// Optional; when set, BMR uses Katch-McArdle instead of Mifflin-St Jeor
+	BodyFatPercentage float64 `json:"body_fat_percentage,omitempty"`
+
 	// Daily Macro Goals
 	DailyProtiensGoal float64 `json:"DailyProtiensGoal"`
 	DailyCarbsGoal    float64 `json:"DailyCarbsGoal"`
@@ -39,6 +45,23 @@ type RequestBody struct {
 	// Optional fields for backward compatibility
 	Dates         []string `json:"dates,omitempty"`
 	NumberOfMeals int      `json:"number_of_meals,omitempty"`
+
+	// Opt-in: attach a consolidated grocery list to the plan response
+	IncludeGroceryList bool `json:"include_grocery_list,omitempty"`
+
+	// Planned treats, restaurant meals and drinks; their estimated macros are reserved
+	// from the day's budget
+	TreatMeals   *MealOption  `json:"treat_meals,omitempty"`
+	SocialMeals  *MealOption  `json:"social_meals,omitempty"`
+	IsDrinks     bool         `json:"is_drinks,omitempty"`
+	DrinkEntries []DrinkEntry `json:"drink_entries,omitempty"`
+
+	// Weighted cuisine preferences and the kitchen equipment available
+	Cuisines     []Cuisine `json:"cuisines,omitempty"`
+	KitchenTools []string  `json:"kitchen_tools,omitempty"`
+
+	// Branded products the user owns, placed in meals by barcode
+	PinnedFoods []PinnedFood `json:"pinned_foods,omitempty"`
 }
 
 type Meal struct {
@@ -63,9 +86,67 @@ type DrinkEntry struct {
 	NumberOfDrinks string `json:"number_of_drinks"`
 }
 
+// ReservedMeal marks a placeholder meal whose budget is held for a treat, a social meal
+// or drinks instead of being planned
+type ReservedMeal struct {
+	Kind      string      `json:"kind"`                // treat, social or drinks
+	Replaces  string      `json:"replaces,omitempty"`  // Planned meal the slot takes the place of
+	WithMeal  string      `json:"with_meal,omitempty"` // Meal the drinks accompany
+	Drinks    int         `json:"drinks,omitempty"`
+	Estimated MacroTarget `json:"estimated"`
+}
+
+// PinnedFood places a branded product, looked up by barcode, in a meal with its label
+// nutrition. The rest of the meal is fitted around it.
+type PinnedFood struct {
+	Barcode  string  `json:"barcode"`
+	Date     string  `json:"date,omitempty"`      // Empty pins it on every day
+	MealName string  `json:"meal_name,omitempty"` // Meal it goes in; required for plans
+	Servings float64 `json:"servings,omitempty"`  // Label servings, default 1
+	Food     *Food   `json:"food,omitempty"`      // Set by the service once the barcode is resolved
+}
+
 type Cuisine struct {
 	Name       string `json:"name"`
-	Preference string `json:"preference"`
+	Preference string `json:"preference"` // love, like, neutral, dislike or a 0-5 weight
+}
+
+// UnmarshalJSON also accepts a bare cuisine name, as older clients send
+func (c *Cuisine) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = Cuisine{Name: name}
+		return nil
+	}
+	type cuisine Cuisine
+	return json.Unmarshal(data, (*cuisine)(c))
+}
+
+// HealthViolation reports a meal or day that breaks a health-condition or life-stage
+// rule. Limit and Actual are in the nutrient's unit, or fractions for share limits.
+type HealthViolation struct {
+	Rule     string  `json:"rule"`
+	Nutrient string  `json:"nutrient,omitempty"`
+	Food     string  `json:"food,omitempty"` // Set for banned foods
+	Limit    float64 `json:"limit,omitempty"`
+	Actual   float64 `json:"actual,omitempty"`
+	Message  string  `json:"message"`
+}
+
+// HealthRulesApplied names the health-condition and life-stage rules a response was
+// checked against. Their nutrient limits are advisory; portions are not solved to them.
+type HealthRulesApplied struct {
+	Rules    []string `json:"rules"`
+	Advisory bool     `json:"advisory"`
+	Note     string   `json:"note"`
+}
+
+// EquipmentWarning flags a prepare or cook step that needs equipment the user lacks
+type EquipmentWarning struct {
+	Section string   `json:"section"` // prepare or cook
+	Title   string   `json:"title"`
+	Step    string   `json:"step"`
+	Missing []string `json:"missing"`
 }
 
 type MacroTarget struct {
@@ -77,12 +158,15 @@ type MacroTarget struct {
 
 // Response models
 type MealPlanLLMResponse struct {
-	Success        bool                    `json:"success"`
-	Data           map[string]DayLLMMeals  `json:"data"`
-	Message        string                  `json:"message,omitempty"`
-	Prepare        []PrepareCookSection    `json:"prepare,omitempty"`
-	Cook           []PrepareCookSection    `json:"cook,omitempty"`
-	WeightAssemble []WeightAssembleSection `json:"weight_assemble,omitempty"`
+	Success           bool                    `json:"success"`
+	Data              map[string]DayLLMMeals  `json:"data"`
+	Message           string                  `json:"message,omitempty"`
+	Fallback          bool                    `json:"fallback,omitempty" llm:"-"`          // Default meals used because output stayed invalid
+	ValidationErrors  []string                `json:"validation_errors,omitempty" llm:"-"` // Schema problems left after repair attempts
+	EquipmentWarnings []EquipmentWarning      `json:"equipment_warnings,omitempty" llm:"-"`
+	Prepare           []PrepareCookSection    `json:"prepare,omitempty"`
+	Cook              []PrepareCookSection    `json:"cook,omitempty"`
+	WeightAssemble    []WeightAssembleSection `json:"weight_assemble,omitempty"`
 }
 
 type DayLLMMeals struct {
@@ -94,7 +178,8 @@ type MealLLMItems struct {
 	MealName       string                  `json:"meal_name"`
 	MealTime       string                  `json:"meal_time"`
 	Meridiem       string                  `json:"meridiem"`
-	MacroTarget    MacroTarget             `json:"macro_target"`
+	MacroTarget    MacroTarget             `json:"macro_target" llm:"-"` // Set by the service from the daily goals
+	Reserved       *ReservedMeal           `json:"reserved,omitempty" llm:"-"`
 	Foods          []FoodWithPortion       `json:"foods"`
 	Prepare        []PrepareCookSection    `json:"prepare,omitempty"`
 	Cook           []PrepareCookSection    `json:"cook,omitempty"`
@@ -107,13 +192,57 @@ type FoodWithPortion struct {
 }
 
 type MealPlanAPIResponse struct {
-	Success        bool                    `json:"success"`
-	Data           map[string]DayAPIMeals  `json:"data"`
-	Message        string                  `json:"message,omitempty"`
-	Timing         *TimingInfo             `json:"timing,omitempty"`
-	Prepare        []PrepareCookSection    `json:"prepare,omitempty"`
-	Cook           []PrepareCookSection    `json:"cook,omitempty"`
-	WeightAssemble []WeightAssembleSection `json:"weight_assemble,omitempty"`
+	Success           bool                    `json:"success"`
+	PlanID            string                  `json:"plan_id,omitempty"` // Set when the plan was stored
+	Data              map[string]DayAPIMeals  `json:"data"`
+	Message           string                  `json:"message,omitempty"`
+	Fallback          bool                    `json:"fallback,omitempty"`
+	ValidationErrors  []string                `json:"validation_errors,omitempty"`
+	Substitutions     []Substitution          `json:"substitutions,omitempty"`
+	Unresolved        []UnresolvedFood        `json:"unresolved,omitempty"`
+	EquipmentWarnings []EquipmentWarning      `json:"equipment_warnings,omitempty"`
+	Health            *HealthRulesApplied     `json:"health,omitempty"`
+	Targets           *DailyTargets           `json:"targets,omitempty"`
+	Nutrition         *PlanNutrition          `json:"nutrition,omitempty"`
+	GroceryList       *GroceryList            `json:"grocery_list,omitempty"`
+	Timing            *TimingInfo             `json:"timing,omitempty"`
+	Prepare           []PrepareCookSection    `json:"prepare,omitempty"`
+	Cook              []PrepareCookSection    `json:"cook,omitempty"`
+	WeightAssemble    []WeightAssembleSection `json:"weight_assemble,omitempty"`
+}
+
+// DailyTargets are the daily goals a plan was built against and how any missing ones
+// were derived
+type DailyTargets struct {
+	Calories        float64  `json:"calories"`
+	Proteins        float64  `json:"proteins"`
+	Carbs           float64  `json:"carbs"`
+	Fats            float64  `json:"fats"`
+	BMR             float64  `json:"bmr,omitempty"`
+	TDEE            float64  `json:"tdee,omitempty"`
+	Formula         string   `json:"formula,omitempty"` // mifflin-st-jeor, katch-mcardle or default
+	ActivityFactor  float64  `json:"activity_factor,omitempty"`
+	GoalAdjustment  float64  `json:"goal_adjustment,omitempty"` // kcal added to TDEE, negative for a deficit
+	MacroPreference string   `json:"macro_preference"`
+	Computed        []string `json:"computed,omitempty"` // Goals filled in rather than supplied
+}
+
+// Substitution records a food that was replaced because it broke the user's diet or allergies
+type Substitution struct {
+	Date        string   `json:"date,omitempty"`
+	MealName    string   `json:"meal_name"`
+	Original    string   `json:"original"`
+	Replacement string   `json:"replacement,omitempty"` // Empty when the food was removed
+	Reasons     []string `json:"reasons"`
+}
+
+// UnresolvedFood records a meal food that no food provider could find, so it is
+// missing from the meal
+type UnresolvedFood struct {
+	Date     string `json:"date,omitempty"`
+	MealName string `json:"meal_name"`
+	Food     string `json:"food"`
+	Reason   string `json:"reason"`
 }
 
 // TimingInfo contains timing information for different steps
@@ -123,23 +252,34 @@ type TimingInfo struct {
 	FoodFetchingTime    string `json:"food_fetching_time"`
 	ServingOptimization string `json:"serving_optimization_time"`
 	ResponseBuildTime   string `json:"response_build_time"`
+	CacheHits           int    `json:"cache_hits"`
+	CacheMisses         int    `json:"cache_misses"`
 }
 
 type DayAPIMeals struct {
-	Date  string         `json:"date"`
-	Meals []MealAPIItems `json:"meals"`
+	Date             string             `json:"date"`
+	Meals            []MealAPIItems     `json:"meals"`
+	HealthViolations []HealthViolation  `json:"health_violations,omitempty"` // Daily limits broken
+	Nutrients        *NutrientTotals    `json:"nutrients,omitempty"`
+	Intake           []IntakeComparison `json:"intake,omitempty"` // Day totals against reference intakes
 }
 
 type MealAPIItems struct {
-	MealName       string                  `json:"meal_name"`
-	MealTime       string                  `json:"meal_time"`
-	Meridiem       string                  `json:"meridiem"`
-	MacroTarget    MacroTarget             `json:"macro_target"`
-	Macros         MacroTarget             `json:"macros"`
-	Foods          []Food                  `json:"foods"`
-	Prepare        []PrepareCookSection    `json:"prepare,omitempty"`
-	Cook           []PrepareCookSection    `json:"cook,omitempty"`
-	WeightAssemble []WeightAssembleSection `json:"weight_assemble,omitempty"`
+	MealName         string                  `json:"meal_name"`
+	MealTime         string                  `json:"meal_time"`
+	Meridiem         string                  `json:"meridiem"`
+	MacroTarget      MacroTarget             `json:"macro_target"`
+	Macros           MacroTarget             `json:"macros"`
+	Residual         *MacroTarget            `json:"residual,omitempty"`      // Macros minus MacroTarget after portion solving
+	Reserved         *ReservedMeal           `json:"reserved,omitempty"`      // Set on placeholder meals
+	Incomplete       bool                    `json:"incomplete,omitempty"`    // Some foods could not be resolved and are missing
+	MissingFoods     []string                `json:"missing_foods,omitempty"` // The foods left out
+	HealthViolations []HealthViolation       `json:"health_violations,omitempty"`
+	Nutrients        *NutrientTotals         `json:"nutrients,omitempty"`
+	Foods            []Food                  `json:"foods"`
+	Prepare          []PrepareCookSection    `json:"prepare,omitempty"`
+	Cook             []PrepareCookSection    `json:"cook,omitempty"`
+	WeightAssemble   []WeightAssembleSection `json:"weight_assemble,omitempty"`
 }
 
 // Meal Preferences Models for serving selection
@@ -179,21 +319,45 @@ type ServingSelectionRequest struct {
 }
 
 type ServingSelectionResponse struct {
-	Success bool                          `json:"success"`
-	Data    map[string]MealServingChoices `json:"data"`
-	Message string                        `json:"message,omitempty"`
+	Success  bool                          `json:"success"`
+	Data     map[string]MealServingChoices `json:"data"`
+	Message  string                        `json:"message,omitempty"`
+	Fallback bool                          `json:"fallback,omitempty"` // First servings used because the LLM output was unusable
 }
 
 type MealServingChoices struct {
-	MealName string              `json:"meal_name"`
-	MealTime string              `json:"meal_time"`
-	Meridiem string              `json:"meridiem"`
-	Foods    []FoodServingChoice `json:"foods"`
+	MealName    string              `json:"meal_name"`
+	MealTime    string              `json:"meal_time"`
+	Meridiem    string              `json:"meridiem"`
+	MacroTarget MacroTarget         `json:"macro_target"`
+	Macros      MacroTarget         `json:"macros"` // Totals after applying every adjustment
+	Foods       []FoodServingChoice `json:"foods"`
 }
 
 type FoodServingChoice struct {
 	FoodID               string  `json:"food_id"`
 	FoodName             string  `json:"food_name"`
+	ServingID            string  `json:"serving_id"`
+	PercentageAdjustment float64 `json:"percentage_adjustment"` // Percent change from one listed serving, e.g. 20 = 1.2x
+	SelectedServing      Serving `json:"selected_serving"`      // Chosen serving with the adjustment applied
+}
+
+// Internal LLM response models for serving selection
+type ServingSelectionLLMResponse struct {
+	Meals    []ServingSelectionLLMMeal `json:"meals"`
+	Fallback bool                      `json:"fallback,omitempty" llm:"-"`
+}
+
+type ServingSelectionLLMMeal struct {
+	MealIndex int                       `json:"meal_index"` // 1-based position of the meal in the request
+	MealName  string                    `json:"meal_name"`
+	Foods     []ServingSelectionLLMFood `json:"foods"`
+}
+
+type ServingSelectionLLMFood struct {
+	FoodIndex            int     `json:"food_index"` // 1-based position of the food in its meal
+	FoodID               string  `json:"food_id"`
+	ServingID            string  `json:"serving_id"`
 	PercentageAdjustment float64 `json:"percentage_adjustment"`
 }
 
@@ -209,3 +373,35 @@ type WeightAssembleSection struct {
 	Subtitle string   `json:"subtitle"`
 	Steps    []string `json:"steps"`
 }
+
+// Grocery list models
+type GroceryListRequest struct {
+	Data map[string]DayAPIMeals `json:"data"` // The "data" of a generated plan response
+}
+
+type GroceryListResponse struct {
+	Success bool        `json:"success"`
+	Data    GroceryList `json:"data"`
+	Message string      `json:"message,omitempty"`
+}
+
+type GroceryList struct {
+	Days      int            `json:"days"`
+	ItemCount int            `json:"item_count"`
+	Aisles    []GroceryAisle `json:"aisles"`
+}
+
+type GroceryAisle struct {
+	Name  string        `json:"name"`
+	Items []GroceryItem `json:"items"`
+}
+
+type GroceryItem struct {
+	Name           string   `json:"name"`
+	Aisle          string   `json:"aisle"`
+	PurchaseAmount float64  `json:"purchase_amount"`         // Raw weight to buy
+	CookedAmount   float64  `json:"cooked_amount,omitempty"` // Weight as eaten, when converted from cooked
+	Unit           string   `json:"unit"`
+	Occurrences    int      `json:"occurrences"` // Number of meal slots using the food
+	FoodIDs        []string `json:"food_ids,omitempty"`
+}
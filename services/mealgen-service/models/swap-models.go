@@ -0,0 +1,44 @@
+package models
+
+// Food swap request models
+type SwapRequest struct {
+	Food             Food     `json:"food"` // The resolved food to replace, with its selected serving first
+	DietType         string   `json:"diet_type"`
+	FoodsToAvoid     []string `json:"foods_to_avoid"`
+	HealthConditions []string `json:"health_conditions,omitempty"`
+	LifePhases       []string `json:"life_phases,omitempty"`
+	Exclude          []string `json:"exclude,omitempty"` // Foods not to suggest, e.g. the rest of the meal
+	Limit            int      `json:"limit,omitempty"`
+}
+
+type SwapResponse struct {
+	Success bool       `json:"success"`
+	Data    SwapResult `json:"data"`
+	Message string     `json:"message,omitempty"`
+}
+
+type SwapResult struct {
+	Original    string      `json:"original"`
+	Category    string      `json:"category"`
+	Macros      MacroTarget `json:"macros"` // The macros every substitute is scaled to
+	Substitutes []FoodSwap  `json:"substitutes"`
+}
+
+// FoodSwap is one substitute, scaled to the original's macros. Lower distances are
+// closer macro profiles per 100 g.
+type FoodSwap struct {
+	Food     Food        `json:"food"`
+	Distance float64     `json:"distance"`
+	Macros   MacroTarget `json:"macros"`
+	Residual MacroTarget `json:"residual"` // Macros minus the original's
+}
+
+// Food replacement LLM models, used for foods no food provider could find
+type FoodReplacementLLMResponse struct {
+	Replacements []FoodReplacementLLMItem `json:"replacements"`
+}
+
+type FoodReplacementLLMItem struct {
+	Original    string `json:"original"`
+	Replacement string `json:"replacement"`
+}
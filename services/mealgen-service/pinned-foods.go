@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+// errInvalidPin marks a pinned food the request got wrong, as opposed to a failed lookup
+var errInvalidPin = errors.New("invalid pinned food")
+
+// resolvePinnedFoods looks up each pin's barcode and stores the product on the pin,
+// with its label serving times the requested servings selected. A pin without a meal
+// name gets defaultMeal, or is rejected when there is none.
+func resolvePinnedFoods(ctx context.Context, pins []models.PinnedFood, defaultMeal string) error {
+	for i := range pins {
+		pin := &pins[i]
+
+		code, ok := services.NormalizeBarcode(pin.Barcode)
+		if !ok {
+			return fmt.Errorf("%w: %q is not a barcode", errInvalidPin, pin.Barcode)
+		}
+		if strings.TrimSpace(pin.MealName) == "" {
+			if defaultMeal == "" {
+				return fmt.Errorf("%w: barcode %s needs a meal_name", errInvalidPin, code)
+			}
+			pin.MealName = defaultMeal
+		}
+		if pin.Servings < 0 {
+			return fmt.Errorf("%w: barcode %s has negative servings", errInvalidPin, code)
+		}
+		if pin.Servings == 0 {
+			pin.Servings = 1
+		}
+
+		result, err := foodProvider.SearchFoodByBarcode(ctx, code, 0, 1)
+		if err != nil {
+			return fmt.Errorf("failed to look up barcode %s: %w", code, err)
+		}
+		if len(result.Foods) == 0 {
+			return fmt.Errorf("%w: no product found for barcode %s", errInvalidPin, code)
+		}
+		food, ok := pinnedFood(result.Foods[0], pin.Servings)
+		if !ok {
+			return fmt.Errorf("%w: product %s for barcode %s has no label nutrition", errInvalidPin, result.Foods[0].FoodName, code)
+		}
+
+		pin.Barcode = code
+		pin.Food = &food
+		log.Printf("📌 Pinned %s (%s) to %s", food.FoodName, code, pin.MealName)
+	}
+	return nil
+}
+
+// writePinError answers a request whose pinned foods could not be resolved
+func writePinError(w http.ResponseWriter, ctx context.Context, err error) {
+	if errors.Is(err, errInvalidPin) {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	writePipelineError(w, ctx, err, "Failed to resolve pinned foods")
+}
+
+// pinnedFood selects the product's label serving, scaled to the number of servings,
+// and marks the food so the portion solver leaves it alone
+func pinnedFood(product models.Food, servings float64) (models.Food, bool) {
+	label, ok := services.LabelServing(product)
+	if !ok || !label.Nutrients().Known(models.NutrientCalories) {
+		return product, false
+	}
+
+	selected := scaleServing(label, servings)
+	if units := parseFloatDefault(label.NumberOfUnits); units > 0 {
+		selected.NumberOfUnits = strconv.FormatFloat(units*servings, 'f', 3, 64)
+	}
+	selected = ensureServingFields(selected, product.Servings)
+
+	// The label serving goes first, as the selected one
+	ordered := []models.Serving{selected}
+	for _, serving := range product.Servings {
+		if serving.ServingID != label.ServingID {
+			ordered = append(ordered, serving)
+		}
+	}
+	product.Servings = ordered
+	product.Pinned = true
+	product.Category = foodClasses.Classify(product).Class
+	return product, true
+}
+
+// pinnedMealFoods returns copies of the pinned products for one meal
+func pinnedMealFoods(pins []models.PinnedFood, date, mealName string) []models.Food {
+	matched := services.PinnedFoodsFor(pins, date, mealName)
+	foods := make([]models.Food, 0, len(matched))
+	for _, pin := range matched {
+		food := *pin.Food
+		food.Servings = append([]models.Serving(nil), food.Servings...)
+		foods = append(foods, food)
+	}
+	return foods
+}
+
+// fitMealPortions solves and rounds the meal's portions. Pinned foods keep their label
+// amounts and the other foods are fitted to what is left of the target. It returns the
+// pinned foods first, then the others, and the residual against the whole target.
+func fitMealPortions(foods []models.Food, target models.MacroTarget) ([]models.Food, models.MacroTarget) {
+	var pinned, free []models.Food
+	for _, food := range foods {
+		if food.Pinned {
+			pinned = append(pinned, food)
+		} else {
+			free = append(free, food)
+		}
+	}
+
+	remaining := target
+	if len(pinned) > 0 {
+		used := calculateMealMacros(pinned)
+		remaining = models.MacroTarget{
+			Calories: math.Max(target.Calories-used.Calories, 0),
+			Proteins: math.Max(target.Proteins-used.Proteins, 0),
+			Carbs:    math.Max(target.Carbs-used.Carbs, 0),
+			Fats:     math.Max(target.Fats-used.Fats, 0),
+		}
+		// When the pinned products use up the calories, the rest shrinks to its minimums
+		// rather than being left at the LLM's portions
+		if target.Calories > 0 {
+			remaining.Calories = math.Max(remaining.Calories, 1)
+		}
+	}
+
+	free, _ = solvePortions(free, remaining)
+	free, _ = roundPortions(free, remaining)
+
+	fitted := append(pinned, free...)
+	return fitted, macroResidual(calculateMealMacros(fitted), target)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+// savePlan stores a generated plan and sets its ID on the response. Storage failures
+// are logged rather than failing a plan the user already paid the latency for.
+func savePlan(ctx context.Context, reqBody models.RequestBody, result *models.MealPlanAPIResponse) {
+	if planStore == nil || len(result.Data) == 0 {
+		return
+	}
+
+	stored := &models.StoredPlan{UserID: reqBody.UserID, Request: reqBody, Plan: *result}
+	if err := planStore.SavePlan(context.WithoutCancel(ctx), stored); err != nil {
+		log.Printf("❌ Failed to store plan: %v", err)
+		return
+	}
+
+	result.PlanID = stored.ID
+	log.Printf("💾 Stored plan %s for user %q", stored.ID, stored.UserID)
+}
+
+func planHandler(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if planStore == nil {
+		http.Error(w, "Plan storage is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	plan, err := planStore.GetPlan(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writePlanStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.StoredPlanResponse{Success: true, Data: plan})
+}
+
+func userPlansHandler(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if planStore == nil {
+		http.Error(w, "Plan storage is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	limit = services.ClampPlanListLimit(limit)
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	plans, err := planStore.ListUserPlans(r.Context(), r.PathValue("id"), limit, offset)
+	if err != nil {
+		writePlanStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.UserPlansResponse{
+		Success: true,
+		Data:    plans,
+		Limit:   limit,
+		Offset:  offset,
+	})
+}
+
+// planRegenerationHandler regenerates one meal of a stored plan and saves the result
+// back into the plan
+func planRegenerationHandler(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if planStore == nil {
+		http.Error(w, "Plan storage is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	var body models.PlanMealRegenerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	plan, err := planStore.GetPlan(ctx, r.PathValue("id"))
+	if err != nil {
+		writePlanStoreError(w, err)
+		return
+	}
+
+	day, ok := plan.Plan.Data[body.Day]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid request: plan has no day %q", body.Day), http.StatusBadRequest)
+		return
+	}
+	if body.MealIndex < 0 || body.MealIndex >= len(day.Meals) {
+		http.Error(w, fmt.Sprintf("Invalid request: day %q has %d meals", body.Day, len(day.Meals)), http.StatusBadRequest)
+		return
+	}
+
+	meal := day.Meals[body.MealIndex]
+	if meal.Reserved != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %s is reserved for a %s and has no foods to regenerate", meal.MealName, meal.Reserved.Kind), http.StatusBadRequest)
+		return
+	}
+	reqBody := models.RegenerationRequest{
+		FoodsToRegenerate: body.FoodsToRegenerate,
+		MealStyle:         body.MealStyle,
+		DietType:          plan.Request.DietType,
+		FoodsToAvoid:      append(append([]string(nil), plan.Request.FoodAllergies...), body.FoodsToAvoid...),
+		FoodsToLike:       plan.Request.FoodLikes,
+		Cuisines:          plan.Request.Cuisines,
+		KitchenTools:      plan.Request.KitchenTools,
+		HealthConditions:  plan.Request.SelectedHealthConditions,
+		LifePhases:        plan.Request.SelectedLifeStages,
+		// Pins were resolved when the plan was made
+		PinnedFoods: services.PinnedFoodsFor(plan.Request.PinnedFoods, body.Day, meal.MealName),
+		OriginalMeal: models.OriginalMeal{
+			MealName:    meal.MealName,
+			MealTime:    meal.MealTime,
+			Meridiem:    meal.Meridiem,
+			MacroTarget: meal.MacroTarget,
+			Macros:      meal.Macros,
+			Foods:       meal.Foods,
+		},
+	}
+
+	log.Printf("Plan %s: regenerating %s meal %d (%s)", plan.ID, body.Day, body.MealIndex, meal.MealName)
+
+	response, err := geminiService.RegenerateMeal(ctx, reqBody)
+	if err != nil {
+		log.Printf("Error calling LLM provider for regeneration: %v", err)
+		writePipelineError(w, ctx, err, "Failed to regenerate meal")
+		return
+	}
+
+	result := processRegenerationResponse(ctx, *response, reqBody)
+	if ctx.Err() != nil {
+		writePipelineError(w, ctx, ctx.Err(), "Failed to resolve foods")
+		return
+	}
+
+	// Swap the meal into the stored plan
+	day.Meals[body.MealIndex] = models.MealAPIItems{
+		MealName:    result.Data.MealName,
+		MealTime:    result.Data.MealTime,
+		Meridiem:    result.Data.Meridiem,
+		MacroTarget: result.Data.MacroTarget,
+		Macros:      result.Data.Macros,
+		Residual:    result.Data.Residual,
+		Foods:       result.Data.Foods,
+
+		Incomplete:       result.Data.Incomplete,
+		MissingFoods:     result.Data.MissingFoods,
+		HealthViolations: result.Data.HealthViolations,
+	}
+	// Daily totals changed with the meal
+	healthRules.ProfileFor(reqBody.HealthConditions, reqBody.LifePhases).CheckDay(&day)
+	plan.Plan.Data[body.Day] = day
+	plan.Plan.Nutrition = services.AddNutritionTotals(plan.Plan.Data, referenceIntakesFor(plan.Request))
+	if err := planStore.UpdatePlan(context.WithoutCancel(ctx), plan); err != nil {
+		log.Printf("❌ Failed to update plan %s: %v", plan.ID, err)
+		http.Error(w, "Failed to save regenerated meal", http.StatusInternalServerError)
+		return
+	}
+	result.PlanID = plan.ID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func writePlanStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrPlanNotFound) {
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("❌ Plan store error: %v", err)
+	http.Error(w, "Failed to load plan", http.StatusInternalServerError)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+// streamDayConcurrency caps how many days are generated in parallel while streaming
+const streamDayConcurrency = 3
+
+// SSE event names emitted while streaming a plan. A day's foods are resolved together, so
+// its meal events are sent in one burst once the day is ready, just before its day event.
+const (
+	sseEventMeal  = "meal"
+	sseEventDay   = "day"
+	sseEventError = "error"
+	sseEventDone  = "done"
+)
+
+// streamedDay is the outcome of generating and resolving a single day
+type streamedDay struct {
+	date   string
+	day    models.DayAPIMeals
+	plan   models.MealPlanAPIResponse
+	err    error
+	timing time.Duration
+}
+
+type sseMealPayload struct {
+	Day       string                `json:"day"`
+	Date      string                `json:"date"`
+	MealIndex int                   `json:"meal_index"`
+	Meals     []models.MealAPIItems `json:"meals"`
+}
+
+type sseDayPayload struct {
+	Day           string                    `json:"day"`
+	Date          string                    `json:"date"`
+	Index         int                       `json:"index"`
+	Meals         []models.MealAPIItems     `json:"meals"`
+	Duration      string                    `json:"duration"`
+	Fallback      bool                      `json:"fallback,omitempty"` // Default meals used because the LLM output stayed invalid
+	Substitutions []models.Substitution     `json:"substitutions,omitempty"`
+	Unresolved    []models.UnresolvedFood   `json:"unresolved,omitempty"`
+	Nutrients     *models.NutrientTotals    `json:"nutrients,omitempty"`
+	Intake        []models.IntakeComparison `json:"intake,omitempty"`
+}
+
+type sseErrorPayload struct {
+	Day     string `json:"day,omitempty"`
+	Message string `json:"message"`
+}
+
+type sseDonePayload struct {
+	Success           bool                           `json:"success"`
+	Days              int                            `json:"days"`
+	FailedDays        []string                       `json:"failed_days,omitempty"`
+	FallbackDays      []string                       `json:"fallback_days,omitempty"`
+	IncompleteDays    []string                       `json:"incomplete_days,omitempty"` // Days with meals missing foods
+	Targets           *models.DailyTargets           `json:"targets,omitempty"`
+	Nutrition         *models.PlanNutrition          `json:"nutrition,omitempty"`
+	GroceryList       *models.GroceryList            `json:"grocery_list,omitempty"`
+	PlanID            string                         `json:"plan_id,omitempty"`
+	EquipmentWarnings []models.EquipmentWarning      `json:"equipment_warnings,omitempty"` // For the prepare and cook steps below
+	Health            *models.HealthRulesApplied     `json:"health,omitempty"`
+	Prepare           []models.PrepareCookSection    `json:"prepare,omitempty"`
+	Cook              []models.PrepareCookSection    `json:"cook,omitempty"`
+	WeightAssemble    []models.WeightAssembleSection `json:"weight_assemble,omitempty"`
+	TotalDuration     string                         `json:"total_duration"`
+}
+
+// streamMealPlan generates every day of the plan concurrently and writes each one to
+// the client as soon as it and all earlier days are ready, so days always arrive in
+// calendar order and the first day is not held back by the rest of the plan. Streaming
+// stops, and pending generations are abandoned, as soon as ctx is cancelled.
+func streamMealPlan(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, reqBody models.RequestBody) {
+	start := time.Now()
+	dates := services.PlanDates(reqBody)
+	targets := services.CompleteDailyTargets(&reqBody)
+
+	// One buffered channel per day lets workers finish in any order
+	results := make([]chan streamedDay, len(dates))
+	for i := range results {
+		results[i] = make(chan streamedDay, 1)
+	}
+
+	semaphore := make(chan struct{}, streamDayConcurrency)
+	for i, date := range dates {
+		go func(i int, date string) {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				results[i] <- streamedDay{date: date, err: ctx.Err()}
+				return
+			}
+			defer func() { <-semaphore }()
+			results[i] <- generateStreamedDay(ctx, reqBody, date)
+		}(i, date)
+	}
+
+	done := sseDonePayload{
+		Success: true,
+		Targets: &targets,
+		Health:  healthRules.ProfileFor(reqBody.SelectedHealthConditions, reqBody.SelectedLifeStages).Summary(),
+	}
+	streamedDays := make(map[string]models.DayAPIMeals, len(dates))
+	for i, date := range dates {
+		var result streamedDay
+		select {
+		case result = <-results[i]:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			log.Printf("🔌 Stopping stream at %s: %v", date, ctx.Err())
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				writeSSEEvent(w, flusher, sseEventError, sseErrorPayload{Day: date, Message: "request timed out"})
+			}
+			return
+		}
+		if result.err != nil {
+			log.Printf("❌ Failed to generate %s: %v", date, result.err)
+			done.FailedDays = append(done.FailedDays, date)
+			writeSSEEvent(w, flusher, sseEventError, sseErrorPayload{Day: date, Message: result.err.Error()})
+			continue
+		}
+
+		for j, meal := range result.day.Meals {
+			writeSSEEvent(w, flusher, sseEventMeal, sseMealPayload{
+				Day:       date,
+				Date:      result.day.Date,
+				MealIndex: j,
+				Meals:     []models.MealAPIItems{meal},
+			})
+		}
+		writeSSEEvent(w, flusher, sseEventDay, sseDayPayload{
+			Day:           date,
+			Date:          result.day.Date,
+			Index:         i,
+			Meals:         result.day.Meals,
+			Duration:      formatDuration(result.timing),
+			Fallback:      result.plan.Fallback,
+			Substitutions: result.plan.Substitutions,
+			Unresolved:    result.plan.Unresolved,
+			Nutrients:     result.day.Nutrients,
+			Intake:        result.day.Intake,
+		})
+		if result.plan.Fallback {
+			done.FallbackDays = append(done.FallbackDays, date)
+		}
+		if len(result.plan.Unresolved) > 0 {
+			done.IncompleteDays = append(done.IncompleteDays, date)
+		}
+
+		done.Days++
+		streamedDays[date] = result.day
+		// Each day is its own generation, so its instructions are merged into the plan's
+		done.Prepare = mergeSections(done.Prepare, result.plan.Prepare, prepareCookSteps)
+		done.Cook = mergeSections(done.Cook, result.plan.Cook, prepareCookSteps)
+		done.WeightAssemble = mergeSections(done.WeightAssemble, result.plan.WeightAssemble, weightAssembleSteps)
+		done.EquipmentWarnings = appendUnique(done.EquipmentWarnings, result.plan.EquipmentWarnings, func(w models.EquipmentWarning) string {
+			return w.Section + "|" + w.Title + "|" + w.Step
+		})
+	}
+
+	done.Success = len(done.FailedDays) == 0 && len(done.FallbackDays) == 0 && len(done.IncompleteDays) == 0
+	done.Nutrition = services.AddNutritionTotals(streamedDays, referenceIntakesFor(reqBody))
+	if reqBody.IncludeGroceryList {
+		groceryList := services.BuildGroceryList(streamedDays)
+		done.GroceryList = &groceryList
+	}
+
+	// Store the assembled plan so it can be fetched or regenerated later
+	plan := models.MealPlanAPIResponse{
+		Success:           done.Success,
+		Data:              streamedDays,
+		Targets:           done.Targets,
+		Nutrition:         done.Nutrition,
+		GroceryList:       done.GroceryList,
+		EquipmentWarnings: done.EquipmentWarnings,
+		Health:            done.Health,
+		Prepare:           done.Prepare,
+		Cook:              done.Cook,
+		WeightAssemble:    done.WeightAssemble,
+	}
+	savePlan(ctx, reqBody, &plan)
+	done.PlanID = plan.PlanID
+	done.TotalDuration = formatDuration(time.Since(start))
+	writeSSEEvent(w, flusher, sseEventDone, done)
+}
+
+// mergeSections adds sections to merged by title, compared without case. Every day uses
+// the same fixed titles, so a repeated title gets the steps its section does not have yet.
+func mergeSections[T any](merged, sections []T, fields func(*T) (string, *[]string)) []T {
+	for _, section := range sections {
+		title, steps := fields(&section)
+		i := slices.IndexFunc(merged, func(existing T) bool {
+			existingTitle, _ := fields(&existing)
+			return sectionKey(existingTitle) == sectionKey(title)
+		})
+		if i < 0 {
+			// Copy the steps so appending later days never writes into this day's slice
+			*steps = slices.Clone(*steps)
+			merged = append(merged, section)
+			continue
+		}
+		_, mergedSteps := fields(&merged[i])
+		for _, step := range *steps {
+			if !slices.Contains(*mergedSteps, step) {
+				*mergedSteps = append(*mergedSteps, step)
+			}
+		}
+	}
+	return merged
+}
+
+func prepareCookSteps(s *models.PrepareCookSection) (string, *[]string) {
+	return s.Title, &s.Steps
+}
+
+func weightAssembleSteps(s *models.WeightAssembleSection) (string, *[]string) {
+	return s.Title, &s.Steps
+}
+
+func sectionKey(title string) string {
+	return strings.ToLower(strings.TrimSpace(title))
+}
+
+// appendUnique appends the items whose key is not already in merged
+func appendUnique[T any](merged, items []T, key func(T) string) []T {
+	for _, item := range items {
+		if !slices.ContainsFunc(merged, func(existing T) bool { return key(existing) == key(item) }) {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// generateStreamedDay prompts for a single date and resolves its foods
+func generateStreamedDay(ctx context.Context, reqBody models.RequestBody, date string) streamedDay {
+	start := time.Now()
+
+	response, err := geminiService.GenerateDay(ctx, reqBody, date)
+	if err != nil {
+		return streamedDay{date: date, err: err}
+	}
+	if len(response.Data) == 0 {
+		return streamedDay{date: date, err: fmt.Errorf("no meals generated for %s", date)}
+	}
+
+	// The requested date is authoritative; models sometimes echo a different key or label.
+	// Re-key before swapping so pins and compliance checks for the date apply.
+	llmDay, ok := response.Data[date]
+	if !ok {
+		for _, d := range response.Data {
+			llmDay = d
+			break
+		}
+	}
+	llmDay.Date = date
+	response.Data = map[string]models.DayLLMMeals{date: llmDay}
+
+	profile, health := planProfiles(reqBody)
+	plan := swapFoodItems(ctx, *response, profile, health, reqBody.PinnedFoods)
+	if ctx.Err() != nil {
+		return streamedDay{date: date, err: ctx.Err()}
+	}
+
+	days := map[string]models.DayAPIMeals{date: plan.Data[date]}
+	services.AddNutritionTotals(days, referenceIntakesFor(reqBody))
+	day := days[date]
+
+	return streamedDay{date: date, day: day, plan: plan, timing: time.Since(start)}
+}
+
+// writeSSEEvent writes a named server-sent event with a JSON payload and flushes it
+func writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, event string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling %s event: %v", event, err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	flusher.Flush()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+func TestMergeSectionsCombinesStepsOfSharedTitles(t *testing.T) {
+	monday := []models.PrepareCookSection{
+		{Title: "Cook Protein", Steps: []string{"Bake the chicken at 200C for 25 minutes", "Rest for 5 minutes"}},
+		{Title: "Cook Carbs", Steps: []string{"Simmer the rice for 15 minutes"}},
+	}
+	tuesday := []models.PrepareCookSection{
+		{Title: "cook protein ", Steps: []string{"Pan-fry the salmon for 4 minutes a side", "Rest for 5 minutes"}},
+		{Title: "Cook Vegetables", Steps: []string{"Steam the broccoli"}},
+	}
+
+	var merged []models.PrepareCookSection
+	merged = mergeSections(merged, monday, prepareCookSteps)
+	merged = mergeSections(merged, tuesday, prepareCookSteps)
+
+	want := []models.PrepareCookSection{
+		{Title: "Cook Protein", Steps: []string{"Bake the chicken at 200C for 25 minutes", "Rest for 5 minutes", "Pan-fry the salmon for 4 minutes a side"}},
+		{Title: "Cook Carbs", Steps: []string{"Simmer the rice for 15 minutes"}},
+		{Title: "Cook Vegetables", Steps: []string{"Steam the broccoli"}},
+	}
+	if len(merged) != len(want) {
+		t.Fatalf("merged %d sections, want %d: %+v", len(merged), len(want), merged)
+	}
+	for i := range want {
+		if merged[i].Title != want[i].Title || !slices.Equal(merged[i].Steps, want[i].Steps) {
+			t.Errorf("section %d = %+v, want %+v", i, merged[i], want[i])
+		}
+	}
+	if len(monday[0].Steps) != 2 {
+		t.Errorf("merging changed the first day's steps: %v", monday[0].Steps)
+	}
+}
+
+func TestMergeSectionsKeepsEquipmentWarningStepsPresent(t *testing.T) {
+	kitchen := services.NewKitchenProfile([]string{"stovetop"})
+	days := [][]models.PrepareCookSection{
+		{{Title: "Cook Protein", Steps: []string{"Pan-fry the chicken"}}},
+		{{Title: "Cook Protein", Steps: []string{"Roast the salmon in the oven at 200C"}}},
+	}
+
+	var cook []models.PrepareCookSection
+	var warnings []models.EquipmentWarning
+	for _, day := range days {
+		cook = mergeSections(cook, day, prepareCookSteps)
+		warnings = appendUnique(warnings, kitchen.Warnings(nil, day), func(w models.EquipmentWarning) string {
+			return w.Section + "|" + w.Title + "|" + w.Step
+		})
+	}
+
+	if len(warnings) == 0 {
+		t.Fatal("no warning for the oven step")
+	}
+	for _, warning := range warnings {
+		i := slices.IndexFunc(cook, func(s models.PrepareCookSection) bool { return s.Title == warning.Title })
+		if i < 0 || !slices.Contains(cook[i].Steps, warning.Step) {
+			t.Errorf("warning for %q points at a step missing from the merged sections %+v", warning.Step, cook)
+		}
+	}
+}
+
+func TestMergeSectionsWeightAssemble(t *testing.T) {
+	merged := mergeSections(nil,
+		[]models.WeightAssembleSection{{Title: "Weigh Portions", Steps: []string{"Weigh 150 g chicken"}}},
+		weightAssembleSteps)
+	merged = mergeSections(merged,
+		[]models.WeightAssembleSection{{Title: "Weigh Portions", Steps: []string{"Weigh 120 g salmon"}}},
+		weightAssembleSteps)
+
+	if len(merged) != 1 || len(merged[0].Steps) != 2 {
+		t.Errorf("merged = %+v, want one section with both steps", merged)
+	}
+}
+
+// noFoodProvider finds nothing, leaving every generated food unresolved
+type noFoodProvider struct{}
+
+func (noFoodProvider) Name() string { return "none" }
+
+func (noFoodProvider) SearchFood(ctx context.Context, foodName string) (*models.FoodAPIResult, error) {
+	return &models.FoodAPIResult{ProviderName: "none", SearchTag: foodName}, nil
+}
+
+func TestGenerateStreamedDayUsesRequestedDate(t *testing.T) {
+	const date = "2026-10-16"
+	llm := services.NewFakeProvider(`{"success": true, "data": {"` + date + `": {"date": "Friday", "meals": [
+		{"meal_name": "Lunch", "meal_time": "12:30", "meridiem": "PM", "foods": [{"name": "Brown rice", "portion_ratio": 100}]}]}}}`)
+	cache, err := services.NewFoodCache(noFoodProvider{}, services.FoodCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousLLM, previousCache := geminiService, foodCache
+	geminiService = services.NewGeminiService(llm, nil, 0, nil, foodClasses)
+	foodCache = cache
+	t.Cleanup(func() {
+		geminiService, foodCache = previousLLM, previousCache
+		cache.Close()
+	})
+
+	bar := testFood("Protein bar", 60, 350, 33, 33, 13)
+	bar.Pinned = true
+	reqBody := models.RequestBody{
+		Dates:       []string{date},
+		PinnedFoods: []models.PinnedFood{{Barcode: "123", Date: date, MealName: "Lunch", Food: &bar}},
+	}
+
+	result := generateStreamedDay(context.Background(), reqBody, date)
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if result.day.Date != date {
+		t.Errorf("day date = %q, want %q", result.day.Date, date)
+	}
+	if len(result.day.Meals) != 1 || len(result.day.Meals[0].Foods) == 0 || result.day.Meals[0].Foods[0].FoodName != "Protein bar" {
+		t.Errorf("lunch = %+v, want the pinned protein bar", result.day.Meals)
+	}
+	if len(result.plan.Unresolved) == 0 {
+		t.Fatal("no unresolved foods reported")
+	}
+	for _, unresolved := range result.plan.Unresolved {
+		if unresolved.Date != date {
+			t.Errorf("unresolved %s is dated %q, want %q", unresolved.Food, unresolved.Date, date)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+// roundingPasses caps how many times the rounding error is moved onto another food
+const roundingPasses = 3
+
+// portionIncrements are the gram steps per portion category, read from the environment
+// at startup
+var portionIncrements services.PortionIncrements
+
+// roundPortions turns solved amounts into ones that can be weighed: countable foods snap
+// to whole pieces and everything else to its category's gram step. The error this adds
+// is then absorbed by the food richest in protein or carbs, and the macros recomputed.
+// It returns the rounded foods and the residual (actual minus target) per macro.
+func roundPortions(foods []models.Food, target models.MacroTarget) ([]models.Food, models.MacroTarget) {
+	solved := calculateMealMacros(foods)
+
+	rounded := make([]models.Food, len(foods))
+	steps := make([]float64, len(foods)) // Zero for countable foods, which are not adjusted
+	for i, food := range foods {
+		rounded[i] = food
+		if len(food.Servings) == 0 {
+			continue
+		}
+		grams := parseFloatDefault(food.Servings[0].MetricServingAmount)
+		if grams <= 0 {
+			continue
+		}
+
+		if piece, unit, ok := services.CountablePiece(food); ok {
+			count := math.Max(1, math.Round(grams/piece))
+			serving := scaleServing(food.Servings[0], count*piece/grams)
+			serving.HouseholdMeasure = unit
+			serving.HouseholdAmount = count
+			rounded[i].Servings = withSelectedServing(food.Servings, serving)
+			continue
+		}
+
+		steps[i] = portionIncrements.StepFor(foodClasses.Classify(food))
+		rounded[i] = setFoodGrams(food, roundToStep(grams, steps[i]))
+	}
+
+	rounded = absorbRoundingError(rounded, steps, solved)
+	return rounded, macroResidual(calculateMealMacros(rounded), target)
+}
+
+// absorbRoundingError moves whichever of protein or carbs drifted further from the
+// solved totals onto the adjustable food with the most of it per gram, keeping each
+// change only if it brings the meal closer to the solved macros
+func absorbRoundingError(foods []models.Food, steps []float64, solved models.MacroTarget) []models.Food {
+	for pass := 0; pass < roundingPasses; pass++ {
+		actual := calculateMealMacros(foods)
+
+		proteinDrift := (actual.Proteins - solved.Proteins) / math.Max(solved.Proteins, 1)
+		carbDrift := (actual.Carbs - solved.Carbs) / math.Max(solved.Carbs, 1)
+		macro := func(m models.MacroTarget) float64 { return m.Proteins }
+		if math.Abs(carbDrift) > math.Abs(proteinDrift) {
+			macro = func(m models.MacroTarget) float64 { return m.Carbs }
+		}
+		drift := macro(actual) - macro(solved)
+
+		best, bestPerGram := -1, 0.0
+		for i, food := range foods {
+			if steps[i] == 0 {
+				continue
+			}
+			grams := parseFloatDefault(food.Servings[0].MetricServingAmount)
+			if perGram := macro(calculateMealMacros(foods[i:i+1])) / grams; perGram > bestPerGram {
+				best, bestPerGram = i, perGram
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		grams := parseFloatDefault(foods[best].Servings[0].MetricServingAmount)
+		bounds := foodGramBounds(foods[best])
+		next := roundToStep(clampFloat(grams-drift/bestPerGram, bounds.min, bounds.max), steps[best])
+		if next == grams {
+			break
+		}
+		candidate := append([]models.Food(nil), foods...)
+		candidate[best] = setFoodGrams(foods[best], next)
+		if macroError(calculateMealMacros(candidate), solved) >= macroError(actual, solved) {
+			break
+		}
+		foods = candidate
+	}
+	return foods
+}
+
+// macroError is the solver's weighted squared relative error
+func macroError(actual, target models.MacroTarget) float64 {
+	relative := func(a, t, weight float64) float64 {
+		if t <= 0 {
+			return 0
+		}
+		d := (a - t) / t
+		return weight * d * d
+	}
+	return relative(actual.Calories, target.Calories, macroWeights.Calories) +
+		relative(actual.Proteins, target.Proteins, macroWeights.Proteins) +
+		relative(actual.Carbs, target.Carbs, macroWeights.Carbs) +
+		relative(actual.Fats, target.Fats, macroWeights.Fats)
+}
+
+// setFoodGrams rescales the selected serving to the given grams
+func setFoodGrams(food models.Food, grams float64) models.Food {
+	current := parseFloatDefault(food.Servings[0].MetricServingAmount)
+	if current <= 0 {
+		return food
+	}
+	food.Servings = withSelectedServing(food.Servings, scaleServing(food.Servings[0], grams/current))
+	return food
+}
+
+// withSelectedServing copies servings with the first replaced, so the caller's slice
+// is never modified
+func withSelectedServing(servings []models.Serving, selected models.Serving) []models.Serving {
+	copied := append([]models.Serving(nil), servings...)
+	copied[0] = selected
+	return copied
+}
+
+func roundToStep(grams, step float64) float64 {
+	return math.Max(step, math.Round(grams/step)*step)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"math"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+// macroWeights sets how much each macro's relative error counts in the solver objective
+var macroWeights = models.MacroTarget{
+	Calories: 1.0,
+	Proteins: 1.0,
+	Carbs:    0.8,
+	Fats:     0.8,
+}
+
+const (
+	// portionAnchorWeight keeps the solution close to the LLM's portion ratios when
+	// several gram combinations hit the targets equally well
+	portionAnchorWeight = 0.01
+	solverMaxIterations = 500
+	solverTolerance     = 0.01 // grams
+)
+
+// gramBounds is the range of grams the solver may choose for a single food
+type gramBounds struct {
+	min float64
+	max float64
+}
+
+// foodGramBounds returns realistic per-food portion limits by food class. Fat-dominant
+// dairy such as cheese is bounded like other fats.
+func foodGramBounds(food models.Food) gramBounds {
+	class := foodClasses.Classify(food)
+	switch {
+	case class.Class == services.ClassFat,
+		class.Class == services.ClassDairy && services.PortionCategoryOf(class) == services.PortionFat:
+		return gramBounds{min: 5, max: 60}
+	case class.Class == services.ClassStarchyCarb:
+		return gramBounds{min: 20, max: 300}
+	default:
+		return gramBounds{min: 10, max: 350}
+	}
+}
+
+// solvePortions chooses gram amounts for all foods at once so that the meal macros
+// minimise the weighted squared relative error against target, subject to each food's
+// gram bounds. The current serving amounts are used as the starting point and anchor.
+// It returns the rescaled foods and the residual (actual minus target) per macro.
+func solvePortions(foods []models.Food, target models.MacroTarget) ([]models.Food, models.MacroTarget) {
+	n := len(foods)
+	if n == 0 || target.Calories <= 0 {
+		return foods, macroResidual(calculateMealMacros(foods), target)
+	}
+
+	// Per-gram macro coefficients, rows: calories, protein, carbs, fat
+	coef := make([][4]float64, n)
+	grams := make([]float64, n)
+	anchor := make([]float64, n)
+	bounds := make([]gramBounds, n)
+	active := make([]bool, n)
+
+	for i, food := range foods {
+		if len(food.Servings) == 0 {
+			continue
+		}
+		serving := food.Servings[0]
+		amount := parseFloatDefault(serving.MetricServingAmount)
+		if amount <= 0 {
+			continue
+		}
+		macros := serving.Nutrients().Macros()
+		coef[i] = [4]float64{
+			macros.Calories / amount,
+			macros.Proteins / amount,
+			macros.Carbs / amount,
+			macros.Fats / amount,
+		}
+		bounds[i] = foodGramBounds(food)
+		grams[i] = clampFloat(amount, bounds[i].min, bounds[i].max)
+		anchor[i] = grams[i]
+		active[i] = true
+	}
+
+	targets := [4]float64{target.Calories, target.Proteins, target.Carbs, target.Fats}
+	weights := [4]float64{macroWeights.Calories, macroWeights.Proteins, macroWeights.Carbs, macroWeights.Fats}
+	// Normalise by target so every macro is compared as a relative error
+	for k := range weights {
+		if targets[k] > 0 {
+			weights[k] /= targets[k] * targets[k]
+		} else {
+			weights[k] = 0
+		}
+	}
+
+	// Current totals of the (fixed + active) foods
+	var totals [4]float64
+	for i := range foods {
+		if !active[i] {
+			continue
+		}
+		for k := 0; k < 4; k++ {
+			totals[k] += coef[i][k] * grams[i]
+		}
+	}
+
+	// Projected coordinate descent on the strictly convex box-constrained QP
+	for iter := 0; iter < solverMaxIterations; iter++ {
+		maxStep := 0.0
+		for i := 0; i < n; i++ {
+			if !active[i] {
+				continue
+			}
+			scale := math.Max(anchor[i], 50)
+			anchorW := portionAnchorWeight / (scale * scale)
+
+			grad := anchorW * (grams[i] - anchor[i])
+			hess := anchorW
+			for k := 0; k < 4; k++ {
+				grad += weights[k] * coef[i][k] * (totals[k] - targets[k])
+				hess += weights[k] * coef[i][k] * coef[i][k]
+			}
+			if hess <= 0 {
+				continue
+			}
+
+			next := clampFloat(grams[i]-grad/hess, bounds[i].min, bounds[i].max)
+			delta := next - grams[i]
+			if delta == 0 {
+				continue
+			}
+			for k := 0; k < 4; k++ {
+				totals[k] += coef[i][k] * delta
+			}
+			grams[i] = next
+			maxStep = math.Max(maxStep, math.Abs(delta))
+		}
+		if maxStep < solverTolerance {
+			break
+		}
+	}
+
+	solved := make([]models.Food, n)
+	for i, food := range foods {
+		solved[i] = food
+		if !active[i] {
+			continue
+		}
+		current := parseFloatDefault(food.Servings[0].MetricServingAmount)
+		servings := append([]models.Serving(nil), food.Servings...)
+		servings[0] = scaleServing(servings[0], grams[i]/current)
+		solved[i].Servings = servings
+	}
+
+	return solved, macroResidual(calculateMealMacros(solved), target)
+}
+
+// macroResidual returns actual minus target for each macro
+func macroResidual(actual, target models.MacroTarget) models.MacroTarget {
+	return models.MacroTarget{
+		Calories: roundTo(actual.Calories-target.Calories, 1),
+		Carbs:    roundTo(actual.Carbs-target.Carbs, 1),
+		Fats:     roundTo(actual.Fats-target.Fats, 1),
+		Proteins: roundTo(actual.Proteins-target.Proteins, 1),
+	}
+}
+
+func clampFloat(v, lo, hi float64) float64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func roundTo(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+func chicken(grams float64) models.Food {
+	return testFood("Chicken breast, roasted", grams, 165, 31, 0, 3.6)
+}
+
+func rice(grams float64) models.Food {
+	return testFood("Rice, white, cooked", grams, 130, 2.7, 28, 0.3)
+}
+
+func oliveOil(grams float64) models.Food {
+	return testFood("Olive oil", grams, 884, 0, 0, 100)
+}
+
+func TestSolvePortionsHitsFeasibleTarget(t *testing.T) {
+	foods := []models.Food{chicken(100), rice(100), oliveOil(5)}
+	target := models.MacroTarget{Calories: 600, Proteins: 45, Carbs: 60, Fats: 18}
+
+	solved, residual := solvePortions(foods, target)
+
+	for name, miss := range map[string]float64{
+		"calories": residual.Calories / target.Calories,
+		"protein":  residual.Proteins / target.Proteins,
+		"carbs":    residual.Carbs / target.Carbs,
+		"fat":      residual.Fats / target.Fats,
+	} {
+		if math.Abs(miss) > 0.05 {
+			t.Errorf("%s is off by %.0f%%, want within 5%% (residual %+v)", name, 100*miss, residual)
+		}
+	}
+	if got := calculateMealMacros(solved); math.Abs(got.Calories-target.Calories-residual.Calories) > 0.1 {
+		t.Errorf("residual %+v does not match the solved macros %+v", residual, got)
+	}
+	if foodGrams(foods[0]) != 100 {
+		t.Error("solvePortions modified the caller's foods")
+	}
+}
+
+func TestSolvePortionsStopsAtBoundsForInfeasibleTarget(t *testing.T) {
+	foods := []models.Food{chicken(150), rice(150), oliveOil(10)}
+	target := models.MacroTarget{Calories: 5000, Proteins: 400, Carbs: 600, Fats: 200}
+
+	solved, residual := solvePortions(foods, target)
+
+	for i, food := range solved {
+		bounds := foodGramBounds(food)
+		if grams := foodGrams(food); grams != bounds.max {
+			t.Errorf("%s: %.1f g, want its maximum %.0f g", foods[i].FoodName, grams, bounds.max)
+		}
+	}
+	if residual.Calories >= 0 || math.IsNaN(residual.Calories) {
+		t.Errorf("residual calories = %v, want a shortfall", residual.Calories)
+	}
+}
+
+func TestSolvePortionsKeepsZeroMacroFoodsInBounds(t *testing.T) {
+	water := testFood("Water", 500, 0, 0, 0, 0)
+	foods := []models.Food{chicken(100), water}
+	target := models.MacroTarget{Calories: 330, Proteins: 62, Carbs: 0, Fats: 7}
+
+	solved, residual := solvePortions(foods, target)
+
+	bounds := foodGramBounds(water)
+	if grams := foodGrams(solved[1]); math.IsNaN(grams) || grams < bounds.min || grams > bounds.max {
+		t.Errorf("water: %.1f g, want within %+v", grams, bounds)
+	}
+	if grams := foodGrams(solved[0]); math.Abs(grams-200) > 10 {
+		t.Errorf("chicken: %.1f g, want about 200 g", grams)
+	}
+	if math.IsNaN(residual.Calories) {
+		t.Error("residual is NaN")
+	}
+}
+
+func TestSolvePortionsClampsStartingAmounts(t *testing.T) {
+	foods := []models.Food{rice(1000), oliveOil(200)}
+	// A target the starting amounts overshoot by far, so the solver only shrinks them
+	target := models.MacroTarget{Calories: 100, Proteins: 1, Carbs: 10, Fats: 5}
+
+	solved, _ := solvePortions(foods, target)
+
+	for i, food := range solved {
+		bounds := foodGramBounds(food)
+		if grams := foodGrams(food); grams < bounds.min || grams > bounds.max {
+			t.Errorf("%s: %.1f g, want within %+v", foods[i].FoodName, grams, bounds)
+		}
+	}
+}
+
+func TestSolvePortionsLeavesFoodsWithoutTarget(t *testing.T) {
+	foods := []models.Food{chicken(120)}
+	solved, _ := solvePortions(foods, models.MacroTarget{})
+	if foodGrams(solved[0]) != 120 {
+		t.Errorf("chicken: %.1f g, want 120 g unchanged", foodGrams(solved[0]))
+	}
+}
+
+func TestFoodGramBounds(t *testing.T) {
+	tests := []struct {
+		food models.Food
+		want gramBounds
+	}{
+		{oliveOil(10), gramBounds{min: 5, max: 60}},
+		{testFood("Cheese, cheddar", 30, 403, 25, 1.3, 33), gramBounds{min: 5, max: 60}},
+		{rice(150), gramBounds{min: 20, max: 300}},
+		{chicken(150), gramBounds{min: 10, max: 350}},
+		{testFood("Broccoli, raw", 100, 34, 2.8, 7, 0.4), gramBounds{min: 10, max: 350}},
+	}
+	for _, tt := range tests {
+		if got := foodGramBounds(tt.food); got != tt.want {
+			t.Errorf("foodGramBounds(%s) = %+v, want %+v", tt.food.FoodName, got, tt.want)
+		}
+	}
+}
+
+func TestRoundPortionsUsesWholePiecesAndSteps(t *testing.T) {
+	egg := testFood("Eggs, whole, cooked, hard-boiled", 130, 155, 12.6, 1.1, 10.6)
+	foods := []models.Food{egg, rice(143)}
+	target := calculateMealMacros(foods)
+
+	rounded, _ := roundPortions(foods, target)
+
+	if unit := rounded[0].Servings[0].HouseholdMeasure; unit != "egg" {
+		t.Errorf("egg unit = %q, want egg", unit)
+	}
+	if grams := foodGrams(rounded[0]); math.Mod(grams, 50) != 0 {
+		t.Errorf("eggs: %.1f g, want whole 50 g eggs", grams)
+	}
+	if grams := foodGrams(rounded[1]); math.Abs(math.Mod(grams, 5)) > 1e-9 {
+		t.Errorf("rice: %.3f g, want a multiple of 5 g", grams)
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+const (
+	defaultCuisineWeight = 1.0
+	maxCuisineWeight     = 5.0
+)
+
+// cuisinePreferenceWeights maps preference words to weights. Zero means never.
+var cuisinePreferenceWeights = map[string]float64{
+	"love":       3,
+	"favorite":   3,
+	"favourite":  3,
+	"high":       3,
+	"very high":  3,
+	"like":       2,
+	"prefer":     2,
+	"yes":        2,
+	"medium":     2,
+	"neutral":    1,
+	"sometimes":  1,
+	"ok":         1,
+	"okay":       1,
+	"low":        1,
+	"dislike":    0,
+	"no":         0,
+	"never":      0,
+	"avoid":      0,
+	"none":       0,
+	"not at all": 0,
+}
+
+// CuisineWeight turns a preference into a weight between 0 and 5. Empty or unknown
+// preferences count as neutral.
+func CuisineWeight(preference string) float64 {
+	p := strings.ToLower(strings.TrimSpace(preference))
+	if p == "" {
+		return defaultCuisineWeight
+	}
+	if weight, ok := cuisinePreferenceWeights[p]; ok {
+		return weight
+	}
+	if weight, err := strconv.ParseFloat(p, 64); err == nil {
+		return math.Max(0, math.Min(weight, maxCuisineWeight))
+	}
+	return defaultCuisineWeight
+}
+
+// buildCuisineRules turns weighted cuisines into a share of meals per cuisine, plus the
+// cuisines to leave out entirely
+func buildCuisineRules(cuisines []models.Cuisine) string {
+	type weighted struct {
+		name   string
+		weight float64
+	}
+	var preferred []weighted
+	var avoided []string
+	total := 0.0
+	for _, cuisine := range cuisines {
+		name := strings.TrimSpace(cuisine.Name)
+		if name == "" {
+			continue
+		}
+		weight := CuisineWeight(cuisine.Preference)
+		if weight == 0 {
+			avoided = append(avoided, name)
+			continue
+		}
+		preferred = append(preferred, weighted{name, weight})
+		total += weight
+	}
+	if len(preferred) == 0 && len(avoided) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(preferred, func(i, j int) bool { return preferred[i].weight > preferred[j].weight })
+
+	prompt := "CUISINE PREFERENCES (spread meals across these cuisines in roughly these shares):\n"
+	for _, cuisine := range preferred {
+		prompt += fmt.Sprintf("- %s: about %.0f%% of meals\n", cuisine.name, cuisine.weight/total*100)
+	}
+	if len(avoided) > 0 {
+		prompt += fmt.Sprintf("- Never use these cuisines: %s\n", strings.Join(avoided, ", "))
+	}
+	return prompt + "\n"
+}
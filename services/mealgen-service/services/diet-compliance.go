@@ -0,0 +1,526 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// FoodCategory is a group of foods that a diet or allergy can exclude
+type FoodCategory string
+
+const (
+	CategoryRedMeat    FoodCategory = "red meat"
+	CategoryPork       FoodCategory = "pork"
+	CategoryPoultry    FoodCategory = "poultry"
+	CategoryFish       FoodCategory = "fish"
+	CategoryShellfish  FoodCategory = "shellfish"
+	CategoryDairy      FoodCategory = "dairy"
+	CategoryEgg        FoodCategory = "eggs"
+	CategoryHoney      FoodCategory = "honey"
+	CategoryGluten     FoodCategory = "gluten"
+	CategoryGrain      FoodCategory = "grains"
+	CategoryLegume     FoodCategory = "legumes"
+	CategorySoy        FoodCategory = "soy"
+	CategoryTreeNut    FoodCategory = "tree nuts"
+	CategoryPeanut     FoodCategory = "peanuts"
+	CategorySesame     FoodCategory = "sesame"
+	CategorySugar      FoodCategory = "added sugar"
+	CategoryStarchyVeg FoodCategory = "starchy vegetables"
+	CategorySweetFruit FoodCategory = "high-sugar fruit"
+	CategoryAlcohol    FoodCategory = "alcohol"
+)
+
+// categoryRule describes how to recognise a category from a food name. Keywords match
+// whole words (plurals included). Phrases in except are ignored before matching, and any
+// freeFrom marker in the name clears the food of the category entirely.
+type categoryRule struct {
+	keywords    []string
+	except      []string
+	freeFrom    []string
+	substitutes []string // compliant alternatives, tried in order
+}
+
+var plantBasedMarkers = []string{"vegan", "plant based", "meatless", "vegetarian", "veggie"}
+
+var proteinSubstitutes = []string{"Grilled Chicken Breast", "Turkey Breast", "Salmon", "Eggs", "Tofu", "Tempeh", "Lentils", "Chickpeas"}
+var carbSubstitutes = []string{"Brown Rice", "Quinoa", "Sweet Potato", "Potato", "Cauliflower Rice"}
+var fatSubstitutes = []string{"Pumpkin Seeds", "Sunflower Seeds", "Avocado", "Olive Oil"}
+var fruitSubstitutes = []string{"Strawberries", "Raspberries", "Blackberries"}
+
+var categoryRules = map[FoodCategory]categoryRule{
+	CategoryRedMeat: {
+		keywords:    []string{"beef", "steak", "lamb", "veal", "venison", "bison", "mutton", "brisket", "sirloin", "ribeye", "meatball", "jerky", "burger", "goat"},
+		except:      []string{"goat cheese", "goat milk"},
+		freeFrom:    plantBasedMarkers,
+		substitutes: proteinSubstitutes,
+	},
+	CategoryPork: {
+		keywords:    []string{"pork", "bacon", "ham", "prosciutto", "salami", "pepperoni", "chorizo", "lard", "pancetta", "sausage"},
+		except:      []string{"turkey bacon", "turkey sausage", "chicken sausage", "beef bacon", "turkey ham"},
+		freeFrom:    plantBasedMarkers,
+		substitutes: proteinSubstitutes,
+	},
+	CategoryPoultry: {
+		keywords:    []string{"chicken", "turkey", "duck", "goose", "quail"},
+		freeFrom:    plantBasedMarkers,
+		substitutes: proteinSubstitutes,
+	},
+	CategoryFish: {
+		keywords:    []string{"fish", "salmon", "tuna", "cod", "tilapia", "trout", "sardine", "mackerel", "halibut", "anchovy", "anchovies", "haddock", "bass", "snapper", "swordfish", "pollock", "herring", "catfish", "mahi"},
+		freeFrom:    plantBasedMarkers,
+		substitutes: proteinSubstitutes,
+	},
+	CategoryShellfish: {
+		keywords:    []string{"shrimp", "prawn", "crab", "lobster", "scallop", "clam", "mussel", "oyster", "crawfish", "crayfish", "squid", "calamari", "octopus"},
+		freeFrom:    plantBasedMarkers,
+		substitutes: proteinSubstitutes,
+	},
+	CategoryDairy: {
+		keywords: []string{"milk", "cheese", "yogurt", "yoghurt", "butter", "cream", "whey", "casein", "ghee", "kefir", "ricotta", "mozzarella", "cheddar", "parmesan", "feta", "brie", "custard", "paneer", "skyr", "quark"},
+		except: []string{"peanut butter", "almond butter", "cashew butter", "nut butter", "seed butter", "cocoa butter", "apple butter", "butter bean",
+			"almond milk", "oat milk", "soy milk", "coconut milk", "rice milk", "cashew milk", "hemp milk", "pea milk",
+			"coconut cream", "coconut yogurt", "soy yogurt", "almond yogurt", "oat yogurt", "cream of tartar"},
+		freeFrom:    []string{"dairy free", "non dairy", "vegan", "plant based"},
+		substitutes: []string{"Soy Yogurt", "Coconut Yogurt", "Oat Milk", "Tofu", "Avocado"},
+	},
+	CategoryEgg: {
+		keywords:    []string{"egg", "omelet", "omelette", "frittata", "mayonnaise", "mayo", "meringue", "quiche"},
+		freeFrom:    []string{"egg free", "eggless", "vegan", "plant based"},
+		substitutes: []string{"Tofu", "Greek Yogurt", "Turkey Breast", "Chickpeas", "Lentils"},
+	},
+	CategoryHoney: {
+		keywords:    []string{"honey"},
+		substitutes: []string{"Maple Syrup", "Strawberries"},
+	},
+	CategoryGluten: {
+		keywords:    []string{"wheat", "barley", "rye", "spelt", "farro", "bulgur", "couscous", "semolina", "seitan", "bread", "pasta", "spaghetti", "noodle", "bagel", "tortilla", "cracker", "croissant", "muffin", "pancake", "waffle", "flour", "pita", "naan", "pretzel"},
+		except:      []string{"rice noodle", "rice pasta", "corn tortilla", "chickpea pasta", "lentil pasta", "zucchini noodle", "almond flour", "coconut flour", "rice flour"},
+		freeFrom:    []string{"gluten free"},
+		substitutes: carbSubstitutes,
+	},
+	CategoryGrain: {
+		keywords:    []string{"rice", "oat", "oatmeal", "quinoa", "corn", "millet", "buckwheat", "amaranth", "sorghum", "granola", "cereal"},
+		except:      []string{"cauliflower rice", "broccoli rice", "rice vinegar"},
+		substitutes: carbSubstitutes,
+	},
+	CategoryLegume: {
+		keywords:    []string{"bean", "lentil", "chickpea", "pea", "hummus"},
+		except:      []string{"green bean", "snap pea", "snow pea", "coffee bean", "vanilla bean", "cocoa bean"},
+		substitutes: []string{"Tofu", "Grilled Chicken Breast", "Eggs", "Broccoli"},
+	},
+	CategorySoy: {
+		keywords:    []string{"soy", "soya", "tofu", "tempeh", "edamame", "miso", "soybean", "tamari"},
+		substitutes: []string{"Grilled Chicken Breast", "Eggs", "Lentils", "Chickpeas", "Quinoa"},
+	},
+	CategoryTreeNut: {
+		keywords:    []string{"nut", "almond", "cashew", "walnut", "pecan", "pistachio", "hazelnut", "macadamia", "chestnut", "praline", "marzipan", "nutella"},
+		except:      []string{"water chestnut"},
+		freeFrom:    []string{"nut free"},
+		substitutes: fatSubstitutes,
+	},
+	CategoryPeanut: {
+		keywords:    []string{"peanut", "groundnut"},
+		freeFrom:    []string{"peanut free"},
+		substitutes: fatSubstitutes,
+	},
+	CategorySesame: {
+		keywords:    []string{"sesame", "tahini", "hummus"},
+		substitutes: fatSubstitutes,
+	},
+	CategorySugar: {
+		keywords:    []string{"sugar", "syrup", "candy", "soda", "juice", "jam", "jelly", "chocolate", "cookie", "cake", "donut"},
+		except:      []string{"sugar snap"},
+		freeFrom:    []string{"sugar free", "no sugar", "unsweetened"},
+		substitutes: fruitSubstitutes,
+	},
+	CategoryStarchyVeg: {
+		keywords:    []string{"potato", "yam", "plantain", "parsnip"},
+		substitutes: []string{"Cauliflower Rice", "Zucchini", "Broccoli"},
+	},
+	CategorySweetFruit: {
+		keywords:    []string{"banana", "mango", "grape", "pineapple", "date", "raisin", "apple", "orange", "pear"},
+		substitutes: fruitSubstitutes,
+	},
+	CategoryAlcohol: {
+		keywords:    []string{"wine", "beer", "vodka", "rum", "whiskey", "whisky", "gin", "tequila", "liquor", "sake"},
+		except:      []string{"wine vinegar"},
+		substitutes: []string{"Sparkling Water"},
+	},
+}
+
+// dietExclusions lists the categories each supported diet rules out
+var dietExclusions = map[string][]FoodCategory{
+	"vegan":       {CategoryRedMeat, CategoryPork, CategoryPoultry, CategoryFish, CategoryShellfish, CategoryDairy, CategoryEgg, CategoryHoney},
+	"vegetarian":  {CategoryRedMeat, CategoryPork, CategoryPoultry, CategoryFish, CategoryShellfish},
+	"pescatarian": {CategoryRedMeat, CategoryPork, CategoryPoultry},
+	"keto":        {CategoryGluten, CategoryGrain, CategoryLegume, CategorySugar, CategoryHoney, CategoryStarchyVeg, CategorySweetFruit},
+	"paleo":       {CategoryGluten, CategoryGrain, CategoryLegume, CategoryPeanut, CategorySoy, CategoryDairy, CategorySugar},
+	"gluten free": {CategoryGluten},
+	"dairy free":  {CategoryDairy},
+	"halal":       {CategoryPork, CategoryAlcohol},
+	"kosher":      {CategoryPork, CategoryShellfish},
+}
+
+var dietAliases = map[string]string{
+	"plant based":  "vegan",
+	"veggie":       "vegetarian",
+	"pescetarian":  "pescatarian",
+	"ketogenic":    "keto",
+	"celiac":       "gluten free",
+	"coeliac":      "gluten free",
+	"lactose free": "dairy free",
+}
+
+// allergenFamilies maps the ways users describe an allergy to the categories it covers
+var allergenFamilies = map[string][]FoodCategory{
+	"tree nuts": {CategoryTreeNut},
+	"tree nut":  {CategoryTreeNut},
+	"nuts":      {CategoryTreeNut, CategoryPeanut},
+	"nut":       {CategoryTreeNut, CategoryPeanut},
+	"peanuts":   {CategoryPeanut},
+	"peanut":    {CategoryPeanut},
+	"dairy":     {CategoryDairy},
+	"milk":      {CategoryDairy},
+	"lactose":   {CategoryDairy},
+	"eggs":      {CategoryEgg},
+	"egg":       {CategoryEgg},
+	"gluten":    {CategoryGluten},
+	"wheat":     {CategoryGluten},
+	"celiac":    {CategoryGluten},
+	"soy":       {CategorySoy},
+	"soya":      {CategorySoy},
+	"fish":      {CategoryFish},
+	"shellfish": {CategoryShellfish},
+	"seafood":   {CategoryFish, CategoryShellfish},
+	"sesame":    {CategorySesame},
+	"pork":      {CategoryPork},
+	"alcohol":   {CategoryAlcohol},
+}
+
+// classSubstitutes keep a replacement in the same food class as the original, so a
+// swapped meal keeps its shape; tried after category substitutes
+var classSubstitutes = map[string][]string{
+	ClassProtein:        proteinSubstitutes,
+	ClassStarchyCarb:    carbSubstitutes,
+	ClassFat:            fatSubstitutes,
+	ClassFruitVegetable: append(append([]string(nil), fruitSubstitutes...), "Broccoli", "Spinach", "Zucchini"),
+	ClassDairy:          {"Greek Yogurt", "Cottage Cheese", "Soy Yogurt", "Oat Milk"},
+}
+
+// dietClassExclusions rule out whole food classes for diets whose limits are about
+// macros, catching foods the keyword rules do not name
+var dietClassExclusions = map[string][]string{
+	"keto": {ClassStarchyCarb},
+}
+
+// complianceFallbacks are tried when no category-specific substitute fits
+var complianceFallbacks = []string{"Broccoli", "Spinach", "Zucchini", "Green Beans", "Olive Oil"}
+
+type exclusion struct {
+	category FoodCategory // empty for a literal food the user avoids
+	literal  string
+	class    string // a food class ruled out by macros, checked on resolved foods
+	source   string // what caused the exclusion, e.g. "vegan diet" or "tree nuts allergy"
+}
+
+// ComplianceProfile holds the foods a user's diet and allergies rule out. It checks
+// food names against rules rather than relying on the LLM to honour the prompt.
+type ComplianceProfile struct {
+	exclusions []exclusion
+	classifier *FoodClassifier // optional; enables class exclusions and substitutes
+}
+
+// NewComplianceProfile builds a profile from a free-form diet type (e.g. "Vegan",
+// "keto, gluten-free") and a list of allergies or foods to avoid. Unknown diets add no
+// rules; unknown allergy terms are matched literally against food names.
+func NewComplianceProfile(dietType string, avoid []string) *ComplianceProfile {
+	p := &ComplianceProfile{}
+
+	for _, diet := range splitDietTypes(dietType) {
+		if alias, ok := dietAliases[diet]; ok {
+			diet = alias
+		}
+		for _, category := range dietExclusions[diet] {
+			p.exclusions = append(p.exclusions, exclusion{category: category, source: diet + " diet"})
+		}
+		for _, class := range dietClassExclusions[diet] {
+			p.exclusions = append(p.exclusions, exclusion{class: class, source: diet + " diet"})
+		}
+	}
+
+	for _, item := range avoid {
+		term := normalizeAllergyTerm(item)
+		if term == "" {
+			continue
+		}
+		if categories, ok := allergenFamilies[term]; ok {
+			for _, category := range categories {
+				p.exclusions = append(p.exclusions, exclusion{category: category, source: term + " allergy"})
+			}
+			continue
+		}
+		p.exclusions = append(p.exclusions, exclusion{literal: singular(term), source: "avoids " + term})
+	}
+
+	return p
+}
+
+// Exclude rules out foods whose name contains term; source is quoted in the reasons
+func (p *ComplianceProfile) Exclude(term, source string) {
+	term = strings.TrimSpace(paddedWords(term))
+	if term == "" {
+		return
+	}
+	p.exclusions = append(p.exclusions, exclusion{literal: singular(term), source: source})
+}
+
+// UseClassifier lets the profile check resolved foods by class and pick substitutes of
+// the same class
+func (p *ComplianceProfile) UseClassifier(classifier *FoodClassifier) {
+	p.classifier = classifier
+}
+
+// Empty reports whether the profile excludes nothing
+func (p *ComplianceProfile) Empty() bool {
+	return p == nil || len(p.exclusions) == 0
+}
+
+// Violations returns one reason per rule the food name breaks
+func (p *ComplianceProfile) Violations(foodName string) []string {
+	if p.Empty() {
+		return nil
+	}
+
+	var reasons []string
+	seen := make(map[string]bool)
+	for _, ex := range p.exclusions {
+		var reason string
+		if ex.category != "" {
+			if keyword := matchCategory(foodName, ex.category); keyword != "" {
+				reason = fmt.Sprintf("%s excludes %s (%s)", ex.source, ex.category, keyword)
+			}
+		} else if ex.class != "" {
+			if class, ok := p.classifier.ClassifyName(foodName); ok && class == ex.class {
+				reason = classExclusionReason(ex)
+			}
+		} else if containsWord(paddedWords(foodName), ex.literal) {
+			reason = ex.source
+		}
+		if reason != "" && !seen[reason] {
+			seen[reason] = true
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// FoodViolations checks a resolved food: its name as in Violations, and, with a
+// classifier, its class against diets that rule out whole classes
+func (p *ComplianceProfile) FoodViolations(food models.Food) []string {
+	reasons := p.Violations(food.FoodName)
+	if p.Empty() || p.classifier == nil {
+		return reasons
+	}
+
+	var class FoodClassification
+	classified := false
+	for _, ex := range p.exclusions {
+		if ex.class == "" {
+			continue
+		}
+		if !classified {
+			class, classified = p.classifier.Classify(food), true
+		}
+		if reason := classExclusionReason(ex); class.Class == ex.class && !slices.Contains(reasons, reason) {
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+func classExclusionReason(ex exclusion) string {
+	return fmt.Sprintf("%s excludes %s foods", ex.source, className(ex.class))
+}
+
+// className spells a food class for people, e.g. "starchy carb"
+func className(class string) string {
+	return strings.ReplaceAll(class, "_", " ")
+}
+
+// Substitute picks a compliant replacement for foodName, preferring alternatives for
+// the categories it breaks, then foods of the same class. Names in exclude (normalised)
+// are skipped so a meal does not end up with the same food twice.
+func (p *ComplianceProfile) Substitute(foodName string, exclude map[string]bool) (string, bool) {
+	var candidates []string
+	for _, ex := range p.exclusions {
+		if ex.category != "" && matchCategory(foodName, ex.category) != "" {
+			candidates = append(candidates, categoryRules[ex.category].substitutes...)
+		}
+	}
+	if class, ok := p.classifier.ClassifyName(foodName); ok {
+		candidates = append(candidates, classSubstitutes[class]...)
+	}
+	candidates = append(candidates, complianceFallbacks...)
+
+	original := NormalizeFoodName(foodName)
+	for _, candidate := range candidates {
+		key := NormalizeFoodName(candidate)
+		if key == original || exclude[key] {
+			continue
+		}
+		if len(p.Violations(candidate)) == 0 {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// CompliantFoods replaces non-compliant foods in a list, keeping portion ratios, and
+// drops any food without a compliant alternative
+func (p *ComplianceProfile) CompliantFoods(foods []models.FoodWithPortion) []models.FoodWithPortion {
+	if p.Empty() {
+		return foods
+	}
+
+	used := make(map[string]bool, len(foods))
+	for _, food := range foods {
+		used[NormalizeFoodName(food.Name)] = true
+	}
+
+	result := make([]models.FoodWithPortion, 0, len(foods))
+	for _, food := range foods {
+		if len(p.Violations(food.Name)) > 0 {
+			replacement, ok := p.Substitute(food.Name, used)
+			if !ok {
+				continue
+			}
+			used[NormalizeFoodName(replacement)] = true
+			food.Name = replacement
+		}
+		result = append(result, food)
+	}
+	return result
+}
+
+// PromptRules describes the exclusions for the LLM prompt, one line per source
+func (p *ComplianceProfile) PromptRules() []string {
+	if p.Empty() {
+		return nil
+	}
+
+	bySource := make(map[string][]string)
+	var sources []string
+	for _, ex := range p.exclusions {
+		if _, ok := bySource[ex.source]; !ok {
+			sources = append(sources, ex.source)
+		}
+		item := ex.literal
+		if ex.class != "" {
+			item = className(ex.class) + " foods"
+		}
+		if ex.category != "" {
+			keywords := categoryRules[ex.category].keywords
+			if len(keywords) > 4 {
+				keywords = keywords[:4]
+			}
+			item = fmt.Sprintf("%s (e.g. %s)", ex.category, strings.Join(keywords, ", "))
+		}
+		bySource[ex.source] = append(bySource[ex.source], item)
+	}
+
+	rules := make([]string, 0, len(sources))
+	for _, source := range sources {
+		rules = append(rules, fmt.Sprintf("%s: no %s", source, strings.Join(bySource[source], "; ")))
+	}
+	return rules
+}
+
+// matchCategory returns the keyword that places foodName in the category, if any
+func matchCategory(foodName string, category FoodCategory) string {
+	rule, ok := categoryRules[category]
+	if !ok {
+		return ""
+	}
+
+	words := paddedWords(foodName)
+	for _, marker := range rule.freeFrom {
+		if strings.Contains(words, " "+marker+" ") {
+			return ""
+		}
+	}
+	for _, phrase := range rule.except {
+		words = strings.ReplaceAll(words, " "+phrase+" ", " ")
+		words = strings.ReplaceAll(words, " "+phrase+"s ", " ")
+	}
+	for _, keyword := range rule.keywords {
+		if containsWord(words, keyword) {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// paddedWords lower-cases a name, turns punctuation into spaces and pads it so whole
+// words can be found with " word " lookups
+func paddedWords(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return " " + strings.Join(strings.Fields(b.String()), " ") + " "
+}
+
+// containsWord reports whether the padded name contains word or its plural. word is
+// expected in the singular, as singular returns it; "berry" also finds "berries".
+func containsWord(words, word string) bool {
+	if word == "" {
+		return false
+	}
+	forms := []string{word, word + "s", word + "es"}
+	if n := len(word); n > 2 && word[n-1] == 'y' && !strings.ContainsRune("aeiou", rune(word[n-2])) {
+		forms = append(forms, word[:n-1]+"ies")
+	}
+	for _, form := range forms {
+		if strings.Contains(words, " "+form+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func splitDietTypes(dietType string) []string {
+	normalized := strings.ToLower(dietType)
+	for _, sep := range []string{",", "/", "&", "+", ";", " and "} {
+		normalized = strings.ReplaceAll(normalized, sep, "|")
+	}
+
+	var diets []string
+	for _, part := range strings.Split(normalized, "|") {
+		part = strings.TrimSpace(paddedWords(part))
+		if part != "" {
+			diets = append(diets, part)
+		}
+	}
+	return diets
+}
+
+// normalizeAllergyTerm reduces "Tree-nut allergy" or "lactose intolerance" to the term
+func normalizeAllergyTerm(item string) string {
+	words := strings.Fields(strings.TrimSpace(paddedWords(item)))
+	kept := words[:0]
+	for _, word := range words {
+		switch word {
+		case "allergy", "allergies", "allergic", "intolerance", "intolerant", "sensitivity", "free", "no":
+			continue
+		}
+		kept = append(kept, word)
+	}
+	return strings.Join(kept, " ")
+}
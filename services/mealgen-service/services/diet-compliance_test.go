@@ -0,0 +1,55 @@
+package services
+
+import "testing"
+
+func TestViolationsMatchAvoidedPlurals(t *testing.T) {
+	tests := []struct {
+		avoid string
+		food  string
+		want  bool
+	}{
+		// -s
+		{"almonds", "Almonds, raw", true},
+		{"almonds", "Almond milk, unsweetened", true},
+		{"almond", "Almonds", true},
+		// -es
+		{"peaches", "Peach, raw", true},
+		{"peach", "Peaches, canned", true},
+		{"radishes", "Radish", true},
+		// -ies
+		{"strawberries", "Strawberries", true},
+		{"strawberry", "Strawberries, raw", true},
+		{"blueberries", "Blueberries, raw", true},
+		{"cherries", "Cherries, sweet", true},
+		{"cherry", "Cherry, sour", true},
+		{"strawberries", "Raspberries", false},
+		// -oes
+		{"tomatoes", "Tomato, raw", true},
+		{"tomato", "Cherry tomatoes", true},
+		{"potatoes", "Potato, baked", true},
+		// multi-word terms
+		{"sweet potatoes", "Sweet potato, baked", true},
+		{"sweet potato", "Sweet Potatoes", true},
+		{"sweet potatoes", "Potatoes, russet", false},
+		{"green beans", "Green beans, canned", true},
+		{"green beans", "Beans, black", false},
+		// whole words only
+		{"pea", "Peach", false},
+		{"oats", "Goats milk", false},
+	}
+	for _, tt := range tests {
+		profile := NewComplianceProfile("", []string{tt.avoid})
+		if got := len(profile.Violations(tt.food)) > 0; got != tt.want {
+			t.Errorf("avoid %q, Violations(%q) = %v, want %v", tt.avoid, tt.food, got, tt.want)
+		}
+	}
+}
+
+func TestSubstituteSkipsAvoidedPlurals(t *testing.T) {
+	profile := NewComplianceProfile("keto", []string{"strawberries"})
+
+	got, ok := profile.Substitute("Mango", nil)
+	if !ok || got != "Raspberries" {
+		t.Errorf("Substitute(Mango) = %q, %v; want Raspberries", got, ok)
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FakeProvider replays canned responses. It never touches the network, which makes it
+// suitable for local runs and tests.
+//
+// Responses are grouped into sequences, each replayed in order and wrapping around at
+// the end. A request uses the first sequence added with On whose schema name and prompt
+// text match, so callers that run concurrently, such as the days of a streamed plan,
+// each get their own sequence; other requests use the default sequence.
+type FakeProvider struct {
+	mu        sync.Mutex
+	sequences []*fakeSequence
+	fallback  *fakeSequence
+	prompts   []string
+}
+
+type fakeSequence struct {
+	schemaName string // Empty matches any schema
+	contains   string // Empty matches any prompt
+	responses  []string
+	next       int
+}
+
+func NewFakeProvider(responses ...string) *FakeProvider {
+	return &FakeProvider{fallback: &fakeSequence{responses: responses}}
+}
+
+// On adds a sequence for requests with the schema name whose prompt contains the given
+// text. Either may be empty to match anything. Repair prompts repeat the original
+// prompt, so a repair continues the sequence of the request it repairs.
+func (fp *FakeProvider) On(schemaName, contains string, responses ...string) *FakeProvider {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	fp.sequences = append(fp.sequences, &fakeSequence{schemaName: schemaName, contains: contains, responses: responses})
+	return fp
+}
+
+// LoadFakeProvider loads canned responses from path. A directory is read file by
+// file in name order, and each subdirectory holds the responses for the schema it is
+// named after, e.g. meal_plan/; a .json file holding an array of strings yields one
+// response per element; any other file is replayed as a single response.
+func LoadFakeProvider(path string) (*FakeProvider, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fake responses: %w", err)
+	}
+
+	if !info.IsDir() {
+		responses, err := readFakeResponses(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewFakeProvider(responses...), nil
+	}
+
+	responses, schemas, err := readFakeResponseDir(path)
+	if err != nil {
+		return nil, err
+	}
+	fp := NewFakeProvider(responses...)
+	for _, schema := range schemas {
+		schemaResponses, _, err := readFakeResponseDir(filepath.Join(path, schema))
+		if err != nil {
+			return nil, err
+		}
+		if len(schemaResponses) > 0 {
+			fp.On(schema, "", schemaResponses...)
+		}
+	}
+	if len(responses) == 0 && len(fp.sequences) == 0 {
+		return nil, fmt.Errorf("no fake responses found in %s", path)
+	}
+	return fp, nil
+}
+
+// readFakeResponseDir reads the responses of a directory's files in name order and
+// lists its subdirectories
+func readFakeResponseDir(path string) ([]string, []string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read fake responses directory: %w", err)
+	}
+	var names, dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		} else {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(dirs)
+
+	var responses []string
+	for _, name := range names {
+		fileResponses, err := readFakeResponses(filepath.Join(path, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		responses = append(responses, fileResponses...)
+	}
+	return responses, dirs, nil
+}
+
+func readFakeResponses(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fake response %s: %w", filepath.Base(path), err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var responses []string
+		if err := json.Unmarshal(data, &responses); err == nil && len(responses) > 0 {
+			return responses, nil
+		}
+	}
+	return []string{string(data)}, nil
+}
+
+func (fp *FakeProvider) Name() string {
+	return LLMProviderFake
+}
+
+func (fp *FakeProvider) Generate(ctx context.Context, req LLMRequest) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	fp.prompts = append(fp.prompts, req.Prompt)
+	sequence := fp.fallback
+	for _, s := range fp.sequences {
+		if (s.schemaName == "" || s.schemaName == req.SchemaName) && strings.Contains(req.Prompt, s.contains) {
+			sequence = s
+			break
+		}
+	}
+	if len(sequence.responses) == 0 {
+		return "", fmt.Errorf("fake provider has no canned responses for %s", req.SchemaName)
+	}
+
+	response := sequence.responses[sequence.next%len(sequence.responses)]
+	sequence.next++
+	return response, nil
+}
+
+// Prompts returns every prompt received so far, in call order
+func (fp *FakeProvider) Prompts() []string {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	return append([]string(nil), fp.prompts...)
+}
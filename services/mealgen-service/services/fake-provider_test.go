@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFakeProviderGivesConcurrentCallersTheirOwnSequence(t *testing.T) {
+	dates := []string{"2026-10-16", "2026-10-17", "2026-10-18", "2026-10-19"}
+	fp := NewFakeProvider("default")
+	for _, date := range dates {
+		fp.On("meal_plan", date, date+" first", date+" second")
+	}
+
+	var wg sync.WaitGroup
+	got := make([][2]string, len(dates))
+	for i, date := range dates {
+		wg.Add(1)
+		go func(i int, date string) {
+			defer wg.Done()
+			for call := range 2 {
+				response, err := fp.Generate(context.Background(), LLMRequest{Prompt: "Plan for " + date, SchemaName: "meal_plan"})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				got[i][call] = response
+			}
+		}(i, date)
+	}
+	wg.Wait()
+
+	for i, date := range dates {
+		if want := [2]string{date + " first", date + " second"}; got[i] != want {
+			t.Errorf("responses for %s = %q, want %q", date, got[i], want)
+		}
+	}
+
+	response, err := fp.Generate(context.Background(), LLMRequest{Prompt: "Plan for 2026-10-16", SchemaName: "serving_selection"})
+	if err != nil || response != "default" {
+		t.Errorf("other schema got %q, %v; want the default sequence", response, err)
+	}
+}
+
+func TestFakeProviderWrapsAround(t *testing.T) {
+	fp := NewFakeProvider("a", "b")
+	var got []string
+	for range 3 {
+		response, err := fp.Generate(context.Background(), LLMRequest{Prompt: "p"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, response)
+	}
+	if fmt.Sprint(got) != "[a b a]" {
+		t.Errorf("responses = %v, want [a b a]", got)
+	}
+	if prompts := fp.Prompts(); len(prompts) != 3 {
+		t.Errorf("recorded %d prompts, want 3", len(prompts))
+	}
+}
+
+func TestFakeProviderHonoursCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewFakeProvider("a").Generate(ctx, LLMRequest{}); err == nil {
+		t.Error("Generate with a cancelled context succeeded")
+	}
+}
+
+func TestLoadFakeProviderReadsSchemaDirectories(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("01-default.txt", "default")
+	write("meal_plan/01.json", `{"plan": 1}`)
+	write("meal_plan/02.json", `{"plan": 2}`)
+	write("serving_selection/answers.json", `["one", "two"]`)
+
+	fp, err := LoadFakeProvider(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		schema string
+		want   string
+	}{
+		{"meal_plan", `{"plan": 1}`},
+		{"serving_selection", "one"},
+		{"meal_plan", `{"plan": 2}`},
+		{"serving_selection", "two"},
+		{"food_replacement", "default"},
+	}
+	for _, tt := range tests {
+		got, err := fp.Generate(context.Background(), LLMRequest{Prompt: "p", SchemaName: tt.schema})
+		if err != nil || got != tt.want {
+			t.Errorf("Generate(%s) = %q, %v; want %q", tt.schema, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadFakeProviderRejectsEmptyDirectory(t *testing.T) {
+	if _, err := LoadFakeProvider(t.TempDir()); err == nil {
+		t.Error("LoadFakeProvider on an empty directory succeeded")
+	}
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultFoodCacheSize = 1000
+	defaultFoodCacheTTL  = 24 * time.Hour
+)
+
+var foodCacheBucket = []byte("food_search")
+
+// FoodCacheConfig configures the food search cache
+type FoodCacheConfig struct {
+	Size int           // maximum in-memory entries
+	TTL  time.Duration // how long a search result stays fresh
+	Path string        // optional BoltDB file; empty keeps the cache in memory only
+}
+
+// FoodCacheConfigFromEnv reads FOOD_CACHE_SIZE, FOOD_CACHE_TTL and FOOD_CACHE_PATH
+func FoodCacheConfigFromEnv() FoodCacheConfig {
+	cfg := FoodCacheConfig{
+		Size: defaultFoodCacheSize,
+		TTL:  defaultFoodCacheTTL,
+		Path: os.Getenv("FOOD_CACHE_PATH"),
+	}
+	if v, err := strconv.Atoi(os.Getenv("FOOD_CACHE_SIZE")); err == nil && v > 0 {
+		cfg.Size = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("FOOD_CACHE_TTL")); err == nil && v > 0 {
+		cfg.TTL = v
+	}
+	return cfg
+}
+
+// FoodCache sits in front of a FoodProvider. Results are kept in an LRU with a TTL
+// and, when a path is configured, persisted to a BoltDB file so they survive restarts.
+type FoodCache struct {
+	provider FoodProvider
+	size     int
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+	db    *bolt.DB
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type foodCacheEntry struct {
+	Key      string                `json:"key"`
+	StoredAt time.Time             `json:"stored_at"`
+	Result   *models.FoodAPIResult `json:"result"`
+}
+
+func NewFoodCache(provider FoodProvider, cfg FoodCacheConfig) (*FoodCache, error) {
+	if cfg.Size <= 0 {
+		cfg.Size = defaultFoodCacheSize
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultFoodCacheTTL
+	}
+
+	fc := &FoodCache{
+		provider: provider,
+		size:     cfg.Size,
+		ttl:      cfg.TTL,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+
+	if cfg.Path != "" {
+		db, err := bolt.Open(cfg.Path, 0600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open food cache store: %w", err)
+		}
+		if err := db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(foodCacheBucket)
+			return err
+		}); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to initialise food cache store: %w", err)
+		}
+		fc.db = db
+	}
+
+	return fc, nil
+}
+
+// NormalizeFoodName builds the cache key for a food name
+func NormalizeFoodName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// SearchFood returns the cached search result for foodName, fetching and storing it on
+// a miss. The boolean reports whether the result came from the cache.
+func (fc *FoodCache) SearchFood(ctx context.Context, foodName string) (*models.FoodAPIResult, bool, error) {
+	key := NormalizeFoodName(foodName)
+
+	if result, ok := fc.get(key); ok {
+		fc.hits.Add(1)
+		return result, true, nil
+	}
+	fc.misses.Add(1)
+
+	result, err := fc.provider.SearchFood(ctx, foodName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Only cache useful answers so a transient empty or provisional result is retried
+	// next time
+	if result != nil && len(result.Foods) > 0 && !result.Provisional {
+		fc.put(key, result)
+	}
+
+	return result, false, nil
+}
+
+// CachedFoods returns the best match of every fresh search held in memory, keyed by
+// the search name. The foods are copies and safe to modify.
+func (fc *FoodCache) CachedFoods() map[string]*models.Food {
+	fc.mu.Lock()
+	results := make(map[string]*models.FoodAPIResult, len(fc.items))
+	for key, elem := range fc.items {
+		entry := elem.Value.(*foodCacheEntry)
+		if time.Since(entry.StoredAt) < fc.ttl && entry.Result != nil && len(entry.Result.Foods) > 0 {
+			results[key] = entry.Result
+		}
+	}
+	fc.mu.Unlock()
+
+	foods := make(map[string]*models.Food, len(results))
+	for key, result := range results {
+		foods[key] = SelectBestFood(key, result.Foods)
+	}
+	return foods
+}
+
+// Stats returns the lifetime hit and miss counts
+func (fc *FoodCache) Stats() (hits, misses int64) {
+	return fc.hits.Load(), fc.misses.Load()
+}
+
+// Close releases the persistent store, if any
+func (fc *FoodCache) Close() error {
+	if fc.db == nil {
+		return nil
+	}
+	return fc.db.Close()
+}
+
+func (fc *FoodCache) get(key string) (*models.FoodAPIResult, bool) {
+	fc.mu.Lock()
+	if elem, ok := fc.items[key]; ok {
+		entry := elem.Value.(*foodCacheEntry)
+		if time.Since(entry.StoredAt) < fc.ttl {
+			fc.order.MoveToFront(elem)
+			fc.mu.Unlock()
+			return entry.Result, true
+		}
+		fc.order.Remove(elem)
+		delete(fc.items, key)
+	}
+	fc.mu.Unlock()
+
+	entry, ok := fc.loadFromStore(key)
+	if !ok || time.Since(entry.StoredAt) >= fc.ttl {
+		return nil, false
+	}
+
+	fc.mu.Lock()
+	fc.insert(entry)
+	fc.mu.Unlock()
+
+	return entry.Result, true
+}
+
+func (fc *FoodCache) put(key string, result *models.FoodAPIResult) {
+	entry := &foodCacheEntry{Key: key, StoredAt: time.Now(), Result: result}
+
+	fc.mu.Lock()
+	fc.insert(entry)
+	fc.mu.Unlock()
+
+	fc.saveToStore(entry)
+}
+
+// insert adds entry to the LRU; callers must hold fc.mu
+func (fc *FoodCache) insert(entry *foodCacheEntry) {
+	if elem, ok := fc.items[entry.Key]; ok {
+		elem.Value = entry
+		fc.order.MoveToFront(elem)
+		return
+	}
+
+	fc.items[entry.Key] = fc.order.PushFront(entry)
+	for fc.order.Len() > fc.size {
+		oldest := fc.order.Back()
+		fc.order.Remove(oldest)
+		delete(fc.items, oldest.Value.(*foodCacheEntry).Key)
+	}
+}
+
+func (fc *FoodCache) loadFromStore(key string) (*foodCacheEntry, bool) {
+	if fc.db == nil {
+		return nil, false
+	}
+
+	var entry foodCacheEntry
+	found := false
+	err := fc.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(foodCacheBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &entry)
+	})
+	if err != nil {
+		log.Printf("Food cache: failed to read %q: %v", key, err)
+		return nil, false
+	}
+
+	return &entry, found
+}
+
+func (fc *FoodCache) saveToStore(entry *foodCacheEntry) {
+	if fc.db == nil {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Food cache: failed to encode %q: %v", entry.Key, err)
+		return
+	}
+
+	if err := fc.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(foodCacheBucket).Put([]byte(entry.Key), data)
+	}); err != nil {
+		log.Printf("Food cache: failed to persist %q: %v", entry.Key, err)
+	}
+}
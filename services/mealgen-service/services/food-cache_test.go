@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// stubFoodProvider answers every search with one food named after the query and counts
+// the searches per name
+type stubFoodProvider struct {
+	mu       sync.Mutex
+	searches map[string]int
+	empty    bool // Answer with no foods
+}
+
+func (sp *stubFoodProvider) Name() string { return "stub" }
+
+func (sp *stubFoodProvider) SearchFood(ctx context.Context, foodName string) (*models.FoodAPIResult, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.searches == nil {
+		sp.searches = make(map[string]int)
+	}
+	sp.searches[foodName]++
+
+	result := &models.FoodAPIResult{ProviderName: sp.Name(), SearchTag: foodName}
+	if !sp.empty {
+		result.Foods = []models.Food{{FoodID: foodName, FoodName: foodName}}
+	}
+	return result, nil
+}
+
+func (sp *stubFoodProvider) count(foodName string) int {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.searches[foodName]
+}
+
+// fixedFoodProvider answers every search with the same result
+type fixedFoodProvider struct {
+	result *models.FoodAPIResult
+}
+
+func (fp fixedFoodProvider) Name() string { return "fixed" }
+
+func (fp fixedFoodProvider) SearchFood(ctx context.Context, foodName string) (*models.FoodAPIResult, error) {
+	return fp.result, nil
+}
+
+func newTestFoodCache(t *testing.T, provider FoodProvider, cfg FoodCacheConfig) *FoodCache {
+	t.Helper()
+	fc, err := NewFoodCache(provider, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fc.Close() })
+	return fc
+}
+
+func search(t *testing.T, fc *FoodCache, name string) bool {
+	t.Helper()
+	result, cached, err := fc.SearchFood(context.Background(), name)
+	if err != nil {
+		t.Fatalf("SearchFood(%q): %v", name, err)
+	}
+	if len(result.Foods) > 0 && result.Foods[0].FoodName != name {
+		t.Fatalf("SearchFood(%q) returned %q", name, result.Foods[0].FoodName)
+	}
+	return cached
+}
+
+func TestFoodCacheHitsNormalisedNames(t *testing.T) {
+	provider := &stubFoodProvider{}
+	fc := newTestFoodCache(t, provider, FoodCacheConfig{Size: 10, TTL: time.Hour})
+
+	if search(t, fc, "chicken breast") {
+		t.Error("first search came from the cache")
+	}
+	result, cached, err := fc.SearchFood(context.Background(), "  Chicken   BREAST ")
+	if err != nil || !cached || result.Foods[0].FoodName != "chicken breast" {
+		t.Errorf("normalised search = %v, cached %v, %v; want the cached result", result, cached, err)
+	}
+	if hits, misses := fc.Stats(); hits != 1 || misses != 1 {
+		t.Errorf("stats = %d hits, %d misses; want 1 and 1", hits, misses)
+	}
+}
+
+func TestFoodCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	provider := &stubFoodProvider{}
+	fc := newTestFoodCache(t, provider, FoodCacheConfig{Size: 2, TTL: time.Hour})
+
+	search(t, fc, "apple")
+	search(t, fc, "banana")
+	search(t, fc, "apple") // apple is now the most recent
+	search(t, fc, "cherry")
+
+	if !search(t, fc, "apple") {
+		t.Error("apple was evicted although it was used recently")
+	}
+	if search(t, fc, "banana") {
+		t.Error("banana was kept although it was the least recently used")
+	}
+	if got := provider.count("banana"); got != 2 {
+		t.Errorf("banana searched %d times, want 2", got)
+	}
+}
+
+func TestFoodCacheExpiresEntries(t *testing.T) {
+	provider := &stubFoodProvider{}
+	fc := newTestFoodCache(t, provider, FoodCacheConfig{Size: 10, TTL: time.Hour})
+
+	search(t, fc, "oats")
+	fc.mu.Lock()
+	fc.items["oats"].Value.(*foodCacheEntry).StoredAt = time.Now().Add(-2 * time.Hour)
+	fc.mu.Unlock()
+
+	if search(t, fc, "oats") {
+		t.Error("an expired entry was served")
+	}
+	if got := provider.count("oats"); got != 2 {
+		t.Errorf("oats searched %d times, want 2", got)
+	}
+}
+
+func TestFoodCacheSkipsEmptyAndProvisionalResults(t *testing.T) {
+	provider := &stubFoodProvider{empty: true}
+	fc := newTestFoodCache(t, provider, FoodCacheConfig{Size: 10, TTL: time.Hour})
+
+	search(t, fc, "dragonfruit")
+	if search(t, fc, "dragonfruit") {
+		t.Error("an empty result was cached")
+	}
+
+	weak := &models.FoodAPIResult{Foods: []models.Food{{FoodName: "lychee"}}, Provisional: true}
+	fc = newTestFoodCache(t, fixedFoodProvider{weak}, FoodCacheConfig{Size: 10, TTL: time.Hour})
+	fc.SearchFood(context.Background(), "lychee")
+	if _, cached, _ := fc.SearchFood(context.Background(), "lychee"); cached {
+		t.Error("a provisional result was cached")
+	}
+}
+
+func TestFoodCacheReloadsFromStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "food-cache.db")
+	provider := &stubFoodProvider{}
+
+	fc, err := NewFoodCache(provider, FoodCacheConfig{Size: 10, TTL: time.Hour, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	search(t, fc, "salmon")
+	if err := fc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := newTestFoodCache(t, provider, FoodCacheConfig{Size: 10, TTL: time.Hour, Path: path})
+	if !search(t, reopened, "salmon") {
+		t.Error("a stored result was not reloaded after a restart")
+	}
+	if got := provider.count("salmon"); got != 1 {
+		t.Errorf("salmon searched %d times, want 1", got)
+	}
+
+	// A stored result older than the TTL is fetched again
+	reopened.Close()
+	expired := newTestFoodCache(t, provider, FoodCacheConfig{Size: 10, TTL: time.Nanosecond, Path: path})
+	if search(t, expired, "salmon") {
+		t.Error("an expired stored result was served")
+	}
+}
+
+func TestFoodCacheCachedFoods(t *testing.T) {
+	provider := &stubFoodProvider{}
+	fc := newTestFoodCache(t, provider, FoodCacheConfig{Size: 10, TTL: time.Hour})
+
+	search(t, fc, "tofu")
+	search(t, fc, "lentils")
+
+	foods := fc.CachedFoods()
+	if len(foods) != 2 || foods["tofu"] == nil || foods["lentils"] == nil {
+		t.Fatalf("CachedFoods = %v, want tofu and lentils", foods)
+	}
+	if foods["tofu"].Match == nil || foods["tofu"].Match.Query != "tofu" {
+		t.Errorf("tofu match = %+v, want the search name as query", foods["tofu"].Match)
+	}
+
+	// The foods are copies
+	foods["tofu"].FoodName = "changed"
+	if again := fc.CachedFoods(); again["tofu"].FoodName != "tofu" {
+		t.Error("changing a returned food changed the cache")
+	}
+}
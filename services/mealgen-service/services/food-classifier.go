@@ -0,0 +1,318 @@
+package services
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Food classes
+const (
+	ClassProtein        = "protein"
+	ClassStarchyCarb    = "starchy_carb"
+	ClassFruitVegetable = "fruit_vegetable"
+	ClassFat            = "fat"
+	ClassDairy          = "dairy"
+	ClassMixed          = "mixed"
+)
+
+// Classification sources
+const (
+	SourceOverride = "override"
+	SourceMacros   = "macros"
+	SourceAlias    = "alias"
+	SourceUnknown  = "unknown"
+)
+
+// Thresholds for the macro split, per 100 g and as shares of macro energy
+const (
+	produceMaxCalories = 60.0 // Below this a food is produce unless it is protein-rich
+	produceMaxProtein  = 5.0  // Grams of protein that make a low-energy food a protein
+	fatShare           = 0.6
+	proteinShare       = 0.4
+	starchMinCarbs     = 15.0 // Grams of carbs a starchy food has at least
+	sugarCarbShare     = 0.4  // Sugar as a share of carbs from which carbs count as fruit
+	carbMaxFatShare    = 0.3  // Fat share from which carb-dominant foods are mixed, e.g. pizza
+	pureFatShare       = 0.9  // Fat share of oils, butter and other pure fats
+)
+
+//go:embed food-classes.yaml
+var defaultFoodClasses []byte
+
+var foodClasses = []string{ClassProtein, ClassStarchyCarb, ClassFruitVegetable, ClassFat, ClassDairy, ClassMixed}
+
+// FoodClassification is a food's class and how it was decided
+type FoodClassification struct {
+	Class   string
+	Source  string
+	Per100g models.MacroTarget // Zero when the macros are unknown
+}
+
+// FatShare is the share of macro energy that comes from fat
+func (c FoodClassification) FatShare() float64 {
+	return macroShares(c.Per100g)[2]
+}
+
+// PureFat reports whether nearly all the food's energy is fat, as for oils and butter
+func (c FoodClassification) PureFat() bool {
+	return c.FatShare() >= pureFatShare
+}
+
+type classAlias struct {
+	words string // Padded, as matched against paddedWords
+	class string
+}
+
+// FoodClassifier labels foods by their macros per 100 g, backed by an alias table for
+// names whose macros are unknown or mislead
+type FoodClassifier struct {
+	overrides []classAlias // Longest first
+	aliases   []classAlias // Longest first
+	except    []string
+}
+
+type foodClassFile struct {
+	Overrides map[string][]string `yaml:"overrides"`
+	Aliases   map[string][]string `yaml:"aliases"`
+	Except    []string            `yaml:"except"`
+}
+
+// LoadFoodClassifier builds the classifier from the built-in alias table, with the
+// file at path, when given, merged on top. An alias in the file replaces the built-in
+// class for the same name.
+func LoadFoodClassifier(path string) (*FoodClassifier, error) {
+	var base foodClassFile
+	if err := yaml.Unmarshal(defaultFoodClasses, &base); err != nil {
+		return nil, fmt.Errorf("failed to parse built-in food classes: %w", err)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read food classes: %w", err)
+		}
+		var extra foodClassFile
+		if err := yaml.Unmarshal(data, &extra); err != nil {
+			return nil, fmt.Errorf("%s: failed to parse food classes: %w", path, err)
+		}
+		base.Except = append(base.Except, extra.Except...)
+		base.Overrides = mergeClassAliases(base.Overrides, extra.Overrides)
+		base.Aliases = mergeClassAliases(base.Aliases, extra.Aliases)
+	}
+
+	overrides, err := classAliases(base.Overrides)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := classAliases(base.Aliases)
+	if err != nil {
+		return nil, err
+	}
+	fc := &FoodClassifier{overrides: overrides, aliases: aliases}
+	for _, phrase := range base.Except {
+		if words := paddedWords(phrase); strings.TrimSpace(words) != "" {
+			fc.except = append(fc.except, words)
+		}
+	}
+	return fc, nil
+}
+
+// mergeClassAliases adds extra to base, moving any name extra lists to its new class
+func mergeClassAliases(base, extra map[string][]string) map[string][]string {
+	moved := make(map[string]bool)
+	for _, names := range extra {
+		for _, name := range names {
+			moved[paddedWords(name)] = true
+		}
+	}
+	merged := make(map[string][]string, len(base)+len(extra))
+	for class, names := range base {
+		for _, name := range names {
+			if !moved[paddedWords(name)] {
+				merged[class] = append(merged[class], name)
+			}
+		}
+	}
+	for class, names := range extra {
+		merged[class] = append(merged[class], names...)
+	}
+	return merged
+}
+
+func classAliases(byClass map[string][]string) ([]classAlias, error) {
+	var aliases []classAlias
+	for class, names := range byClass {
+		if !isFoodClass(class) {
+			return nil, fmt.Errorf("unknown food class %q (want one of %s)", class, strings.Join(foodClasses, ", "))
+		}
+		for _, name := range names {
+			if words := paddedWords(name); strings.TrimSpace(words) != "" {
+				aliases = append(aliases, classAlias{words: words, class: class})
+			}
+		}
+	}
+	// Longest first so the most specific alias wins; ties broken by name so the order
+	// does not depend on map iteration
+	sort.Slice(aliases, func(i, j int) bool {
+		if len(aliases[i].words) != len(aliases[j].words) {
+			return len(aliases[i].words) > len(aliases[j].words)
+		}
+		return aliases[i].words < aliases[j].words
+	})
+	return aliases, nil
+}
+
+func isFoodClass(class string) bool {
+	for _, c := range foodClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify labels a resolved food. An override for the food's head noun wins, then the
+// macro split of the first serving, then the alias table; a food none of these place is
+// mixed.
+func (fc *FoodClassifier) Classify(food models.Food) FoodClassification {
+	per100g, known := nutrientsPer100g(food)
+	result := FoodClassification{Class: ClassMixed, Source: SourceUnknown}
+	if known {
+		result.Per100g = per100g.Macros()
+	}
+
+	if fc == nil {
+		fc = &FoodClassifier{}
+	}
+	head := fc.without(headPhrase(food.FoodName))
+	if class, ok := matchHeadAlias(head, fc.overrides); ok {
+		result.Class, result.Source = class, SourceOverride
+		return result
+	}
+	if known {
+		result.Class, result.Source = classifyMacros(per100g), SourceMacros
+		return result
+	}
+	if class, ok := fc.matchAlias(food.FoodName, head); ok {
+		result.Class, result.Source = class, SourceAlias
+	}
+	return result
+}
+
+// ClassifyName labels a food by name alone, for names that are not yet resolved
+func (fc *FoodClassifier) ClassifyName(name string) (string, bool) {
+	if fc == nil {
+		return "", false
+	}
+	head := fc.without(headPhrase(name))
+	if class, ok := matchHeadAlias(head, fc.overrides); ok {
+		return class, true
+	}
+	return fc.matchAlias(name, head)
+}
+
+// matchAlias prefers an alias for the head noun, so "orange chicken" is chicken, then
+// falls back to any alias in the name
+func (fc *FoodClassifier) matchAlias(name, head string) (string, bool) {
+	if class, ok := matchHeadAlias(head, fc.aliases); ok {
+		return class, true
+	}
+	words := fc.without(paddedWords(name))
+	for _, alias := range fc.aliases {
+		if containsWord(words, strings.TrimSpace(alias.words)) {
+			return alias.class, true
+		}
+	}
+	return "", false
+}
+
+// without removes the except phrases from padded words
+func (fc *FoodClassifier) without(words string) string {
+	for _, phrase := range fc.except {
+		words = strings.ReplaceAll(words, phrase, " ")
+	}
+	return words
+}
+
+// matchHeadAlias finds the alias that is the head noun of the head phrase, so an
+// override for "egg" covers "scrambled eggs" but not "egg noodles"
+func matchHeadAlias(head string, aliases []classAlias) (string, bool) {
+	for _, alias := range aliases {
+		if isHeadNoun(head, strings.TrimSpace(alias.words)) {
+			return alias.class, true
+		}
+	}
+	return "", false
+}
+
+// nutrientsPer100g scales the first serving's nutrients to 100 g. It fails when the
+// macros are missing or the serving cannot be weighed.
+func nutrientsPer100g(food models.Food) (models.NutrientVector, bool) {
+	if len(food.Servings) == 0 {
+		return models.NutrientVector{}, false
+	}
+	serving := food.Servings[0]
+	nutrients := serving.Nutrients()
+	for _, n := range []models.Nutrient{models.NutrientProtein, models.NutrientCarbohydrate, models.NutrientFat} {
+		if !nutrients.Known(n) {
+			return models.NutrientVector{}, false
+		}
+	}
+	grams, accuracy := ServingGrams(food.FoodName, serving)
+	if grams <= 0 || accuracy == GramsGuess {
+		return models.NutrientVector{}, false
+	}
+	per100g := nutrients.Scale(100 / grams)
+	if macroEnergy(per100g.Macros()) <= 0 {
+		return models.NutrientVector{}, false
+	}
+	return per100g, true
+}
+
+// classifyMacros splits foods by where their energy comes from
+func classifyMacros(per100g models.NutrientVector) string {
+	m := per100g.Macros()
+	shares := macroShares(m)
+	protein, carbs, fat := shares[0], shares[1], shares[2]
+	calories := m.Calories
+	if calories <= 0 {
+		calories = macroEnergy(m)
+	}
+
+	switch {
+	case calories < produceMaxCalories && m.Proteins < produceMaxProtein:
+		return ClassFruitVegetable
+	case fat >= fatShare:
+		return ClassFat
+	case protein >= proteinShare:
+		return ClassProtein
+	case carbs <= protein || carbs <= fat || fat >= carbMaxFatShare:
+		return ClassMixed
+	}
+
+	// Carb-dominant: sugary foods are fruit and dense carbs are starch
+	if sugar, ok := per100g.Get(models.NutrientSugar); ok && sugar >= sugarCarbShare*m.Carbs {
+		return ClassFruitVegetable
+	}
+	if m.Carbs >= starchMinCarbs {
+		return ClassStarchyCarb
+	}
+	return ClassFruitVegetable
+}
+
+// macroShares returns the share of macro energy from protein, carbs and fat
+func macroShares(m models.MacroTarget) [3]float64 {
+	total := macroEnergy(m)
+	if total <= 0 {
+		return [3]float64{}
+	}
+	return [3]float64{4 * m.Proteins / total, 4 * m.Carbs / total, 9 * m.Fats / total}
+}
+
+func macroEnergy(m models.MacroTarget) float64 {
+	return 4*m.Proteins + 4*m.Carbs + 9*m.Fats
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// foodPer100g builds a food with one 100 g serving of the given macros
+func foodPer100g(name string, calories, protein, carbs, fat float64) models.Food {
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return models.Food{
+		FoodName: name,
+		Servings: []models.Serving{{
+			ServingDescription:     "100 g",
+			MeasurementDescription: "g",
+			MetricServingAmount:    "100",
+			MetricServingUnit:      "g",
+			NumberOfUnits:          "100",
+			Calories:               format(calories),
+			Protein:                format(protein),
+			Carbohydrate:           format(carbs),
+			Fat:                    format(fat),
+		}},
+	}
+}
+
+func TestClassifyAppliesOverridesToHeadNoun(t *testing.T) {
+	classifier, err := LoadFoodClassifier("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		food   models.Food
+		class  string
+		source string
+	}{
+		{foodPer100g("Egg Noodles", 138, 4.5, 25, 2.1), ClassStarchyCarb, SourceMacros},
+		{foodPer100g("Egg Fried Rice", 163, 4.7, 22, 6.2), ClassMixed, SourceMacros},
+		{foodPer100g("Macaroni and Cheese", 164, 6.4, 20, 6.6), ClassMixed, SourceMacros},
+		{foodPer100g("Cheese Pizza", 266, 11.4, 33, 10), ClassMixed, SourceMacros},
+		{foodPer100g("Milk Chocolate", 535, 7.6, 59, 30), ClassMixed, SourceMacros},
+		{foodPer100g("Eggs, whole, cooked, hard-boiled", 155, 12.6, 1.1, 10.6), ClassProtein, SourceOverride},
+		{foodPer100g("Scrambled eggs", 148, 10, 1.6, 11), ClassProtein, SourceOverride},
+		{foodPer100g("Cheese, cheddar", 403, 25, 1.3, 33), ClassDairy, SourceOverride},
+		{foodPer100g("Greek yogurt with honey", 120, 8, 16, 2.5), ClassDairy, SourceOverride},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.food.FoodName, func(t *testing.T) {
+			got := classifier.Classify(tt.food)
+			if got.Class != tt.class || got.Source != tt.source {
+				t.Errorf("Classify(%q) = %s from %s; want %s from %s", tt.food.FoodName, got.Class, got.Source, tt.class, tt.source)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// Score weights for ranking food search candidates
+const (
+	matchNameWeight        = 0.55
+	matchGenericWeight     = 0.15
+	matchGramServingWeight = 0.15
+	matchPreparationWeight = 0.15
+)
+
+var (
+	gramAmountPattern = regexp.MustCompile(`\b\d+(\.\d+)?\s*(g|grams?)\b`)
+	nonWordPattern    = regexp.MustCompile(`[^a-z0-9\s]+`)
+	rawWordPattern    = regexp.MustCompile(`\braw\b`)
+	bracketPattern    = regexp.MustCompile(`\([^)]*\)`)
+)
+
+var cookedHints = []string{"cooked", "grilled", "baked", "roasted", "boiled", "steamed", "broiled", "fried", "sauteed", "poached", "scrambled", "hard-boiled", "pan-seared"}
+
+// FoodQuery is an LLM food name split into searchable words and a preparation hint
+type FoodQuery struct {
+	Raw         string
+	Base        string   // name without amounts, brackets or preparation words
+	Tokens      []string // words of Base
+	Preparation string   // "cooked", "raw" or ""
+}
+
+// ParseFoodQuery strips gram amounts and (cooked)/(raw) annotations from an LLM food name
+func ParseFoodQuery(name string) FoodQuery {
+	q := FoodQuery{Raw: name}
+	lower := strings.ToLower(name)
+
+	q.Preparation = preparationOf(lower)
+
+	lower = gramAmountPattern.ReplaceAllString(lower, " ")
+	lower = nonWordPattern.ReplaceAllString(lower, " ")
+
+	for _, word := range strings.Fields(lower) {
+		if word == "raw" || word == "uncooked" || isCookedHint(word) {
+			continue
+		}
+		q.Tokens = append(q.Tokens, word)
+	}
+	q.Base = strings.Join(q.Tokens, " ")
+
+	return q
+}
+
+// ScoredFood is a search candidate with its ranking score
+type ScoredFood struct {
+	Food    models.Food
+	Score   float64
+	Reasons []string
+}
+
+// RankFoods scores every candidate against the query, best first
+func RankFoods(query string, foods []models.Food) []ScoredFood {
+	q := ParseFoodQuery(query)
+
+	scored := make([]ScoredFood, 0, len(foods))
+	for _, food := range foods {
+		scored = append(scored, scoreFood(q, food))
+	}
+
+	// Stable so the provider's own ordering breaks ties
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+
+	return scored
+}
+
+// SelectBestFood returns a copy of the highest ranked candidate with its match details
+// filled in, or nil when there are no candidates
+func SelectBestFood(query string, foods []models.Food) *models.Food {
+	ranked := RankFoods(query, foods)
+	if len(ranked) == 0 {
+		return nil
+	}
+
+	best := ranked[0]
+	food := best.Food
+	food.Match = &models.FoodMatch{
+		Query:      query,
+		Score:      math.Round(best.Score*1000) / 1000,
+		Reasons:    best.Reasons,
+		Candidates: len(foods),
+	}
+	return &food
+}
+
+// IsGramServing reports whether the serving is measured in plain grams
+func IsGramServing(serving models.Serving) bool {
+	description := strings.ToLower(serving.MeasurementDescription)
+	return description == "g" || description == "gram" || description == "grams"
+}
+
+func scoreFood(q FoodQuery, food models.Food) ScoredFood {
+	sf := ScoredFood{Food: food}
+	candidate := ParseFoodQuery(food.FoodName)
+
+	// Name similarity: Dice coefficient over words, so extra words like "jerky" or
+	// "sushi roll" pull the score down
+	similarity := diceSimilarity(q.Tokens, candidate.Tokens)
+	if q.Base != "" && q.Base == candidate.Base {
+		similarity = 1
+		sf.Reasons = append(sf.Reasons, "exact name match")
+	}
+	sf.Score += matchNameWeight * similarity
+
+	if isGenericFood(food) {
+		sf.Score += matchGenericWeight
+		sf.Reasons = append(sf.Reasons, "generic food")
+	}
+
+	for _, serving := range food.Servings {
+		if IsGramServing(serving) {
+			sf.Score += matchGramServingWeight
+			sf.Reasons = append(sf.Reasons, "gram serving available")
+			break
+		}
+	}
+
+	if q.Preparation != "" {
+		switch candidate.Preparation {
+		case q.Preparation:
+			sf.Score += matchPreparationWeight
+			sf.Reasons = append(sf.Reasons, q.Preparation+" form matches")
+		case "":
+			sf.Score += matchPreparationWeight / 2
+		default:
+			sf.Score -= matchPreparationWeight
+			sf.Reasons = append(sf.Reasons, "preparation mismatch: "+candidate.Preparation)
+		}
+	}
+
+	return sf
+}
+
+func isGenericFood(food models.Food) bool {
+	if food.BrandName != "" {
+		return false
+	}
+	foodType := strings.ToLower(food.FoodType)
+	return foodType == "" || foodType == "generic"
+}
+
+func preparationOf(lower string) string {
+	if strings.Contains(lower, "uncooked") || rawWordPattern.MatchString(lower) {
+		return "raw"
+	}
+	for _, hint := range cookedHints {
+		if strings.Contains(lower, hint) {
+			return "cooked"
+		}
+	}
+	return ""
+}
+
+func isCookedHint(word string) bool {
+	for _, hint := range cookedHints {
+		if word == hint {
+			return true
+		}
+	}
+	return false
+}
+
+func diceSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int, len(a))
+	for _, word := range a {
+		counts[singular(word)]++
+	}
+	shared := 0
+	for _, word := range b {
+		key := singular(word)
+		if counts[key] > 0 {
+			counts[key]--
+			shared++
+		}
+	}
+
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
+
+// headPhrase returns the padded words that name the food itself: the part before the
+// first comma, without brackets or a "with ..." accompaniment. A dish of several foods
+// joined by "and" has no single head, so its head phrase is empty.
+func headPhrase(name string) string {
+	first, _, _ := strings.Cut(bracketPattern.ReplaceAllString(strings.ToLower(name), " "), ",")
+	first, _, _ = strings.Cut(first, " with ")
+	words := paddedWords(first)
+	if strings.Contains(first, "&") || strings.Contains(words, " and ") {
+		return " "
+	}
+	return words
+}
+
+// isHeadNoun reports whether keyword is the head noun of a head phrase: its last word
+// ends the phrase, so "eggs" and "2 large eggs" are eggs but "egg noodles" and "orange
+// chicken" are not
+func isHeadNoun(head, keyword string) bool {
+	words := strings.Fields(head)
+	keywordWords := strings.Fields(keyword)
+	if len(words) == 0 || len(keywordWords) == 0 {
+		return false
+	}
+	return singular(words[len(words)-1]) == singular(keywordWords[len(keywordWords)-1]) && containsWord(head, keyword)
+}
+
+// singular is a cheap English singulariser good enough for food names
+func singular(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "oes") && len(word) > 4:
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"), strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "xes"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"):
+		return word
+	case strings.HasSuffix(word, "s") && len(word) > 3:
+		return word[:len(word)-1]
+	}
+	return word
+}
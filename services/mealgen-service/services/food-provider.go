@@ -0,0 +1,420 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+const (
+	defaultRemoteFoodTimeout = 10 * time.Second
+	defaultLocalFoodTimeout  = 2 * time.Second
+
+	// A provider that fails this many times in a row is skipped for the cooldown,
+	// then given one request to prove it has recovered
+	providerFailureThreshold = 3
+	providerCooldown         = 30 * time.Second
+
+	// Results whose best candidate shares less of its name with the query are kept
+	// only if no later provider does better
+	minProviderNameSimilarity = 0.2
+)
+
+// FoodProvider is a source of food composition data searched by food name
+type FoodProvider interface {
+	Name() string
+	SearchFood(ctx context.Context, foodName string) (*models.FoodAPIResult, error)
+}
+
+// BarcodeProvider is a FoodProvider that can also look products up by barcode
+type BarcodeProvider interface {
+	FoodProvider
+	SearchFoodByBarcode(ctx context.Context, barcode string, pageNumber int, maxResults int) (*models.FoodAPIResult, error)
+}
+
+// FoodProviderConfig configures the providers a FoodProviderChain tries, in order:
+// the local store, the food API and a second food API
+type FoodProviderConfig struct {
+	LocalDB      string
+	LocalTimeout time.Duration
+
+	APIKey     string
+	APIURL     string // Empty uses the default food API
+	APITimeout time.Duration
+
+	FallbackURL     string // Empty disables the second API
+	FallbackKey     string
+	FallbackTimeout time.Duration
+}
+
+// FoodProviderConfigFromEnv reads LOCAL_FOOD_DB, FOOD_API_KEY, FOOD_API_URL,
+// FOOD_API_FALLBACK_URL and FOOD_API_FALLBACK_KEY, with a *_TIMEOUT for each provider.
+// The second API uses FOOD_API_KEY unless it has its own key.
+func FoodProviderConfigFromEnv() FoodProviderConfig {
+	cfg := FoodProviderConfig{
+		LocalDB:         os.Getenv("LOCAL_FOOD_DB"),
+		LocalTimeout:    envDuration("LOCAL_FOOD_TIMEOUT", defaultLocalFoodTimeout),
+		APIKey:          os.Getenv("FOOD_API_KEY"),
+		APIURL:          os.Getenv("FOOD_API_URL"),
+		APITimeout:      envDuration("FOOD_API_TIMEOUT", defaultRemoteFoodTimeout),
+		FallbackURL:     os.Getenv("FOOD_API_FALLBACK_URL"),
+		FallbackKey:     os.Getenv("FOOD_API_FALLBACK_KEY"),
+		FallbackTimeout: envDuration("FOOD_API_FALLBACK_TIMEOUT", defaultRemoteFoodTimeout),
+	}
+	if cfg.FallbackKey == "" {
+		cfg.FallbackKey = cfg.APIKey
+	}
+	return cfg
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+// ProviderHealth is a snapshot of how one provider in a chain has been doing
+type ProviderHealth struct {
+	Name                string     `json:"name"`
+	Timeout             string     `json:"timeout"`
+	Available           bool       `json:"available"` // False while the provider is cooling down after repeated failures
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+}
+
+// providerLink is one provider in a chain with its timeout and health
+type providerLink struct {
+	provider FoodProvider
+	timeout  time.Duration
+
+	mu          sync.Mutex
+	requests    int64
+	failures    int64
+	consecutive int
+	lastError   string
+	lastSuccess time.Time
+	lastFailure time.Time
+	openUntil   time.Time
+	trial       bool // A request is checking whether the provider has recovered
+}
+
+// FoodProviderChain searches its providers in order. Each search is bounded by the
+// provider's own timeout, and a provider that keeps failing is skipped for a while.
+// Results name the provider that answered them.
+type FoodProviderChain struct {
+	links []*providerLink
+}
+
+// NewFoodProviderChain opens the configured providers. At least one of the local store
+// and the food API key is required.
+func NewFoodProviderChain(cfg FoodProviderConfig) (*FoodProviderChain, error) {
+	chain := &FoodProviderChain{}
+	if cfg.LocalDB != "" {
+		store, err := OpenLocalFoodStore(cfg.LocalDB)
+		if err != nil {
+			return nil, err
+		}
+		chain.Add(store, cfg.LocalTimeout)
+	}
+	if cfg.APIKey != "" {
+		api := NewFoodService(cfg.APIKey)
+		if cfg.APIURL != "" {
+			api = NewNamedFoodService(api.Name(), cfg.APIURL, cfg.APIKey)
+		}
+		chain.Add(api, cfg.APITimeout)
+	}
+	if cfg.FallbackURL != "" && cfg.FallbackKey != "" {
+		chain.Add(NewNamedFoodService(hostName(cfg.FallbackURL), cfg.FallbackURL, cfg.FallbackKey), cfg.FallbackTimeout)
+	}
+	if len(chain.links) == 0 {
+		return nil, errors.New("no food provider configured: set FOOD_API_KEY or LOCAL_FOOD_DB")
+	}
+	return chain, nil
+}
+
+// hostName names a provider after its URL's host
+func hostName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// Add appends a provider tried after those already in the chain. A zero timeout
+// leaves the search bounded only by the caller's context.
+func (pc *FoodProviderChain) Add(provider FoodProvider, timeout time.Duration) {
+	pc.links = append(pc.links, &providerLink{provider: provider, timeout: timeout})
+}
+
+func (pc *FoodProviderChain) Name() string {
+	names := make([]string, len(pc.links))
+	for i, link := range pc.links {
+		names[i] = link.provider.Name()
+	}
+	return strings.Join(names, ">")
+}
+
+// SearchFood returns the first result whose best candidate resembles foodName. A
+// provider that fails, finds nothing or only finds poor matches passes the search on;
+// when no provider does better, the best poor match is returned, marked Provisional
+// when some provider failed.
+func (pc *FoodProviderChain) SearchFood(ctx context.Context, foodName string) (*models.FoodAPIResult, error) {
+	var errs []error
+	var weak *models.FoodAPIResult
+	weakScore := -1.0
+	answered := false
+
+	for _, link := range pc.links {
+		if ctx.Err() != nil {
+			break
+		}
+		if !link.available() {
+			errs = append(errs, fmt.Errorf("%s: unavailable after %d failures", link.provider.Name(), providerFailureThreshold))
+			continue
+		}
+
+		result, err := link.search(ctx, func(ctx context.Context) (*models.FoodAPIResult, error) {
+			return link.provider.SearchFood(ctx, foodName)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", link.provider.Name(), err))
+			continue
+		}
+		answered = true
+		if result == nil || len(result.Foods) == 0 {
+			continue
+		}
+
+		score := bestNameSimilarity(foodName, result.Foods)
+		if score >= minProviderNameSimilarity {
+			return result, nil
+		}
+		if score > weakScore {
+			weak, weakScore = result, score
+		}
+	}
+
+	if weak != nil {
+		// A provider that failed might have matched better, so the poor match is only
+		// good for this request
+		if len(errs) > 0 {
+			provisional := *weak
+			provisional.Provisional = true
+			return &provisional, nil
+		}
+		return weak, nil
+	}
+	if !answered {
+		if len(errs) == 0 {
+			return nil, ctx.Err()
+		}
+		return nil, errors.Join(errs...)
+	}
+	// Every provider that answered found nothing
+	return &models.FoodAPIResult{ProviderName: pc.Name(), SearchTag: foodName, TotalResults: "0"}, nil
+}
+
+// SearchFoodByBarcode returns a page of the products with the barcode. The provider is
+// the first, in chain order, whose page 0 has products, and every page comes from it so
+// paging stays consistent. Failing providers are skipped as in SearchFood.
+func (pc *FoodProviderChain) SearchFoodByBarcode(ctx context.Context, barcode string, pageNumber int, maxResults int) (*models.FoodAPIResult, error) {
+	first, link, err := pc.barcodeProvider(ctx, barcode, maxResults)
+	if err != nil || link == nil || pageNumber == 0 {
+		return first, err
+	}
+
+	barcodes := link.provider.(BarcodeProvider)
+	result, err := link.search(ctx, func(ctx context.Context) (*models.FoodAPIResult, error) {
+		return barcodes.SearchFoodByBarcode(ctx, barcode, pageNumber, maxResults)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", link.provider.Name(), err)
+	}
+	if result == nil {
+		result = &models.FoodAPIResult{ProviderName: link.provider.Name(), SearchTag: barcode}
+	}
+	// A page past the end still reports how many products there are
+	if result.Total() == 0 {
+		result.TotalResults = first.TotalResults
+	}
+	return result, nil
+}
+
+// barcodeProvider asks each provider that supports barcodes for page 0 and returns the
+// first page with products and the provider that answered it. Without products the
+// link is nil and the page, when every provider could be asked, is empty.
+func (pc *FoodProviderChain) barcodeProvider(ctx context.Context, barcode string, maxResults int) (*models.FoodAPIResult, *providerLink, error) {
+	var errs []error
+	var empty *models.FoodAPIResult
+
+	for _, link := range pc.links {
+		barcodes, ok := link.provider.(BarcodeProvider)
+		if !ok {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if !link.available() {
+			errs = append(errs, fmt.Errorf("%s: unavailable after %d failures", link.provider.Name(), providerFailureThreshold))
+			continue
+		}
+
+		result, err := link.search(ctx, func(ctx context.Context) (*models.FoodAPIResult, error) {
+			return barcodes.SearchFoodByBarcode(ctx, barcode, 0, maxResults)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", link.provider.Name(), err))
+			continue
+		}
+		if result != nil && result.Total() > 0 {
+			return result, link, nil
+		}
+		if empty == nil {
+			empty = result
+		}
+	}
+
+	// Not found is only certain when every provider could be asked
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	if empty != nil {
+		return empty, nil, nil
+	}
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+	return &models.FoodAPIResult{ProviderName: pc.Name(), SearchTag: barcode, TotalResults: "0"}, nil, nil
+}
+
+// Health reports each provider's state, in chain order
+func (pc *FoodProviderChain) Health() []ProviderHealth {
+	health := make([]ProviderHealth, len(pc.links))
+	for i, link := range pc.links {
+		health[i] = link.health()
+	}
+	return health
+}
+
+// search runs one lookup against the provider within its timeout and records the outcome
+func (l *providerLink) search(ctx context.Context, lookup func(context.Context) (*models.FoodAPIResult, error)) (*models.FoodAPIResult, error) {
+	searchCtx := ctx
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+
+	result, err := lookup(searchCtx)
+	if err != nil {
+		// The caller giving up says nothing about the provider's health
+		if ctx.Err() != nil {
+			l.endTrial()
+			return nil, err
+		}
+		if searchCtx.Err() != nil {
+			err = fmt.Errorf("timed out after %s: %w", l.timeout, err)
+		}
+		l.record(err)
+		return nil, err
+	}
+	l.record(nil)
+
+	if result != nil {
+		// Stamp a copy so results shared with the provider are left alone
+		stamped := *result
+		stamped.ProviderName = l.provider.Name()
+		result = &stamped
+	}
+	return result, nil
+}
+
+// available reports whether the provider may be asked. Once the cooldown ends a single
+// request goes through as a trial; the others skip the provider until it answers, and
+// another failure restarts the cooldown.
+func (l *providerLink) available() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.consecutive < providerFailureThreshold {
+		return true
+	}
+	if l.trial || time.Now().Before(l.openUntil) {
+		return false
+	}
+	l.trial = true
+	return true
+}
+
+// endTrial lets another request try the provider when a trial ended without an answer
+func (l *providerLink) endTrial() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.trial = false
+}
+
+func (l *providerLink) record(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.trial = false
+	l.requests++
+	if err == nil {
+		l.consecutive = 0
+		l.lastSuccess = time.Now()
+		return
+	}
+	l.failures++
+	l.consecutive++
+	l.lastError = err.Error()
+	l.lastFailure = time.Now()
+	if l.consecutive >= providerFailureThreshold {
+		l.openUntil = l.lastFailure.Add(providerCooldown)
+	}
+}
+
+func (l *providerLink) health() ProviderHealth {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h := ProviderHealth{
+		Name:                l.provider.Name(),
+		Timeout:             l.timeout.String(),
+		Available:           l.consecutive < providerFailureThreshold || (!l.trial && time.Now().After(l.openUntil)),
+		Requests:            l.requests,
+		Failures:            l.failures,
+		ConsecutiveFailures: l.consecutive,
+		LastError:           l.lastError,
+	}
+	if !l.lastSuccess.IsZero() {
+		t := l.lastSuccess
+		h.LastSuccess = &t
+	}
+	if !l.lastFailure.IsZero() {
+		t := l.lastFailure
+		h.LastFailure = &t
+	}
+	return h
+}
+
+// bestNameSimilarity is the word overlap between the query and its closest candidate
+func bestNameSimilarity(query string, foods []models.Food) float64 {
+	q := ParseFoodQuery(query)
+	best := 0.0
+	for _, food := range foods {
+		best = max(best, diceSimilarity(q.Tokens, ParseFoodQuery(food.FoodName).Tokens))
+	}
+	return best
+}
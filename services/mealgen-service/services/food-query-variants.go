@@ -0,0 +1,82 @@
+package services
+
+import (
+	"sort"
+	"strings"
+)
+
+// foodSynonyms maps names the LLM likes to the ones food databases use. Keys and
+// values are singular, and no value contains a key.
+var foodSynonyms = map[string]string{
+	"aubergine":      "eggplant",
+	"bell pepper":    "sweet pepper",
+	"capsicum":       "sweet pepper",
+	"chickpea":       "garbanzo bean",
+	"coriander leaf": "cilantro",
+	"courgette":      "zucchini",
+	"green onion":    "scallion",
+	"minced beef":    "ground beef",
+	"mince":          "ground beef",
+	"oatmeal":        "oat",
+	"porridge":       "oat",
+	"prawn":          "shrimp",
+	"rocket":         "arugula",
+	"spring onion":   "scallion",
+	"swede":          "rutabaga",
+	"yoghurt":        "yogurt",
+	"wholemeal":      "whole grain",
+}
+
+// foodSynonymKeys lists the synonyms longest first, so a phrase is replaced before
+// any word inside it
+var foodSynonymKeys = func() []string {
+	keys := make([]string, 0, len(foodSynonyms))
+	for key := range foodSynonyms {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}()
+
+// FoodQueryVariants rewrites a food name that found nothing into simpler searches, most
+// faithful first: without amounts, brackets and preparation words, then singular, then
+// with the synonyms food databases use. The name itself is not included.
+func FoodQueryVariants(name string) []string {
+	q := ParseFoodQuery(name)
+
+	seen := map[string]bool{NormalizeFoodName(name): true}
+	var variants []string
+	add := func(variant string) {
+		variant = NormalizeFoodName(variant)
+		if variant != "" && !seen[variant] {
+			seen[variant] = true
+			variants = append(variants, variant)
+		}
+	}
+
+	singularWords := make([]string, len(q.Tokens))
+	for i, word := range q.Tokens {
+		singularWords[i] = singular(word)
+	}
+	singularBase := strings.Join(singularWords, " ")
+
+	add(q.Base)
+	add(singularBase)
+	add(applyFoodSynonyms(singularBase))
+	add(applyFoodSynonyms(q.Base))
+	return variants
+}
+
+// applyFoodSynonyms replaces every whole-word synonym in a lowercase name
+func applyFoodSynonyms(name string) string {
+	padded := " " + name + " "
+	for _, key := range foodSynonymKeys {
+		padded = strings.ReplaceAll(padded, " "+key+" ", " "+foodSynonyms[key]+" ")
+	}
+	return strings.TrimSpace(padded)
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// MissingFood is a meal food no food provider could find, with its class when the name
+// gives it away
+type MissingFood struct {
+	Name  string
+	Class string
+}
+
+// ReplaceMissingFoods asks the LLM for one common food to stand in for each missing
+// food, from the same class and within the profile's exclusions. Foods in avoid are not
+// suggested. The result maps each missing name to its replacement; names the LLM gave
+// no usable answer for are left out.
+func (gs *GeminiService) ReplaceMissingFoods(ctx context.Context, missing []MissingFood, profile *ComplianceProfile, avoid []string) (map[string]string, error) {
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	output, err := gs.generateStructured(ctx, buildReplacementPrompt(missing, profile, avoid), SchemaFor(models.FoodReplacementLLMResponse{}), "food_replacement")
+	if err != nil {
+		return nil, fmt.Errorf("error calling LLM provider %s for food replacements: %w", gs.llm.Name(), err)
+	}
+	if len(output.Problems) > 0 {
+		return nil, fmt.Errorf("food replacement output invalid: %s", strings.Join(output.Problems, "; "))
+	}
+
+	var response models.FoodReplacementLLMResponse
+	if err := json.Unmarshal([]byte(output.JSON), &response); err != nil {
+		return nil, fmt.Errorf("failed to parse food replacements: %w", err)
+	}
+
+	wanted := make(map[string]string, len(missing))
+	for _, food := range missing {
+		wanted[NormalizeFoodName(food.Name)] = food.Name
+	}
+	replacements := make(map[string]string, len(missing))
+	for _, item := range response.Replacements {
+		name, ok := wanted[NormalizeFoodName(item.Original)]
+		replacement := strings.TrimSpace(item.Replacement)
+		if !ok || replacement == "" || NormalizeFoodName(replacement) == NormalizeFoodName(name) {
+			continue
+		}
+		replacements[name] = replacement
+	}
+	return replacements, nil
+}
+
+func buildReplacementPrompt(missing []MissingFood, profile *ComplianceProfile, avoid []string) string {
+	prompt := "You are a professional nutritionist. These meal foods could not be found in a food composition database. "
+	prompt += "Replace each with one common, generic food that is widely listed in food databases and fills the same role in the meal.\n\n"
+
+	prompt += "FOODS TO REPLACE:\n"
+	for _, food := range missing {
+		if food.Class != "" {
+			prompt += fmt.Sprintf("- %s (replace with another %s food)\n", food.Name, className(food.Class))
+		} else {
+			prompt += fmt.Sprintf("- %s (replace with a food of the same kind)\n", food.Name)
+		}
+	}
+	prompt += "\n"
+
+	prompt += buildExclusionRules(profile)
+	if len(avoid) > 0 {
+		prompt += fmt.Sprintf("Do not suggest any of: %s\n\n", strings.Join(avoid, ", "))
+	}
+
+	prompt += "RULES:\n"
+	prompt += "- Use a plain food name without amounts, brands or cooking notes in brackets, e.g. \"brown rice\" not \"brown rice (cooked) 150g\"\n"
+	prompt += "- Keep \"original\" exactly as written above\n\n"
+	prompt += "Return ONLY a JSON object of the form {\"replacements\": [{\"original\": \"...\", \"replacement\": \"...\"}]}:"
+	return prompt
+}
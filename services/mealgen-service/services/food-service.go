@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,22 +14,33 @@ import (
 )
 
 type FoodService struct {
+	name    string
 	apiKey  string
 	baseURL string
 	client  *http.Client
 }
 
 func NewFoodService(apiKey string) *FoodService {
+	return NewNamedFoodService("studio93", "https://api.studio93.io/food/search", apiKey)
+}
+
+// NewNamedFoodService talks to a food API with the same interface at another URL
+func NewNamedFoodService(name, baseURL, apiKey string) *FoodService {
 	return &FoodService{
+		name:    name,
 		apiKey:  apiKey,
-		baseURL: "https://api.studio93.io/food/search",
+		baseURL: baseURL,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 	}
 }
 
-func (fs *FoodService) SearchFood(foodName string) (*models.FoodAPIResult, error) {
+func (fs *FoodService) Name() string {
+	return fs.name
+}
+
+func (fs *FoodService) SearchFood(ctx context.Context, foodName string) (*models.FoodAPIResult, error) {
 	// Build the request URL with query parameters
 	reqURL, err := url.Parse(fs.baseURL)
 	if err != nil {
@@ -43,7 +55,7 @@ func (fs *FoodService) SearchFood(foodName string) (*models.FoodAPIResult, error
 	reqURL.RawQuery = params.Encode()
 
 	// Create the HTTP request
-	req, err := http.NewRequest("GET", reqURL.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -85,7 +97,7 @@ func (fs *FoodService) SearchFood(foodName string) (*models.FoodAPIResult, error
 }
 
 // SearchFoodByBarcode searches for food items by barcode
-func (fs *FoodService) SearchFoodByBarcode(barcode string, pageNumber int, maxResults int) (*models.FoodAPIResult, error) {
+func (fs *FoodService) SearchFoodByBarcode(ctx context.Context, barcode string, pageNumber int, maxResults int) (*models.FoodAPIResult, error) {
 	// Build the request URL with query parameters
 	reqURL, err := url.Parse(fs.baseURL)
 	if err != nil {
@@ -100,7 +112,7 @@ func (fs *FoodService) SearchFoodByBarcode(barcode string, pageNumber int, maxRe
 	reqURL.RawQuery = params.Encode()
 
 	// Create the HTTP request
-	req, err := http.NewRequest("GET", reqURL.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"math"
+	"sort"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// swapCandidates are looked up for each class when the cache holds too few foods of
+// it, so a swap works on a cold cache
+var swapCandidates = map[string][]string{
+	ClassProtein:        append(append([]string(nil), proteinSubstitutes...), "Cod", "Tuna", "Shrimp", "Lean Ground Beef", "Pork Tenderloin", "Egg Whites"),
+	ClassStarchyCarb:    append(append([]string(nil), carbSubstitutes...), "Oats", "Whole Wheat Pasta", "Whole Wheat Bread", "Couscous", "Buckwheat", "Corn Tortilla"),
+	ClassFruitVegetable: {"Broccoli", "Spinach", "Zucchini", "Green Beans", "Asparagus", "Bell Pepper", "Cauliflower", "Apple", "Banana", "Blueberries", "Strawberries", "Orange"},
+	ClassFat:            append(append([]string(nil), fatSubstitutes...), "Almonds", "Walnuts", "Cashews", "Peanut Butter", "Chia Seeds"),
+	ClassDairy:          {"Greek Yogurt", "Cottage Cheese", "Skim Milk", "Skyr", "Mozzarella", "Cheddar Cheese"},
+}
+
+// SwapCandidateNames lists foods worth looking up as substitutes for a class
+func SwapCandidateNames(class string) []string {
+	return swapCandidates[class]
+}
+
+// RankedSwap is a substitute with its distance from the food it replaces
+type RankedSwap struct {
+	Food     models.Food
+	Distance float64
+}
+
+// RankSwaps keeps the candidates in the original's class that the profile allows and
+// orders them by how close their macro profile per 100 g is. Candidates named in
+// exclude (normalised), and the original itself, are skipped.
+func (fc *FoodClassifier) RankSwaps(original models.Food, candidates []models.Food, profile *ComplianceProfile, exclude map[string]bool) []RankedSwap {
+	target := fc.Classify(original)
+	originalKey := NormalizeFoodName(original.FoodName)
+
+	var ranked []RankedSwap
+	seen := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		key := NormalizeFoodName(candidate.FoodName)
+		if key == originalKey || exclude[key] || seen[key] || len(candidate.Servings) == 0 {
+			continue
+		}
+		seen[key] = true
+
+		class := fc.Classify(candidate)
+		if class.Class != target.Class || class.Source == SourceUnknown {
+			continue
+		}
+		if len(profile.FoodViolations(candidate)) > 0 {
+			continue
+		}
+		candidate.Category = class.Class
+		ranked = append(ranked, RankedSwap{Food: candidate, Distance: MacroDistance(target.Per100g, class.Per100g)})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Distance < ranked[j].Distance })
+	return ranked
+}
+
+// MacroDistance compares two macro profiles per 100 g by the share of energy each
+// macro supplies. Energy density is left out, since a swap is rescaled to the same
+// calories anyway. Zero is identical and the largest possible distance is √2.
+func MacroDistance(a, b models.MacroTarget) float64 {
+	sa, sb := macroShares(a), macroShares(b)
+	sum := 0.0
+	for i := range sa {
+		d := sa[i] - sb[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
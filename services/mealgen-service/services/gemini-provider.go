@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultGeminiModel   = "gemini-2.0-flash"
+	defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta/models"
+)
+
+// GeminiProvider talks to the Google Gemini generateContent API
+type GeminiProvider struct {
+	apiKey  string
+	model   string
+	baseURL string
+	client  *http.Client
+}
+
+type GeminiRequest struct {
+	Contents         []Content               `json:"contents"`
+	GenerationConfig *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type GeminiGenerationConfig struct {
+	ResponseMimeType string        `json:"responseMimeType,omitempty"`
+	ResponseSchema   *GeminiSchema `json:"responseSchema,omitempty"`
+}
+
+// GeminiSchema is Gemini's OpenAPI-style schema: upper-case types and no additionalProperties
+type GeminiSchema struct {
+	Type       string                   `json:"type"`
+	Properties map[string]*GeminiSchema `json:"properties,omitempty"`
+	Items      *GeminiSchema            `json:"items,omitempty"`
+	Required   []string                 `json:"required,omitempty"`
+}
+
+type Content struct {
+	Parts []Part `json:"parts"`
+}
+
+type Part struct {
+	Text string `json:"text"`
+}
+
+type GeminiResponse struct {
+	Candidates []Candidate `json:"candidates"`
+}
+
+type Candidate struct {
+	Content Content `json:"content"`
+}
+
+func NewGeminiProvider(apiKey, model, baseURL string) *GeminiProvider {
+	if model == "" {
+		model = defaultGeminiModel
+	}
+	if baseURL == "" {
+		baseURL = defaultGeminiBaseURL
+	}
+	return &GeminiProvider{
+		apiKey:  apiKey,
+		model:   model,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{},
+	}
+}
+
+func (gp *GeminiProvider) Name() string {
+	return LLMProviderGemini + "/" + gp.model
+}
+
+func (gp *GeminiProvider) Generate(ctx context.Context, llmReq LLMRequest) (string, error) {
+	requestBody := GeminiRequest{
+		Contents: []Content{
+			{
+				Parts: []Part{
+					{
+						Text: llmReq.Prompt,
+					},
+				},
+			},
+		},
+	}
+
+	if llmReq.Schema != nil {
+		requestBody.GenerationConfig = &GeminiGenerationConfig{ResponseMimeType: "application/json"}
+		if schema, ok := toGeminiSchema(llmReq.Schema); ok {
+			requestBody.GenerationConfig.ResponseSchema = schema
+		}
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/%s:generateContent?key=%s", gp.baseURL, gp.model, gp.apiKey)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := gp.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %v", err)
+	}
+
+	var response GeminiResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("error unmarshaling response: %v", err)
+	}
+
+	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("no candidates in response")
+	}
+
+	return response.Candidates[0].Content.Parts[0].Text, nil
+}
+
+// toGeminiSchema converts a JSONSchema to Gemini's format. It reports false when the
+// schema still contains a free-form map, which Gemini cannot express; the caller then
+// falls back to plain JSON mode.
+func toGeminiSchema(s *JSONSchema) (*GeminiSchema, bool) {
+	if s == nil {
+		return nil, true
+	}
+	if s.Type == "object" && s.AdditionalProperties != nil && len(s.Properties) == 0 {
+		return nil, false
+	}
+
+	gs := &GeminiSchema{Type: strings.ToUpper(s.Type), Required: s.Required}
+	if s.Items != nil {
+		items, ok := toGeminiSchema(s.Items)
+		if !ok {
+			return nil, false
+		}
+		gs.Items = items
+	}
+	if len(s.Properties) > 0 {
+		gs.Properties = make(map[string]*GeminiSchema, len(s.Properties))
+		for name, prop := range s.Properties {
+			converted, ok := toGeminiSchema(prop)
+			if !ok {
+				return nil, false
+			}
+			gs.Properties[name] = converted
+		}
+	}
+	return gs, true
+}
@@ -1,84 +1,162 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
 )
 
+// GeminiService builds meal prompts and parses the model output. Despite the name it
+// is not tied to Gemini: every call goes through the configured LLMProvider.
 type GeminiService struct {
-	apiKey      string
-	baseURL     string
-	client      *http.Client
-	foodService *FoodService
+	llm            LLMProvider
+	foodProvider   FoodProvider
+	repairAttempts int
+	healthRules    *HealthRuleSet
+	classifier     *FoodClassifier
 }
 
-type GeminiRequest struct {
-	Contents []Content `json:"contents"`
+func NewGeminiService(llm LLMProvider, foodProvider FoodProvider, repairAttempts int, healthRules *HealthRuleSet, classifier *FoodClassifier) *GeminiService {
+	return &GeminiService{
+		llm:            llm,
+		foodProvider:   foodProvider,
+		repairAttempts: repairAttempts,
+		healthRules:    healthRules,
+		classifier:     classifier,
+	}
 }
 
-type Content struct {
-	Parts []Part `json:"parts"`
+// structuredOutput is cleaned LLM output together with any schema problems left after
+// the repair attempts ran out
+type structuredOutput struct {
+	JSON     string
+	Problems []string
+	Attempts int
 }
 
-type Part struct {
-	Text string `json:"text"`
-}
+// maxRepairProblems caps how many validation errors are quoted back to the model
+const maxRepairProblems = 20
+
+// generateStructured prompts for JSON matching schema and validates the answer. Invalid
+// output is sent back to the model together with the validation errors, up to
+// gs.repairAttempts times.
+func (gs *GeminiService) generateStructured(ctx context.Context, prompt string, schema *JSONSchema, schemaName string) (structuredOutput, error) {
+	req := LLMRequest{Prompt: prompt, Schema: schema, SchemaName: schemaName}
+
+	var output structuredOutput
+	for attempt := 0; attempt <= gs.repairAttempts; attempt++ {
+		response, err := gs.llm.Generate(ctx, req)
+		if err != nil {
+			// A failed repair call still leaves the previous answer to fall back from
+			if attempt > 0 && ctx.Err() == nil {
+				log.Printf("LLM repair attempt %d for %s failed: %v", attempt, schemaName, err)
+				return output, nil
+			}
+			return output, err
+		}
 
-type GeminiResponse struct {
-	Candidates []Candidate `json:"candidates"`
-}
+		output.JSON = gs.cleanLLMResponse(response)
+		output.Problems = ValidateJSON([]byte(output.JSON), schema)
+		output.Attempts = attempt + 1
+		if len(output.Problems) == 0 {
+			return output, nil
+		}
+
+		log.Printf("LLM %s output failed schema validation (attempt %d of %d): %d problems",
+			schemaName, attempt+1, gs.repairAttempts+1, len(output.Problems))
+		req.Prompt = buildRepairPrompt(prompt, output.JSON, output.Problems)
+	}
 
-type Candidate struct {
-	Content Content `json:"content"`
+	return output, nil
 }
 
-func NewGeminiService(apiKey string, foodService *FoodService) *GeminiService {
-	return &GeminiService{
-		apiKey:      apiKey,
-		baseURL:     "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent",
-		client:      &http.Client{},
-		foodService: foodService,
+func buildRepairPrompt(originalPrompt, previous string, problems []string) string {
+	prompt := originalPrompt + "\n\n"
+	prompt += "YOUR PREVIOUS RESPONSE WAS INVALID:\n"
+	prompt += previous + "\n\n"
+	prompt += "VALIDATION ERRORS:\n"
+	for i, problem := range problems {
+		if i == maxRepairProblems {
+			prompt += fmt.Sprintf("- ... and %d more\n", len(problems)-maxRepairProblems)
+			break
+		}
+		prompt += "- " + problem + "\n"
 	}
+	prompt += "\nReturn ONLY the corrected JSON object, fixing every error above and keeping everything else unchanged:"
+	return prompt
 }
 
-func (gs *GeminiService) GenerateMeals(reqBody models.RequestBody) (*models.MealPlanLLMResponse, error) {
+// mealPlanSchema is the meal plan output schema with one required entry per date
+func mealPlanSchema(dates []string) *JSONSchema {
+	schema := SchemaFor(models.MealPlanLLMResponse{})
+	schema.Properties["data"] = schema.Properties["data"].WithMapKeys(dates)
+	return schema
+}
+
+func (gs *GeminiService) GenerateMeals(ctx context.Context, reqBody models.RequestBody) (*models.MealPlanLLMResponse, error) {
 	prompt := gs.buildMealPrompt(reqBody)
-	response, err := gs.prompt(prompt)
+	output, err := gs.generateStructured(ctx, prompt, mealPlanSchema(PlanDates(reqBody)), "meal_plan")
 	if err != nil {
-		return nil, fmt.Errorf("error calling Gemini API: %v", err)
+		return nil, fmt.Errorf("error calling LLM provider %s: %w", gs.llm.Name(), err)
+	}
+	return gs.parseMealResponse(output, reqBody)
+}
+
+// GenerateDay generates the plan for a single date. It is used to stream long plans
+// day by day instead of waiting for one large completion.
+func (gs *GeminiService) GenerateDay(ctx context.Context, reqBody models.RequestBody, date string) (*models.MealPlanLLMResponse, error) {
+	dayRequest := reqBody
+	dayRequest.Dates = []string{date}
+	return gs.GenerateMeals(ctx, dayRequest)
+}
+
+// PlanDates returns the dates a request covers in calendar order. Requests without
+// dates get seven placeholder days ("Day 1" .. "Day 7").
+func PlanDates(reqBody models.RequestBody) []string {
+	dates := append([]string(nil), reqBody.Dates...)
+	if len(dates) == 0 {
+		for i := 0; i < 7; i++ {
+			dates = append(dates, fmt.Sprintf("Day %d", i+1))
+		}
+		return dates
+	}
+
+	// Sort real calendar dates; leave free-form labels in the order given
+	parsed := make(map[string]time.Time, len(dates))
+	for _, date := range dates {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return dates
+		}
+		parsed[date] = t
 	}
-	return gs.parseMealResponse(response, reqBody)
+	sort.SliceStable(dates, func(i, j int) bool {
+		return parsed[dates[i]].Before(parsed[dates[j]])
+	})
+	return dates
 }
 
-func (gs *GeminiService) RegenerateMeal(reqBody models.RegenerationRequest) (*models.RegenerationLLMResponse, error) {
+func (gs *GeminiService) RegenerateMeal(ctx context.Context, reqBody models.RegenerationRequest) (*models.RegenerationLLMResponse, error) {
 	prompt := gs.buildRegenerationPrompt(reqBody)
-	response, err := gs.prompt(prompt)
+	output, err := gs.generateStructured(ctx, prompt, SchemaFor(models.RegenerationLLMResponse{}), "meal_regeneration")
 	if err != nil {
-		return nil, fmt.Errorf("error calling Gemini API for regeneration: %v", err)
+		return nil, fmt.Errorf("error calling LLM provider %s for regeneration: %w", gs.llm.Name(), err)
 	}
-	return gs.parseRegenerationResponse(response, reqBody)
+	return gs.parseRegenerationResponse(output, reqBody)
 }
 
 func (gs *GeminiService) buildMealPrompt(reqBody models.RequestBody) string {
 	prompt := "You are a professional nutritionist and meal planning expert. Create a comprehensive meal plan based on the user's requirements.\n\n"
 
 	// Generate dates if not provided (7 days from today)
-	dates := reqBody.Dates
-	if len(dates) == 0 {
-		for i := 0; i < 7; i++ {
-			date := fmt.Sprintf("Day %d", i+1)
-			dates = append(dates, date)
-		}
-	}
+	dates := PlanDates(reqBody)
 
 	// Parse meals per day
 	mealsPerDay := 3 // default
@@ -142,14 +220,22 @@ func (gs *GeminiService) buildMealPrompt(reqBody models.RequestBody) string {
 		reqBody.DailyFatsGoal/float64(mealsPerDay))
 	prompt += "\n"
 
+	prompt += reservationPromptRules(reqBody, dates, mealsPerDay)
+	prompt += pinnedFoodPromptRules(reqBody.PinnedFoods)
+
 	if len(reqBody.FoodAllergies) > 0 {
 		prompt += fmt.Sprintf("ALLERGIES/FOODS TO AVOID: %s\n\n", strings.Join(reqBody.FoodAllergies, ", "))
 	}
 
+	prompt += buildExclusionRules(NewComplianceProfile(reqBody.DietType, reqBody.FoodAllergies))
+
 	if len(reqBody.FoodLikes) > 0 {
 		prompt += fmt.Sprintf("FOOD PREFERENCES (LIKES): %s\n\n", strings.Join(reqBody.FoodLikes, ", "))
 	}
 
+	prompt += buildCuisineRules(reqBody.Cuisines)
+	prompt += buildKitchenRules(NewKitchenProfile(reqBody.KitchenTools))
+
 	if len(reqBody.SelectedLifeStages) > 0 {
 		prompt += fmt.Sprintf("LIFE STAGES: %s\n\n", strings.Join(reqBody.SelectedLifeStages, ", "))
 	}
@@ -158,6 +244,8 @@ func (gs *GeminiService) buildMealPrompt(reqBody models.RequestBody) string {
 		prompt += fmt.Sprintf("HEALTH CONDITIONS: %s\n\n", strings.Join(reqBody.SelectedHealthConditions, ", "))
 	}
 
+	prompt += buildHealthRules(gs.healthRules.ProfileFor(reqBody.SelectedHealthConditions, reqBody.SelectedLifeStages))
+
 	if len(reqBody.Supplements) > 0 {
 		prompt += fmt.Sprintf("SUPPLEMENTS: %s\n\n", strings.Join(reqBody.Supplements, ", "))
 	}
@@ -468,10 +556,22 @@ func (gs *GeminiService) buildRegenerationPrompt(reqBody models.RegenerationRequ
 	if len(reqBody.FoodsToAvoid) > 0 {
 		prompt += fmt.Sprintf("- Foods to Avoid: %s\n", strings.Join(reqBody.FoodsToAvoid, ", "))
 	}
+	if rules := buildExclusionRules(NewComplianceProfile(reqBody.DietType, reqBody.FoodsToAvoid)); rules != "" {
+		prompt += "\n" + strings.TrimSuffix(rules, "\n")
+	}
 
 	if len(reqBody.FoodsToLike) > 0 {
 		prompt += fmt.Sprintf("- Foods to Like: %s\n", strings.Join(reqBody.FoodsToLike, ", "))
 	}
+	if rules := buildCuisineRules(reqBody.Cuisines); rules != "" {
+		prompt += "\n" + strings.TrimSuffix(rules, "\n")
+	}
+	if rules := buildKitchenRules(NewKitchenProfile(reqBody.KitchenTools)); rules != "" {
+		prompt += "\n" + strings.TrimSuffix(rules, "\n")
+	}
+	if rules := buildHealthRules(gs.healthRules.ProfileFor(reqBody.HealthConditions, reqBody.LifePhases)); rules != "" {
+		prompt += "\n" + strings.TrimSuffix(rules, "\n")
+	}
 
 	// Original meal information with explicit macro targets
 	prompt += "\nORIGINAL MEAL TO REGENERATE:\n"
@@ -485,6 +585,9 @@ func (gs *GeminiService) buildRegenerationPrompt(reqBody models.RegenerationRequ
 	for _, food := range reqBody.OriginalMeal.Foods {
 		prompt += fmt.Sprintf("  * %s\n", food.FoodName)
 	}
+	if rules := pinnedFoodPromptRules(PinnedFoodsFor(reqBody.PinnedFoods, "", reqBody.OriginalMeal.MealName)); rules != "" {
+		prompt += "\n" + strings.TrimSuffix(rules, "\n")
+	}
 
 	// Regeneration instructions
 	if len(reqBody.FoodsToRegenerate) > 0 {
@@ -661,33 +764,50 @@ func (gs *GeminiService) buildRegenerationPrompt(reqBody models.RegenerationRequ
 	return prompt
 }
 
-func (gs *GeminiService) parseMealResponse(response string, reqBody models.RequestBody) (*models.MealPlanLLMResponse, error) {
-	// Clean the response first
-	cleanedResponse := gs.cleanLLMResponse(response)
+func (gs *GeminiService) parseMealResponse(output structuredOutput, reqBody models.RequestBody) (*models.MealPlanLLMResponse, error) {
+	// Only fall back to defaults when the output is still invalid after repairs
+	if len(output.Problems) > 0 {
+		log.Printf("Meal plan output invalid after %d attempts, using default meals", output.Attempts)
+		fallback := gs.setMacroTargets(*gs.createStructuredResponse(output.JSON, reqBody), reqBody)
+		fallback.ValidationErrors = output.Problems
+		return &fallback, nil
+	}
 
 	// Try to parse as JSON
 	var mealPlan models.MealPlanLLMResponse
-	if err := json.Unmarshal([]byte(cleanedResponse), &mealPlan); err != nil {
+	if err := json.Unmarshal([]byte(output.JSON), &mealPlan); err != nil {
 		log.Printf("Failed to parse JSON response: %v", err)
-		return gs.createStructuredResponse(cleanedResponse, reqBody), nil
+		fallback := gs.setMacroTargets(*gs.createStructuredResponse(output.JSON, reqBody), reqBody)
+		fallback.ValidationErrors = []string{err.Error()}
+		return &fallback, nil
 	}
 
 	// Clean and validate the parsed response
 	mealPlan = gs.cleanFoodsArrays(mealPlan, reqBody)
 	mealPlan = gs.setMacroTargets(mealPlan, reqBody)
 
+	// Flag steps the user's kitchen cannot handle
+	mealPlan.EquipmentWarnings = NewKitchenProfile(reqBody.KitchenTools).Warnings(mealPlan.Prepare, mealPlan.Cook)
+
 	return &mealPlan, nil
 }
 
-func (gs *GeminiService) parseRegenerationResponse(response string, reqBody models.RegenerationRequest) (*models.RegenerationLLMResponse, error) {
-	// Clean the response first
-	cleanedResponse := gs.cleanLLMResponse(response)
+func (gs *GeminiService) parseRegenerationResponse(output structuredOutput, reqBody models.RegenerationRequest) (*models.RegenerationLLMResponse, error) {
+	// Only fall back to defaults when the output is still invalid after repairs
+	if len(output.Problems) > 0 {
+		log.Printf("Regeneration output invalid after %d attempts, using default foods", output.Attempts)
+		fallback := gs.createRegenerationStructuredResponse(output.JSON, reqBody)
+		fallback.ValidationErrors = output.Problems
+		return fallback, nil
+	}
 
 	// Try to parse as JSON
 	var regenResponse models.RegenerationLLMResponse
-	if err := json.Unmarshal([]byte(cleanedResponse), &regenResponse); err != nil {
+	if err := json.Unmarshal([]byte(output.JSON), &regenResponse); err != nil {
 		log.Printf("Failed to parse regeneration JSON response: %v", err)
-		return gs.createRegenerationStructuredResponse(cleanedResponse, reqBody), nil
+		fallback := gs.createRegenerationStructuredResponse(output.JSON, reqBody)
+		fallback.ValidationErrors = []string{err.Error()}
+		return fallback, nil
 	}
 
 	// Validate and fix macro targets if needed
@@ -696,15 +816,19 @@ func (gs *GeminiService) parseRegenerationResponse(response string, reqBody mode
 	// Clean and validate the parsed response
 	regenResponse = gs.cleanRegenerationFoods(regenResponse, reqBody)
 
+	// Flag steps the user's kitchen cannot handle
+	regenResponse.EquipmentWarnings = NewKitchenProfile(reqBody.KitchenTools).Warnings(regenResponse.Prepare, regenResponse.Cook)
+
 	return &regenResponse, nil
 }
 
 func (gs *GeminiService) createStructuredResponse(response string, reqBody models.RequestBody) *models.MealPlanLLMResponse {
-	// Create a structured response with default meals
+	// Create a structured response with default meals, flagged so clients can tell
 	mealPlan := models.MealPlanLLMResponse{
-		Success: true,
-		Message: "Meal plan created successfully",
-		Data:    make(map[string]models.DayLLMMeals),
+		Success:  false,
+		Fallback: true,
+		Message:  "Generated meal plan failed validation; default meals were used",
+		Data:     make(map[string]models.DayLLMMeals),
 		Prepare: []models.PrepareCookSection{
 			{
 				Title:    "Preparing Protein",
@@ -814,14 +938,13 @@ func (gs *GeminiService) createStructuredResponse(response string, reqBody model
 		},
 	}
 
-	// Use dates from request, or default to 7 days if not provided
-	dates := reqBody.Dates
-	if len(dates) == 0 {
-		// Generate 7 days starting from today if no dates provided
-		for i := 0; i < 7; i++ {
-			dates = append(dates, fmt.Sprintf("2024-01-%02d", i+1))
-		}
-	}
+	// Leave out default steps that need equipment the user does not have
+	kitchen := NewKitchenProfile(reqBody.KitchenTools)
+	mealPlan.Prepare = kitchen.FilterSections(mealPlan.Prepare)
+	mealPlan.Cook = kitchen.FilterSections(mealPlan.Cook)
+
+	// Use the same dates the prompt asked for
+	dates := PlanDates(reqBody)
 
 	meals := []string{"Breakfast", "Lunch", "Dinner"}
 
@@ -856,8 +979,9 @@ func (gs *GeminiService) createStructuredResponse(response string, reqBody model
 func (gs *GeminiService) createRegenerationStructuredResponse(response string, reqBody models.RegenerationRequest) *models.RegenerationLLMResponse {
 	// Create a structured response with the regenerated meal using original meal data
 	regenResponse := models.RegenerationLLMResponse{
-		Success: true,
-		Message: "Meal regenerated successfully",
+		Success:  false,
+		Fallback: true,
+		Message:  "Regenerated meal failed validation; default foods were used",
 		Prepare: []models.PrepareCookSection{
 			{
 				Title:    "Preparing Protein",
@@ -950,6 +1074,11 @@ func (gs *GeminiService) createRegenerationStructuredResponse(response string, r
 		},
 	}
 
+	// Leave out default steps that need equipment the user does not have
+	kitchen := NewKitchenProfile(reqBody.KitchenTools)
+	regenResponse.Prepare = kitchen.FilterSections(regenResponse.Prepare)
+	regenResponse.Cook = kitchen.FilterSections(regenResponse.Cook)
+
 	return &regenResponse
 }
 
@@ -1047,16 +1176,10 @@ func (gs *GeminiService) isCommonWord(word string) bool {
 	return commonWords[word]
 }
 
+// looksLikeFood reports whether a word names a food the classifier knows
 func (gs *GeminiService) looksLikeFood(word string) bool {
-	// Simple heuristic to identify potential food names
-	foodIndicators := []string{"chicken", "beef", "fish", "salmon", "rice", "pasta", "bread", "egg", "milk", "cheese", "apple", "banana", "orange", "vegetable", "fruit", "meat", "grain", "nut", "seed", "oil", "butter", "yogurt", "cereal", "oatmeal", "quinoa", "lentil", "bean", "tomato", "potato", "onion", "garlic", "spinach", "lettuce", "carrot", "broccoli", "cauliflower", "cabbage", "pepper", "cucumber", "avocado", "lemon", "lime", "grape", "strawberry", "blueberry", "raspberry", "blackberry", "peach", "pear", "plum", "cherry", "grapefruit", "pineapple", "mango", "kiwi", "papaya", "coconut", "almond", "walnut", "pecan", "cashew", "pistachio", "hazelnut", "macadamia", "brazil", "sunflower", "pumpkin", "sesame", "flax", "chia", "hemp", "olive", "coconut", "canola", "vegetable", "corn", "soybean", "safflower", "grapeseed", "avocado", "walnut", "almond", "peanut", "sesame", "sunflower", "pumpkin", "flax", "chia", "hemp", "olive", "coconut", "canola", "vegetable", "corn", "soybean", "safflower", "grapeseed"}
-
-	for _, indicator := range foodIndicators {
-		if strings.Contains(word, indicator) {
-			return true
-		}
-	}
-	return false
+	_, ok := gs.classifier.ClassifyName(word)
+	return ok
 }
 
 func (gs *GeminiService) removeDuplicates(foods []string) []string {
@@ -1073,7 +1196,50 @@ func (gs *GeminiService) removeDuplicates(foods []string) []string {
 	return result
 }
 
+// buildExclusionRules spells out what the diet and allergies rule out. Foods that slip
+// through are still replaced after resolution.
+func buildExclusionRules(profile *ComplianceProfile) string {
+	rules := profile.PromptRules()
+	if len(rules) == 0 {
+		return ""
+	}
+	prompt := "STRICT EXCLUSIONS (never include these foods):\n"
+	for _, rule := range rules {
+		prompt += "- " + rule + "\n"
+	}
+	return prompt + "\n"
+}
+
+// buildKitchenRules lists the available equipment and what must not be used
+func buildKitchenRules(kitchen *KitchenProfile) string {
+	rules := kitchen.PromptRules()
+	if len(rules) == 0 {
+		return ""
+	}
+	prompt := "KITCHEN EQUIPMENT (prepare and cook steps must only use what is available):\n"
+	for _, rule := range rules {
+		prompt += "- " + rule + "\n"
+	}
+	return prompt + "\n"
+}
+
+// buildHealthRules lists the nutrient limits and banned foods of every health rule that
+// applies. Meals are checked against the limits after portions are solved.
+func buildHealthRules(health *HealthProfile) string {
+	rules := health.PromptRules()
+	if len(rules) == 0 {
+		return ""
+	}
+	prompt := "HEALTH RULES (follow these for every meal):\n"
+	for _, rule := range rules {
+		prompt += "- " + rule + "\n"
+	}
+	return prompt + "\n"
+}
+
 func (gs *GeminiService) getDefaultFoodsForMeal(mealName, dietType string, foodsToAvoid []string) []models.FoodWithPortion {
+	profile := NewComplianceProfile(dietType, foodsToAvoid)
+
 	// Default food suggestions with portion ratios based on meal and diet type
 	defaultFoods := map[string][]models.FoodWithPortion{
 		"Breakfast": {
@@ -1097,15 +1263,15 @@ func (gs *GeminiService) getDefaultFoodsForMeal(mealName, dietType string, foods
 	}
 
 	if foods, exists := defaultFoods[mealName]; exists {
-		return foods
+		return profile.CompliantFoods(foods)
 	}
 
-	return []models.FoodWithPortion{
+	return profile.CompliantFoods([]models.FoodWithPortion{
 		{Name: "Chicken Breast", PortionRatio: 40},
 		{Name: "Brown Rice", PortionRatio: 30},
 		{Name: "Broccoli", PortionRatio: 15},
 		{Name: "Avocado", PortionRatio: 15},
-	}
+	})
 }
 
 func (gs *GeminiService) cleanLLMResponse(response string) string {
@@ -1182,77 +1348,21 @@ func (gs *GeminiService) setMacroTargets(mealPlan models.MealPlanLLMResponse, re
 		numberOfMeals = 3 // Default to 3 meals if not specified
 	}
 
-	// Calculate per-meal targets by dividing daily targets by number of meals
-	caloriesPerMeal := reqBody.DailyCaloriesGoal / float64(numberOfMeals)
-	carbsPerMeal := reqBody.DailyCarbsGoal / float64(numberOfMeals)
-	proteinsPerMeal := reqBody.DailyProtiensGoal / float64(numberOfMeals)
-	fatsPerMeal := reqBody.DailyFatsGoal / float64(numberOfMeals)
+	daily := models.MacroTarget{
+		Calories: reqBody.DailyCaloriesGoal,
+		Carbs:    reqBody.DailyCarbsGoal,
+		Proteins: reqBody.DailyProtiensGoal,
+		Fats:     reqBody.DailyFatsGoal,
+	}
 
+	// Reservations for treats, social meals and drinks come out of the day's budget
+	// before the rest is divided between the planned meals
 	for dayKey, dayMeals := range mealPlan.Data {
-		for i := range dayMeals.Meals {
-			// Set macro targets based on daily targets divided by number of meals
-			dayMeals.Meals[i].MacroTarget = models.MacroTarget{
-				Calories: caloriesPerMeal,
-				Carbs:    carbsPerMeal,
-				Proteins: proteinsPerMeal,
-				Fats:     fatsPerMeal,
-			}
+		date := dayMeals.Date
+		if date == "" {
+			date = dayKey
 		}
-		mealPlan.Data[dayKey] = dayMeals
+		mealPlan.Data[dayKey] = ApplyReservations(dayMeals, ReservationsFor(reqBody, date), daily, numberOfMeals)
 	}
 	return mealPlan
 }
-
-func (gs *GeminiService) prompt(prompt string) (string, error) {
-	requestBody := GeminiRequest{
-		Contents: []Content{
-			{
-				Parts: []Part{
-					{
-						Text: prompt,
-					},
-				},
-			},
-		},
-	}
-
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("error marshaling request: %v", err)
-	}
-
-	url := fmt.Sprintf("%s?key=%s", gs.baseURL, gs.apiKey)
-	req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := gs.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error making request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response: %v", err)
-	}
-
-	var response GeminiResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return "", fmt.Errorf("error unmarshaling response: %v", err)
-	}
-
-	if len(response.Candidates) == 0 {
-		return "", fmt.Errorf("no candidates in response")
-	}
-
-	return response.Candidates[0].Content.Parts[0].Text, nil
-}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// failingProvider answers from its fake until the fake has given all of its responses,
+// then fails every call
+type failingProvider struct {
+	*FakeProvider
+	calls int
+	after int
+}
+
+func (fp *failingProvider) Generate(ctx context.Context, req LLMRequest) (string, error) {
+	fp.calls++
+	if fp.calls > fp.after {
+		return "", errors.New("service unavailable")
+	}
+	return fp.FakeProvider.Generate(ctx, req)
+}
+
+type repairTestValue struct {
+	Name  string `json:"name"`
+	Grams int    `json:"grams"`
+}
+
+func TestGenerateStructuredRepairsInvalidOutput(t *testing.T) {
+	llm := NewFakeProvider("```json\n{\"name\": \"rice\"}\n```", `{"name": "rice", "grams": 150}`)
+	gs := NewGeminiService(llm, nil, 2, nil, nil)
+
+	output, err := gs.generateStructured(context.Background(), "Pick a food", SchemaFor(repairTestValue{}), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output.JSON != `{"name": "rice", "grams": 150}` || len(output.Problems) > 0 || output.Attempts != 2 {
+		t.Errorf("output = %+v, want the repaired JSON after 2 attempts", output)
+	}
+	prompts := llm.Prompts()
+	if len(prompts) != 2 {
+		t.Fatalf("sent %d prompts, want 2", len(prompts))
+	}
+	for _, want := range []string{"Pick a food", `{"name": "rice"}`, `$: missing required field "grams"`} {
+		if !strings.Contains(prompts[1], want) {
+			t.Errorf("repair prompt does not contain %q:\n%s", want, prompts[1])
+		}
+	}
+}
+
+func TestGenerateStructuredStopsAfterRepairAttempts(t *testing.T) {
+	llm := NewFakeProvider(`{"name": 1}`)
+	gs := NewGeminiService(llm, nil, 2, nil, nil)
+
+	output, err := gs.generateStructured(context.Background(), "Pick a food", SchemaFor(repairTestValue{}), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(llm.Prompts()) != 3 || output.Attempts != 3 {
+		t.Errorf("made %d calls and reported %d attempts, want 3", len(llm.Prompts()), output.Attempts)
+	}
+	if len(output.Problems) != 2 {
+		t.Errorf("problems = %q, want the wrong name type and missing grams", output.Problems)
+	}
+}
+
+func TestGenerateStructuredWithoutRepairs(t *testing.T) {
+	llm := NewFakeProvider(`not json`)
+	gs := NewGeminiService(llm, nil, 0, nil, nil)
+
+	output, err := gs.generateStructured(context.Background(), "Pick a food", SchemaFor(repairTestValue{}), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(llm.Prompts()) != 1 || len(output.Problems) != 1 {
+		t.Errorf("made %d calls with problems %q, want one call and one problem", len(llm.Prompts()), output.Problems)
+	}
+}
+
+func TestGenerateStructuredKeepsLastOutputWhenRepairCallFails(t *testing.T) {
+	llm := &failingProvider{FakeProvider: NewFakeProvider(`{"name": "rice"}`), after: 1}
+	gs := NewGeminiService(llm, nil, 2, nil, nil)
+
+	output, err := gs.generateStructured(context.Background(), "Pick a food", SchemaFor(repairTestValue{}), "test")
+	if err != nil {
+		t.Fatalf("a failed repair call returned %v, want the previous output", err)
+	}
+	if output.JSON != `{"name": "rice"}` || len(output.Problems) != 1 {
+		t.Errorf("output = %+v, want the first answer and its problem", output)
+	}
+
+	// A failure on the first call has nothing to fall back to
+	llm = &failingProvider{FakeProvider: NewFakeProvider("unused")}
+	gs = NewGeminiService(llm, nil, 2, nil, nil)
+	if _, err := gs.generateStructured(context.Background(), "Pick a food", SchemaFor(repairTestValue{}), "test"); err == nil {
+		t.Error("a failed first call succeeded")
+	}
+}
+
+func TestMealPlanSchemaRequiresEveryDate(t *testing.T) {
+	schema := mealPlanSchema([]string{"2026-10-16", "2026-10-17"})
+	day := `{"date": "2026-10-16", "meals": [{"meal_name": "Lunch", "meal_time": "12:00", "meridiem": "PM", "foods": [{"name": "Rice", "portion_ratio": 100}]}]}`
+
+	problems := ValidateJSON([]byte(`{"success": true, "data": {"2026-10-16": `+day+`}}`), schema)
+	if len(problems) != 1 || !strings.Contains(problems[0], `"2026-10-17"`) {
+		t.Errorf("problems = %q, want the missing second date", problems)
+	}
+
+	// Server-owned fields are not required from the model
+	if _, ok := schema.Properties["fallback"]; ok {
+		t.Error("schema asks the model for the fallback flag")
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+const defaultGroceryAisle = "Other"
+
+// groceryAisle places foods in a store section by diet category or keyword. Aisles are
+// checked in order, so "tomato sauce" lands in condiments before produce sees "tomato".
+type groceryAisle struct {
+	name       string
+	categories []FoodCategory
+	keywords   []string
+}
+
+var groceryAisles = []groceryAisle{
+	{"Meat & Seafood", []FoodCategory{CategoryRedMeat, CategoryPork, CategoryPoultry, CategoryFish, CategoryShellfish}, nil},
+	{"Dairy & Eggs", []FoodCategory{CategoryDairy, CategoryEgg}, []string{"milk", "yogurt", "yoghurt", "cheese"}},
+	{"Oils, Sauces & Condiments", nil, []string{"oil", "vinegar", "sauce", "dressing", "mustard", "ketchup", "salsa", "mayo", "spice", "seasoning", "salt"}},
+	{"Nuts & Seeds", []FoodCategory{CategoryTreeNut, CategoryPeanut, CategorySesame}, []string{"seed", "chia", "flax", "hemp"}},
+	{"Produce", nil, []string{
+		"apple", "banana", "berry", "strawberry", "blueberry", "raspberry", "blackberry", "orange", "lemon", "lime", "grape",
+		"mango", "pineapple", "pear", "peach", "kiwi", "melon", "watermelon", "cherry", "date", "fig", "avocado", "tomato",
+		"potato", "yam", "plantain", "onion", "garlic", "ginger", "carrot", "broccoli", "cauliflower", "spinach", "kale",
+		"lettuce", "cabbage", "pepper", "cucumber", "zucchini", "squash", "eggplant", "mushroom", "celery", "asparagus",
+		"green bean", "herb", "cilantro", "parsley", "basil", "beet", "radish", "arugula", "green", "sprout", "corn",
+	}},
+	{"Grains, Pasta & Bread", []FoodCategory{CategoryGluten, CategoryGrain}, nil},
+	{"Beans, Legumes & Tofu", []FoodCategory{CategoryLegume, CategorySoy}, nil},
+	{"Beverages", []FoodCategory{CategoryAlcohol}, []string{"water", "coffee", "tea", "juice"}},
+	{"Pantry", []FoodCategory{CategorySugar, CategoryHoney}, []string{"protein powder", "powder", "bar"}},
+}
+
+// cookedYields is cooked weight divided by raw weight. A cooked amount divided by the
+// yield gives what to buy. The first keyword found in the name wins.
+var cookedYields = []struct {
+	keyword string
+	yield   float64
+}{
+	{"rice", 2.7},
+	{"quinoa", 2.7},
+	{"barley", 3.0},
+	{"bulgur", 2.8},
+	{"couscous", 2.5},
+	{"pasta", 2.25},
+	{"spaghetti", 2.25},
+	{"noodle", 2.25},
+	{"oat", 2.5},
+	{"oatmeal", 2.5},
+	{"lentil", 2.5},
+	{"chickpea", 2.4},
+	{"bean", 2.4},
+	{"chicken", 0.75},
+	{"turkey", 0.75},
+	{"beef", 0.72},
+	{"steak", 0.72},
+	{"pork", 0.72},
+	{"lamb", 0.72},
+	{"salmon", 0.8},
+	{"fish", 0.8},
+	{"cod", 0.8},
+	{"tuna", 0.8},
+	{"shrimp", 0.85},
+	{"spinach", 0.5},
+	{"mushroom", 0.6},
+}
+
+type groceryKey struct {
+	name string
+	unit string
+}
+
+// BuildGroceryList totals the resolved amount of every food across all days and meals,
+// merges foods that differ only by preparation (e.g. "Chicken Breast, Grilled" and
+// "Chicken Breast, Roasted"), converts cooked weights to raw purchase weights and
+// groups the result by store aisle
+func BuildGroceryList(data map[string]models.DayAPIMeals) models.GroceryList {
+	items := make(map[groceryKey]*models.GroceryItem)
+	foodIDs := make(map[groceryKey]map[string]bool)
+
+	for _, day := range data {
+		for _, meal := range day.Meals {
+			for _, food := range meal.Foods {
+				if len(food.Servings) == 0 {
+					continue
+				}
+				serving := food.Servings[0]
+				amount := parseAmount(serving.MetricServingAmount)
+				if amount <= 0 {
+					continue
+				}
+				unit := strings.ToLower(strings.TrimSpace(serving.MetricServingUnit))
+				if unit == "" {
+					unit = "g"
+				}
+
+				name, cooked := canonicalGroceryName(food)
+				key := groceryKey{name: name, unit: unit}
+				item, ok := items[key]
+				if !ok {
+					item = &models.GroceryItem{Name: name, Aisle: GroceryAisleFor(name), Unit: unit}
+					items[key] = item
+					foodIDs[key] = make(map[string]bool)
+				}
+
+				purchase := amount
+				if yield := cookedYield(name); cooked && yield > 0 && unit == "g" {
+					purchase = amount / yield
+					item.CookedAmount += amount
+				}
+				item.PurchaseAmount += purchase
+				item.Occurrences++
+				if food.FoodID != "" && !foodIDs[key][food.FoodID] {
+					foodIDs[key][food.FoodID] = true
+					item.FoodIDs = append(item.FoodIDs, food.FoodID)
+				}
+			}
+		}
+	}
+
+	byAisle := make(map[string][]models.GroceryItem)
+	for _, item := range items {
+		// Round purchases up so the list never comes out short
+		item.PurchaseAmount = math.Ceil(item.PurchaseAmount)
+		item.CookedAmount = math.Round(item.CookedAmount)
+		sort.Strings(item.FoodIDs)
+		byAisle[item.Aisle] = append(byAisle[item.Aisle], *item)
+	}
+
+	list := models.GroceryList{Days: len(data), ItemCount: len(items)}
+	for _, aisle := range groceryAisleOrder() {
+		aisleItems := byAisle[aisle]
+		if len(aisleItems) == 0 {
+			continue
+		}
+		sort.Slice(aisleItems, func(i, j int) bool { return aisleItems[i].Name < aisleItems[j].Name })
+		list.Aisles = append(list.Aisles, models.GroceryAisle{Name: aisle, Items: aisleItems})
+	}
+	return list
+}
+
+// WriteGroceryListCSV writes one row per item, aisle by aisle
+func WriteGroceryListCSV(w io.Writer, list models.GroceryList) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"aisle", "item", "purchase_amount", "unit", "cooked_amount", "occurrences"}); err != nil {
+		return err
+	}
+	for _, aisle := range list.Aisles {
+		for _, item := range aisle.Items {
+			cooked := ""
+			if item.CookedAmount > 0 {
+				cooked = strconv.FormatFloat(item.CookedAmount, 'f', -1, 64)
+			}
+			if err := writer.Write([]string{
+				aisle.Name,
+				item.Name,
+				strconv.FormatFloat(item.PurchaseAmount, 'f', -1, 64),
+				item.Unit,
+				cooked,
+				strconv.Itoa(item.Occurrences),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// GroceryAisleFor returns the store section for a food name
+func GroceryAisleFor(name string) string {
+	words := singularWords(name)
+	for _, aisle := range groceryAisles {
+		for _, category := range aisle.categories {
+			if matchCategory(name, category) != "" {
+				return aisle.name
+			}
+		}
+		for _, keyword := range aisle.keywords {
+			if strings.Contains(words, " "+keyword+" ") {
+				return aisle.name
+			}
+		}
+	}
+	return defaultGroceryAisle
+}
+
+// canonicalGroceryName strips amounts and preparation words from a resolved food and
+// reports whether the amount is a cooked weight. The LLM's own name is consulted too,
+// since it often says "(cooked)" when the database name does not.
+func canonicalGroceryName(food models.Food) (string, bool) {
+	q := ParseFoodQuery(food.FoodName)
+	cooked := q.Preparation == "cooked"
+	if food.Match != nil && !cooked && q.Preparation == "" {
+		cooked = ParseFoodQuery(food.Match.Query).Preparation == "cooked"
+	}
+
+	name := q.Base
+	if name == "" {
+		name = strings.ToLower(strings.TrimSpace(food.FoodName))
+	}
+	// Title-case for display; the lower-cased base is what merges variants
+	words := strings.Fields(name)
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " "), cooked
+}
+
+func cookedYield(name string) float64 {
+	words := singularWords(name)
+	for _, y := range cookedYields {
+		if strings.Contains(words, " "+y.keyword+" ") {
+			return y.yield
+		}
+	}
+	return 0
+}
+
+// singularWords is paddedWords with every word reduced to its singular form
+func singularWords(name string) string {
+	fields := strings.Fields(paddedWords(name))
+	for i, word := range fields {
+		fields[i] = singular(word)
+	}
+	return " " + strings.Join(fields, " ") + " "
+}
+
+func groceryAisleOrder() []string {
+	order := make([]string, 0, len(groceryAisles)+1)
+	for _, aisle := range groceryAisles {
+		order = append(order, aisle.name)
+	}
+	return append(order, defaultGroceryAisle)
+}
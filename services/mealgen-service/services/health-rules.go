@@ -0,0 +1,384 @@
+package services
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Constraint scopes
+const (
+	ScopeMeal = "meal"
+	ScopeDay  = "day"
+)
+
+//go:embed health-rules.yaml
+var defaultHealthRules []byte
+
+// HealthRule maps a health condition or life stage to nutrient constraints and banned
+// foods
+type HealthRule struct {
+	ID          string               `json:"id" yaml:"id"`
+	Name        string               `json:"name" yaml:"name"`
+	AppliesTo   []string             `json:"applies_to" yaml:"applies_to"`
+	Guidance    string               `json:"guidance,omitempty" yaml:"guidance"`
+	Constraints []NutrientConstraint `json:"constraints,omitempty" yaml:"constraints"`
+	BannedFoods []string             `json:"banned_foods,omitempty" yaml:"banned_foods"`
+}
+
+// NutrientConstraint bounds one nutrient per meal or per day. MaxShare caps a meal's
+// share of the day's total and only applies to meal constraints.
+type NutrientConstraint struct {
+	Nutrient string   `json:"nutrient" yaml:"nutrient"`
+	Scope    string   `json:"scope" yaml:"scope"`
+	Min      *float64 `json:"min,omitempty" yaml:"min"`
+	Max      *float64 `json:"max,omitempty" yaml:"max"`
+	MaxShare *float64 `json:"max_share,omitempty" yaml:"max_share"`
+	Unit     string   `json:"unit,omitempty" yaml:"unit"` // Only needed for nutrients the food data lacks
+}
+
+// tracked reports whether the food data carries the nutrient, so it can be checked
+func (c NutrientConstraint) tracked() bool {
+	_, ok := models.NutrientByName(c.Nutrient)
+	return ok
+}
+
+func (c NutrientConstraint) unit() string {
+	if c.Unit != "" {
+		return c.Unit
+	}
+	if n, ok := models.NutrientByName(c.Nutrient); ok {
+		return n.Unit()
+	}
+	return ""
+}
+
+// describe renders the constraint for prompts, e.g. "sodium at most 600 mg per meal"
+func (c NutrientConstraint) describe() string {
+	name := strings.ReplaceAll(c.Nutrient, "_", " ")
+	var parts []string
+	if c.Min != nil {
+		parts = append(parts, fmt.Sprintf("at least %g %s", *c.Min, c.unit()))
+	}
+	if c.Max != nil {
+		parts = append(parts, fmt.Sprintf("at most %g %s", *c.Max, c.unit()))
+	}
+	if c.MaxShare != nil {
+		parts = append(parts, fmt.Sprintf("no more than %.0f%% of the day's total", *c.MaxShare*100))
+	}
+	return fmt.Sprintf("%s %s per %s", name, strings.Join(parts, " and "), c.Scope)
+}
+
+// HealthRuleSet is the full set of rules loaded at startup
+type HealthRuleSet struct {
+	Rules []HealthRule `json:"rules" yaml:"rules"`
+}
+
+// LoadHealthRules reads rules from a .yaml, .yml or .json file, or the built-in rules
+// when path is empty
+func LoadHealthRules(path string) (*HealthRuleSet, error) {
+	if path == "" {
+		return ParseHealthRules(defaultHealthRules, "yaml")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read health rules: %w", err)
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = "json"
+	}
+	rules, err := ParseHealthRules(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseHealthRules decodes and validates a rule file in the given format (yaml or json)
+func ParseHealthRules(data []byte, format string) (*HealthRuleSet, error) {
+	var set HealthRuleSet
+	var err error
+	if format == "json" {
+		err = json.Unmarshal(data, &set)
+	} else {
+		err = yaml.Unmarshal(data, &set)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse health rules: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range set.Rules {
+		rule := &set.Rules[i]
+		if rule.ID == "" {
+			return nil, fmt.Errorf("health rule %d has no id", i)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("duplicate health rule %q", rule.ID)
+		}
+		seen[rule.ID] = true
+		if len(rule.AppliesTo) == 0 {
+			return nil, fmt.Errorf("health rule %q has no applies_to terms", rule.ID)
+		}
+		if rule.Name == "" {
+			rule.Name = rule.ID
+		}
+
+		for j := range rule.Constraints {
+			c := &rule.Constraints[j]
+			c.Nutrient = strings.ToLower(strings.TrimSpace(c.Nutrient))
+			c.Scope = strings.ToLower(strings.TrimSpace(c.Scope))
+			if c.Scope == "" {
+				c.Scope = ScopeDay
+			}
+			if c.Scope != ScopeMeal && c.Scope != ScopeDay {
+				return nil, fmt.Errorf("health rule %q: unknown scope %q (want %s or %s)", rule.ID, c.Scope, ScopeMeal, ScopeDay)
+			}
+			if c.Min == nil && c.Max == nil && c.MaxShare == nil {
+				return nil, fmt.Errorf("health rule %q: %s constraint has no min, max or max_share", rule.ID, c.Nutrient)
+			}
+			if c.MaxShare != nil && c.Scope != ScopeMeal {
+				return nil, fmt.Errorf("health rule %q: max_share only applies to meal constraints", rule.ID)
+			}
+			if !c.tracked() {
+				log.Printf("Health rule %q: %s is not in the food data and will only guide the prompt", rule.ID, c.Nutrient)
+			}
+		}
+	}
+	return &set, nil
+}
+
+// ProfileFor returns the rules that apply to any of the given conditions or life stages
+func (rs *HealthRuleSet) ProfileFor(conditions ...[]string) *HealthProfile {
+	profile := &HealthProfile{}
+	if rs == nil {
+		return profile
+	}
+
+	var selected []string
+	for _, list := range conditions {
+		selected = append(selected, list...)
+	}
+
+	for _, rule := range rs.Rules {
+		if matchesAnyTerm(selected, rule.AppliesTo) {
+			profile.rules = append(profile.rules, rule)
+		}
+	}
+	return profile
+}
+
+// HealthProfile is the set of rules that apply to one request
+type HealthProfile struct {
+	rules []HealthRule
+}
+
+// Empty reports whether no rule applies
+func (hp *HealthProfile) Empty() bool {
+	return hp == nil || len(hp.rules) == 0
+}
+
+// healthAdvisoryNote tells clients what the rules do and do not change
+const healthAdvisoryNote = "These rules guide meal generation and replace banned foods. Their nutrient limits are advisory: portions are not adjusted to meet them, and broken limits are reported as health_violations."
+
+// Summary names the applicable rules for a response, or returns nil when none apply
+func (hp *HealthProfile) Summary() *models.HealthRulesApplied {
+	if hp.Empty() {
+		return nil
+	}
+	summary := &models.HealthRulesApplied{Advisory: true, Note: healthAdvisoryNote}
+	for _, rule := range hp.rules {
+		summary.Rules = append(summary.Rules, rule.Name)
+	}
+	return summary
+}
+
+// AddExclusionsTo adds every banned food to a compliance profile, so banned foods are
+// replaced after resolution the same way allergens are
+func (hp *HealthProfile) AddExclusionsTo(profile *ComplianceProfile) {
+	if hp.Empty() {
+		return
+	}
+	for _, rule := range hp.rules {
+		for _, food := range rule.BannedFoods {
+			profile.Exclude(food, rule.Name+" rule")
+		}
+	}
+}
+
+// PromptRules describes each applicable rule for the LLM
+func (hp *HealthProfile) PromptRules() []string {
+	if hp.Empty() {
+		return nil
+	}
+	var rules []string
+	for _, rule := range hp.rules {
+		line := rule.Name + ":"
+		if rule.Guidance != "" {
+			line += " " + rule.Guidance
+		}
+		var limits []string
+		for _, c := range rule.Constraints {
+			limits = append(limits, c.describe())
+		}
+		if len(limits) > 0 {
+			line += " Limits: " + strings.Join(limits, "; ") + "."
+		}
+		if len(rule.BannedFoods) > 0 {
+			line += " Never include: " + strings.Join(rule.BannedFoods, ", ") + "."
+		}
+		rules = append(rules, line)
+	}
+	return rules
+}
+
+// CheckDay records violations on each meal and on the day. Reserved placeholder meals
+// have no foods and are skipped.
+func (hp *HealthProfile) CheckDay(day *models.DayAPIMeals) {
+	if hp.Empty() {
+		return
+	}
+
+	dayTotals := make(map[string]float64)
+	mealTotals := make([]map[string]float64, len(day.Meals))
+	for i, meal := range day.Meals {
+		mealTotals[i] = mealNutrients(meal.Foods)
+		for nutrient, amount := range mealTotals[i] {
+			dayTotals[nutrient] += amount
+		}
+	}
+
+	day.HealthViolations = nil
+	for i := range day.Meals {
+		meal := &day.Meals[i]
+		meal.HealthViolations = nil
+		if meal.Reserved != nil {
+			continue
+		}
+		meal.HealthViolations = hp.checkMeal(meal.Foods, mealTotals[i], dayTotals)
+	}
+
+	for _, rule := range hp.rules {
+		for _, c := range rule.Constraints {
+			if c.Scope != ScopeDay || !c.tracked() {
+				continue
+			}
+			if amount, ok := dayTotals[c.Nutrient]; ok {
+				day.HealthViolations = append(day.HealthViolations, checkAmount(rule, c, amount)...)
+			}
+		}
+	}
+}
+
+// CheckMeal returns the violations for a single meal. Share-of-day limits need the
+// rest of the day and are skipped.
+func (hp *HealthProfile) CheckMeal(foods []models.Food) []models.HealthViolation {
+	if hp.Empty() {
+		return nil
+	}
+	return hp.checkMeal(foods, mealNutrients(foods), nil)
+}
+
+func (hp *HealthProfile) checkMeal(foods []models.Food, totals, dayTotals map[string]float64) []models.HealthViolation {
+	var violations []models.HealthViolation
+	for _, rule := range hp.rules {
+		for _, food := range foods {
+			if term := bannedFoodTerm(rule, food); term != "" {
+				violations = append(violations, models.HealthViolation{
+					Rule:    rule.ID,
+					Food:    food.FoodName,
+					Message: fmt.Sprintf("%s: %s is not recommended (%s)", rule.Name, food.FoodName, term),
+				})
+			}
+		}
+
+		for _, c := range rule.Constraints {
+			if c.Scope != ScopeMeal || !c.tracked() {
+				continue
+			}
+			amount, ok := totals[c.Nutrient]
+			if !ok {
+				continue
+			}
+			violations = append(violations, checkAmount(rule, c, amount)...)
+
+			if c.MaxShare != nil && dayTotals != nil && dayTotals[c.Nutrient] > 0 {
+				share := amount / dayTotals[c.Nutrient]
+				if share > *c.MaxShare {
+					violations = append(violations, models.HealthViolation{
+						Rule:     rule.ID,
+						Nutrient: c.Nutrient,
+						Limit:    *c.MaxShare,
+						Actual:   math.Round(share*100) / 100,
+						Message: fmt.Sprintf("%s: meal has %.0f%% of the day's %s (limit %.0f%%)",
+							rule.Name, share*100, strings.ReplaceAll(c.Nutrient, "_", " "), *c.MaxShare*100),
+					})
+				}
+			}
+		}
+	}
+	return violations
+}
+
+func checkAmount(rule HealthRule, c NutrientConstraint, amount float64) []models.HealthViolation {
+	name := strings.ReplaceAll(c.Nutrient, "_", " ")
+	var violations []models.HealthViolation
+	if c.Max != nil && amount > *c.Max {
+		violations = append(violations, models.HealthViolation{
+			Rule:     rule.ID,
+			Nutrient: c.Nutrient,
+			Limit:    *c.Max,
+			Actual:   roundTarget(amount),
+			Message:  fmt.Sprintf("%s: %s %.0f %s per %s is over the %g %s limit", rule.Name, name, amount, c.unit(), c.Scope, *c.Max, c.unit()),
+		})
+	}
+	if c.Min != nil && amount < *c.Min {
+		violations = append(violations, models.HealthViolation{
+			Rule:     rule.ID,
+			Nutrient: c.Nutrient,
+			Limit:    *c.Min,
+			Actual:   roundTarget(amount),
+			Message:  fmt.Sprintf("%s: %s %.0f %s per %s is under the %g %s minimum", rule.Name, name, amount, c.unit(), c.Scope, *c.Min, c.unit()),
+		})
+	}
+	return violations
+}
+
+// mealNutrients totals the selected serving of every food. Nutrients no food reported
+// are left out, so they are not checked.
+func mealNutrients(foods []models.Food) map[string]float64 {
+	sum := SumNutrients(foods)
+	totals := make(map[string]float64)
+	for n := models.NutrientCalories; n <= models.NutrientVitaminD; n++ {
+		if amount, ok := sum.Get(n); ok {
+			totals[n.String()] = amount
+		}
+	}
+	return totals
+}
+
+// bannedFoodTerm returns the banned term a food matches, checking both the resolved
+// name and the name the LLM asked for
+func bannedFoodTerm(rule HealthRule, food models.Food) string {
+	names := []string{food.FoodName}
+	if food.Match != nil {
+		names = append(names, food.Match.Query)
+	}
+	for _, term := range rule.BannedFoods {
+		for _, name := range names {
+			if containsWord(paddedWords(name), strings.TrimSpace(paddedWords(term))) {
+				return term
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestProfileForMatchesWholeWords(t *testing.T) {
+	rules, err := LoadHealthRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		conditions []string
+		lifeStages []string
+		want       []string
+	}{
+		{[]string{"Type 2 Diabetes"}, nil, []string{"Type 2 diabetes"}},
+		{[]string{"type-2 diabetes", "High blood pressure"}, nil, []string{"Hypertension", "Type 2 diabetes"}},
+		{[]string{"Type 1 diabetes"}, nil, nil},
+		{[]string{"Gestational diabetes"}, nil, nil},
+		{[]string{"CKD stage 3"}, nil, []string{"Chronic kidney disease"}},
+		{[]string{"ckds"}, nil, nil},
+		{[]string{"hypertensive"}, nil, nil},
+		{nil, []string{"Pregnant"}, []string{"Pregnancy"}},
+		{[]string{""}, []string{"  "}, nil},
+	}
+	for _, tt := range tests {
+		summary := rules.ProfileFor(tt.conditions, tt.lifeStages).Summary()
+		var got []string
+		if summary != nil {
+			got = summary.Rules
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ProfileFor(%q, %q) = %q, want %q", tt.conditions, tt.lifeStages, got, tt.want)
+		}
+	}
+}
+
+func TestHealthSummaryIsAdvisory(t *testing.T) {
+	rules, err := LoadHealthRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := rules.ProfileFor([]string{"hypertension"}).Summary()
+	if summary == nil || !summary.Advisory || summary.Note == "" {
+		t.Errorf("summary = %+v, want an advisory note", summary)
+	}
+
+	var none *HealthRuleSet
+	if summary := none.ProfileFor([]string{"hypertension"}).Summary(); summary != nil {
+		t.Errorf("summary without rules = %+v, want nil", summary)
+	}
+}
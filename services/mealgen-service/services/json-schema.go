@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// JSONSchema is the subset of JSON Schema used to constrain and validate LLM output
+type JSONSchema struct {
+	Type                 string                 `json:"type"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+}
+
+// SchemaFor derives a schema from a Go value's type using its json tags. Fields without
+// omitempty are required; fields tagged `llm:"-"` are owned by the server and left out.
+func SchemaFor(v interface{}) *JSONSchema {
+	return schemaForType(reflect.TypeOf(v))
+}
+
+func schemaForType(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: schemaForType(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaForType(t.Elem())}
+	case reflect.Struct:
+		schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || field.Tag.Get("llm") == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			schema.Properties[name] = schemaForType(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	default:
+		return &JSONSchema{Type: "string"}
+	}
+}
+
+// WithMapKeys turns a map schema into an object with the given required keys. LLM
+// structured output modes need concrete properties rather than additionalProperties.
+func (s *JSONSchema) WithMapKeys(keys []string) *JSONSchema {
+	if s == nil || s.AdditionalProperties == nil {
+		return s
+	}
+	expanded := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema, len(keys))}
+	for _, key := range keys {
+		expanded.Properties[key] = s.AdditionalProperties
+		expanded.Required = append(expanded.Required, key)
+	}
+	return expanded
+}
+
+// ValidateJSON checks raw JSON against the schema and returns one message per problem,
+// each prefixed with the path of the offending value
+func ValidateJSON(data []byte, schema *JSONSchema) []string {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return []string{fmt.Sprintf("$: invalid JSON: %v", err)}
+	}
+
+	var problems []string
+	validateValue("$", value, schema, &problems)
+	return problems
+}
+
+func validateValue(path string, value interface{}, schema *JSONSchema, problems *[]string) {
+	if schema == nil {
+		return
+	}
+
+	switch schema.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected object, got %s", path, jsonKind(value)))
+			return
+		}
+		for _, name := range schema.Required {
+			if _, exists := obj[name]; !exists {
+				*problems = append(*problems, fmt.Sprintf("%s: missing required field %q", path, name))
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := schema.Properties[key]
+			if child == nil {
+				child = schema.AdditionalProperties
+			}
+			validateValue(fmt.Sprintf("%s.%s", path, key), obj[key], child, problems)
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected array, got %s", path, jsonKind(value)))
+			return
+		}
+		for i, item := range arr {
+			validateValue(fmt.Sprintf("%s[%d]", path, i), item, schema.Items, problems)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected string, got %s", path, jsonKind(value)))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected boolean, got %s", path, jsonKind(value)))
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected number, got %s", path, jsonKind(value)))
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected integer, got %s", path, jsonKind(value)))
+			return
+		}
+		if _, err := n.Int64(); err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s: expected integer, got %s", path, n.String()))
+		}
+	}
+}
+
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
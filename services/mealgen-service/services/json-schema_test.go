@@ -0,0 +1,118 @@
+package services
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type schemaTestItem struct {
+	Name  string  `json:"name"`
+	Grams float64 `json:"grams"`
+}
+
+type schemaTestValue struct {
+	Title    string                    `json:"title"`
+	Count    int                       `json:"count"`
+	Done     bool                      `json:"done"`
+	Note     string                    `json:"note,omitempty"`
+	Items    []schemaTestItem          `json:"items"`
+	ByDay    map[string]schemaTestItem `json:"by_day"`
+	Best     *schemaTestItem           `json:"best,omitempty"`
+	Internal string                    `json:"internal" llm:"-"`
+	Skipped  string                    `json:"-"`
+	unusable string
+}
+
+func TestSchemaForFollowsJSONTags(t *testing.T) {
+	schema := SchemaFor(schemaTestValue{})
+
+	if schema.Type != "object" {
+		t.Fatalf("type = %q, want object", schema.Type)
+	}
+	wantTypes := map[string]string{
+		"title": "string", "count": "integer", "done": "boolean", "note": "string",
+		"items": "array", "by_day": "object", "best": "object",
+	}
+	if len(schema.Properties) != len(wantTypes) {
+		t.Errorf("properties = %v, want %d", slices.Sorted(maps.Keys(schema.Properties)), len(wantTypes))
+	}
+	for name, want := range wantTypes {
+		if got := schema.Properties[name]; got == nil || got.Type != want {
+			t.Errorf("property %s = %+v, want type %s", name, got, want)
+		}
+	}
+	if want := []string{"title", "count", "done", "items", "by_day"}; !slices.Equal(schema.Required, want) {
+		t.Errorf("required = %v, want %v", schema.Required, want)
+	}
+
+	items := schema.Properties["items"].Items
+	if items == nil || items.Properties["grams"].Type != "number" || !slices.Equal(items.Required, []string{"name", "grams"}) {
+		t.Errorf("items schema = %+v, want the item object", items)
+	}
+	if byDay := schema.Properties["by_day"]; byDay.AdditionalProperties == nil || byDay.AdditionalProperties.Properties["name"] == nil {
+		t.Errorf("by_day schema = %+v, want the item object as additionalProperties", byDay)
+	}
+}
+
+func TestWithMapKeysRequiresEveryKey(t *testing.T) {
+	byDay := SchemaFor(schemaTestValue{}).Properties["by_day"]
+
+	expanded := byDay.WithMapKeys([]string{"2026-10-16", "2026-10-17"})
+
+	if expanded.AdditionalProperties != nil {
+		t.Error("expanded schema still has additionalProperties")
+	}
+	if !slices.Equal(expanded.Required, []string{"2026-10-16", "2026-10-17"}) {
+		t.Errorf("required = %v, want both dates", expanded.Required)
+	}
+	if expanded.Properties["2026-10-17"] != byDay.AdditionalProperties {
+		t.Error("a date does not use the map's value schema")
+	}
+
+	title := SchemaFor(schemaTestValue{}).Properties["title"]
+	if title.WithMapKeys([]string{"x"}) != title {
+		t.Error("WithMapKeys changed a schema that is not a map")
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	schema := SchemaFor(schemaTestValue{})
+	schema.Properties["by_day"] = schema.Properties["by_day"].WithMapKeys([]string{"mon"})
+	const valid = `{"title": "t", "count": 2, "done": false, "items": [{"name": "rice", "grams": 150.5}], "by_day": {"mon": {"name": "oats", "grams": 40}}}`
+
+	tests := []struct {
+		name string
+		json string
+		want []string
+	}{
+		{"valid", valid, nil},
+		{"extra fields allowed", `{"title": "t", "count": 2, "done": true, "items": [], "by_day": {"mon": {"name": "a", "grams": 1}, "tue": 5}, "extra": 1}`, nil},
+		{"invalid JSON", `{"title": `, []string{"$: invalid JSON"}},
+		{"not an object", `[]`, []string{"$: expected object, got array"}},
+		{"missing fields", `{"title": "t", "count": 1, "done": true, "items": []}`, []string{`$: missing required field "by_day"`}},
+		{"missing map key", `{"title": "t", "count": 1, "done": true, "items": [], "by_day": {}}`, []string{`$.by_day: missing required field "mon"`}},
+		{"wrong types", `{"title": 3, "count": "2", "done": "yes", "items": {}, "by_day": {"mon": {"name": "a", "grams": 1}}}`, []string{
+			"$.count: expected integer, got string",
+			"$.done: expected boolean, got string",
+			"$.items: expected array, got object",
+			"$.title: expected string, got number",
+		}},
+		{"fractional integer", strings.Replace(valid, `"count": 2`, `"count": 2.5`, 1), []string{"$.count: expected integer, got 2.5"}},
+		{"nested item", strings.Replace(valid, `"grams": 150.5`, `"grams": null`, 1), []string{"$.items[0].grams: expected number, got null"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateJSON([]byte(tt.json), schema)
+			if len(got) != len(tt.want) {
+				t.Fatalf("problems = %q, want %q", got, tt.want)
+			}
+			for i := range tt.want {
+				if !strings.HasPrefix(got[i], tt.want[i]) {
+					t.Errorf("problem %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
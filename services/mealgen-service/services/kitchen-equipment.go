@@ -0,0 +1,206 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// Kitchen equipment the prepare and cook steps are checked against
+const (
+	EquipmentOven           = "oven"
+	EquipmentAirFryer       = "air fryer"
+	EquipmentStovetop       = "stovetop"
+	EquipmentMicrowave      = "microwave"
+	EquipmentGrill          = "grill"
+	EquipmentSlowCooker     = "slow cooker"
+	EquipmentPressureCooker = "pressure cooker"
+	EquipmentRiceCooker     = "rice cooker"
+	EquipmentBlender        = "blender"
+	EquipmentToaster        = "toaster"
+)
+
+// equipmentTerms are the words that name a tool in a user's list (aliases) and the
+// words that show a step needs it (uses). Uses are matched as whole words.
+var equipmentTerms = []struct {
+	tool    string
+	aliases []string
+	uses    []string
+}{
+	{EquipmentAirFryer, []string{"air fryer", "airfryer"}, []string{"air fryer", "air fry", "air fried", "airfryer"}},
+	{EquipmentOven, []string{"oven"}, []string{"oven", "bake", "baked", "baking", "roast", "roasted", "roasting", "broil", "broiled", "sheet pan"}},
+	{EquipmentStovetop, []string{"stove", "stovetop", "hob", "cooktop", "burner", "induction"}, []string{
+		"stove", "stovetop", "skillet", "frying pan", "pan fry", "pan fried", "saute", "sauteed", "stir fry", "wok",
+		"boil", "boils", "boiled", "boiling", "simmer", "sear", "seared", "poach", "poached", "scramble",
+	}},
+	{EquipmentMicrowave, []string{"microwave"}, []string{"microwave", "microwaved"}},
+	{EquipmentGrill, []string{"grill", "bbq", "barbecue"}, []string{"grill", "grilling", "bbq", "barbecue"}},
+	{EquipmentSlowCooker, []string{"slow cooker", "crock pot", "crockpot"}, []string{"slow cooker", "slow cook", "crock pot", "crockpot"}},
+	{EquipmentPressureCooker, []string{"pressure cooker", "instant pot", "instapot"}, []string{"pressure cooker", "pressure cook", "instant pot"}},
+	{EquipmentRiceCooker, []string{"rice cooker"}, []string{"rice cooker"}},
+	{EquipmentBlender, []string{"blender", "nutribullet", "food processor"}, []string{"blender", "blend", "food processor"}},
+	{EquipmentToaster, []string{"toaster"}, []string{"toaster"}},
+}
+
+// KitchenProfile is the equipment a user has. An empty tool list places no limits.
+// Listing tools ("stovetop", "air fryer only") limits steps to those tools; "no oven"
+// rules out a single tool and leaves the rest available.
+type KitchenProfile struct {
+	tools      []string
+	restricted bool // Only the tools in available can be used
+	available  map[string]bool
+	missing    map[string]bool
+}
+
+// NewKitchenProfile reads the kitchen_tools list from a request
+func NewKitchenProfile(tools []string) *KitchenProfile {
+	kp := &KitchenProfile{available: make(map[string]bool), missing: make(map[string]bool)}
+	for _, entry := range tools {
+		words := paddedWords(entry)
+		if strings.TrimSpace(words) == "" {
+			continue
+		}
+		kp.tools = append(kp.tools, strings.TrimSpace(entry))
+
+		switch strings.TrimSpace(words) {
+		case "none", "no equipment", "no kitchen", "nothing":
+			kp.restricted = true
+			continue
+		}
+
+		negated := strings.HasPrefix(words, " no ") || strings.HasPrefix(words, " without ") || strings.HasPrefix(words, " not ")
+		for _, term := range equipmentTerms {
+			for _, alias := range term.aliases {
+				if !strings.Contains(words, paddedWords(alias)) {
+					continue
+				}
+				if negated {
+					kp.missing[term.tool] = true
+				} else {
+					kp.available[term.tool] = true
+					kp.restricted = true
+				}
+				break
+			}
+		}
+	}
+	return kp
+}
+
+// Empty reports whether the profile places no limits on equipment
+func (kp *KitchenProfile) Empty() bool {
+	return !kp.restricted && len(kp.missing) == 0
+}
+
+// Has reports whether the user can use a tool
+func (kp *KitchenProfile) Has(tool string) bool {
+	if kp.missing[tool] {
+		return false
+	}
+	return !kp.restricted || kp.available[tool]
+}
+
+// Missing returns the tools a step needs that the user lacks. A step that offers
+// alternatives ("oven or air fryer") only needs one of them.
+func (kp *KitchenProfile) Missing(step string) []string {
+	needed := stepEquipment(step)
+	if len(needed) == 0 || kp.Empty() {
+		return nil
+	}
+
+	var missing []string
+	for _, tool := range needed {
+		if !kp.Has(tool) {
+			missing = append(missing, tool)
+		}
+	}
+	if len(missing) < len(needed) && strings.Contains(paddedWords(step), " or ") {
+		return nil
+	}
+	return missing
+}
+
+// FilterSections drops steps that need missing equipment, and sections left empty
+func (kp *KitchenProfile) FilterSections(sections []models.PrepareCookSection) []models.PrepareCookSection {
+	if kp.Empty() {
+		return sections
+	}
+	filtered := make([]models.PrepareCookSection, 0, len(sections))
+	for _, section := range sections {
+		var steps []string
+		for _, step := range section.Steps {
+			if len(kp.Missing(step)) == 0 {
+				steps = append(steps, step)
+			}
+		}
+		if len(steps) == 0 {
+			continue
+		}
+		section.Steps = steps
+		filtered = append(filtered, section)
+	}
+	return filtered
+}
+
+// Warnings flags every prepare and cook step that needs equipment the user lacks
+func (kp *KitchenProfile) Warnings(prepare, cook []models.PrepareCookSection) []models.EquipmentWarning {
+	if kp.Empty() {
+		return nil
+	}
+	var warnings []models.EquipmentWarning
+	for _, group := range []struct {
+		name     string
+		sections []models.PrepareCookSection
+	}{
+		{"prepare", prepare},
+		{"cook", cook},
+	} {
+		for _, section := range group.sections {
+			for _, step := range section.Steps {
+				if missing := kp.Missing(step); len(missing) > 0 {
+					warnings = append(warnings, models.EquipmentWarning{
+						Section: group.name,
+						Title:   section.Title,
+						Step:    step,
+						Missing: missing,
+					})
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// PromptRules describes the available equipment for the LLM
+func (kp *KitchenProfile) PromptRules() []string {
+	if len(kp.tools) == 0 {
+		return nil
+	}
+	rules := []string{"Kitchen equipment: " + strings.Join(kp.tools, ", ")}
+	var unavailable []string
+	for _, term := range equipmentTerms {
+		if !kp.Has(term.tool) {
+			unavailable = append(unavailable, term.tool)
+		}
+	}
+	if len(unavailable) > 0 {
+		rules = append(rules, "Do NOT use: "+strings.Join(unavailable, ", "))
+		rules = append(rules, "Choose foods and cooking methods that work without that equipment; the step examples below only show the format")
+	}
+	return rules
+}
+
+// stepEquipment lists the tools a step mentions
+func stepEquipment(step string) []string {
+	words := paddedWords(step)
+	var tools []string
+	for _, term := range equipmentTerms {
+		for _, use := range term.uses {
+			if strings.Contains(words, paddedWords(use)) {
+				tools = append(tools, term.tool)
+				break
+			}
+		}
+	}
+	return tools
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LLMProvider is implemented by every language model backend the meal generator can prompt
+type LLMProvider interface {
+	// Name returns a short identifier for logging, e.g. "gemini" or "openai"
+	Name() string
+	// Generate sends the request to the model and returns the raw text of the first completion.
+	// Implementations must abandon the call when ctx is cancelled.
+	Generate(ctx context.Context, req LLMRequest) (string, error)
+}
+
+// LLMRequest is a provider-agnostic completion request
+type LLMRequest struct {
+	Prompt string
+	// Schema, when set, asks the provider for JSON output matching it. Providers without
+	// a structured output mode may ignore it; callers still validate the result.
+	Schema     *JSONSchema
+	SchemaName string
+}
+
+// LLMConfig selects and configures an LLMProvider
+type LLMConfig struct {
+	Provider          string // gemini, openai or fake
+	Model             string
+	APIKey            string
+	BaseURL           string
+	FakeResponsesPath string
+	RepairAttempts    int // extra prompts allowed to fix output that fails schema validation
+}
+
+const defaultLLMRepairAttempts = 2
+
+const (
+	LLMProviderGemini = "gemini"
+	LLMProviderOpenAI = "openai"
+	LLMProviderFake   = "fake"
+)
+
+// LLMConfigFromEnv reads the provider configuration from environment variables.
+// LLM_PROVIDER defaults to gemini; the API key is taken from the provider specific variable.
+func LLMConfigFromEnv() LLMConfig {
+	cfg := LLMConfig{
+		Provider:          strings.ToLower(strings.TrimSpace(os.Getenv("LLM_PROVIDER"))),
+		Model:             os.Getenv("LLM_MODEL"),
+		BaseURL:           os.Getenv("LLM_BASE_URL"),
+		FakeResponsesPath: os.Getenv("FAKE_LLM_RESPONSES"),
+		RepairAttempts:    defaultLLMRepairAttempts,
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = LLMProviderGemini
+	}
+	if v, err := strconv.Atoi(os.Getenv("LLM_REPAIR_ATTEMPTS")); err == nil && v >= 0 {
+		cfg.RepairAttempts = v
+	}
+
+	switch cfg.Provider {
+	case LLMProviderGemini:
+		cfg.APIKey = os.Getenv("GEMINI_API_KEY")
+	case LLMProviderOpenAI:
+		cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+
+	return cfg
+}
+
+// NewLLMProvider builds the provider described by cfg
+func NewLLMProvider(cfg LLMConfig) (LLMProvider, error) {
+	switch cfg.Provider {
+	case LLMProviderGemini, "":
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY is required for the gemini provider")
+		}
+		return NewGeminiProvider(cfg.APIKey, cfg.Model, cfg.BaseURL), nil
+	case LLMProviderOpenAI:
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY is required for the openai provider")
+		}
+		return NewOpenAIProvider(cfg.APIKey, cfg.Model, cfg.BaseURL), nil
+	case LLMProviderFake:
+		if cfg.FakeResponsesPath == "" {
+			return nil, fmt.Errorf("FAKE_LLM_RESPONSES is required for the fake provider")
+		}
+		return LoadFakeProvider(cfg.FakeResponsesPath)
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.Provider)
+	}
+}
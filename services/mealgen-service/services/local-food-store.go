@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	_ "modernc.org/sqlite"
+)
+
+const localFoodSchema = `
+CREATE TABLE IF NOT EXISTS foods (
+	id          TEXT PRIMARY KEY,
+	description TEXT NOT NULL,
+	data_type   TEXT NOT NULL DEFAULT '',
+	brand       TEXT NOT NULL DEFAULT '',
+	gtin        TEXT NOT NULL DEFAULT '',
+	food        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS foods_gtin ON foods (gtin) WHERE gtin != '';
+-- Full-text index keyed by the rowid of foods
+CREATE VIRTUAL TABLE IF NOT EXISTS foods_fts USING fts5(
+	description,
+	brand,
+	tokenize = 'porter unicode61'
+);
+`
+
+const localFoodMaxResults = 20
+
+// LocalFood is a food as kept in the local store, with the fields it is indexed by
+type LocalFood struct {
+	Food     models.Food
+	DataType string // e.g. foundation, sr_legacy, survey or branded
+	GTIN     string // Barcode of branded foods
+}
+
+// LocalFoodStore is a SQLite food database searched with full-text search, so the
+// service can resolve foods without the remote API. It is filled by the usda-import
+// command.
+type LocalFoodStore struct {
+	db *sql.DB
+}
+
+func OpenLocalFoodStore(path string) (*LocalFoodStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local food store: %w", err)
+	}
+	// SQLite allows one writer at a time; a single connection avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(localFoodSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise local food store: %w", err)
+	}
+	return &LocalFoodStore{db: db}, nil
+}
+
+func (ls *LocalFoodStore) Name() string {
+	return "local"
+}
+
+// SearchFood finds foods whose description or brand contains every word of the name,
+// best match first. When no food has them all, foods with any of them are returned.
+func (ls *LocalFoodStore) SearchFood(ctx context.Context, foodName string) (*models.FoodAPIResult, error) {
+	terms := strings.Fields(paddedWords(foodName))
+	result := &models.FoodAPIResult{
+		ProviderName: ls.Name(),
+		SearchTag:    foodName,
+		PageNumber:   "0",
+		MaxResults:   strconv.Itoa(localFoodMaxResults),
+		TotalResults: "0",
+	}
+	if len(terms) == 0 {
+		return result, nil
+	}
+
+	for i := range terms {
+		terms[i] = `"` + terms[i] + `"*`
+	}
+	for _, query := range []string{strings.Join(terms, " AND "), strings.Join(terms, " OR ")} {
+		foods, err := ls.search(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(foods) > 0 {
+			result.Foods = foods
+			result.TotalResults = strconv.Itoa(len(foods))
+			break
+		}
+		if len(terms) == 1 {
+			break
+		}
+	}
+	return result, nil
+}
+
+func (ls *LocalFoodStore) search(ctx context.Context, match string) ([]models.Food, error) {
+	// Description matches count double brand matches
+	rows, err := ls.db.QueryContext(ctx, `
+		SELECT f.food FROM foods_fts
+		JOIN foods f ON f.rowid = foods_fts.rowid
+		WHERE foods_fts MATCH ?
+		ORDER BY bm25(foods_fts, 2.0, 1.0)
+		LIMIT ?`, match, localFoodMaxResults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search local foods: %w", err)
+	}
+	defer rows.Close()
+	return scanLocalFoods(rows)
+}
+
+// SearchFoodByBarcode returns a page of the branded foods with the barcode, matching
+// it with or without leading zeros
+func (ls *LocalFoodStore) SearchFoodByBarcode(ctx context.Context, barcode string, pageNumber int, maxResults int) (*models.FoodAPIResult, error) {
+	forms := BarcodeForms(barcode)
+	result := &models.FoodAPIResult{
+		ProviderName: ls.Name(),
+		SearchTag:    barcode,
+		PageNumber:   strconv.Itoa(pageNumber),
+		MaxResults:   strconv.Itoa(maxResults),
+		TotalResults: "0",
+	}
+	if len(forms) == 0 || maxResults <= 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(forms)), ", ")
+	args := make([]any, len(forms), len(forms)+2)
+	for i, form := range forms {
+		args[i] = form
+	}
+
+	var total int
+	if err := ls.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM foods WHERE gtin IN (`+placeholders+`)`, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to look up barcode %s: %w", barcode, err)
+	}
+	result.TotalResults = strconv.Itoa(total)
+
+	rows, err := ls.db.QueryContext(ctx, `SELECT food FROM foods WHERE gtin IN (`+placeholders+`) ORDER BY id LIMIT ? OFFSET ?`,
+		append(args, maxResults, pageNumber*maxResults)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up barcode %s: %w", barcode, err)
+	}
+	defer rows.Close()
+	if result.Foods, err = scanLocalFoods(rows); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func scanLocalFoods(rows *sql.Rows) ([]models.Food, error) {
+	var foods []models.Food
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return nil, fmt.Errorf("failed to read local food: %w", err)
+		}
+		var food models.Food
+		if err := json.Unmarshal([]byte(body), &food); err != nil {
+			return nil, fmt.Errorf("failed to decode local food: %w", err)
+		}
+		foods = append(foods, food)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read local foods: %w", err)
+	}
+	return foods, nil
+}
+
+// SaveFoods inserts or replaces foods in one transaction
+func (ls *LocalFoodStore) SaveFoods(ctx context.Context, foods []LocalFood) error {
+	tx, err := ls.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start import: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, lf := range foods {
+		body, err := json.Marshal(lf.Food)
+		if err != nil {
+			return fmt.Errorf("failed to encode food %s: %w", lf.Food.FoodID, err)
+		}
+		// Upsert so a re-imported food keeps its rowid, and with it its index entry
+		var rowid int64
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO foods (id, description, data_type, brand, gtin, food) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET description = excluded.description, data_type = excluded.data_type,
+				brand = excluded.brand, gtin = excluded.gtin, food = excluded.food
+			RETURNING rowid`,
+			lf.Food.FoodID, lf.Food.FoodName, lf.DataType, lf.Food.BrandName, lf.GTIN, string(body)).Scan(&rowid); err != nil {
+			return fmt.Errorf("failed to save food %s: %w", lf.Food.FoodID, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM foods_fts WHERE rowid = ?`, rowid); err != nil {
+			return fmt.Errorf("failed to index food %s: %w", lf.Food.FoodID, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO foods_fts (rowid, description, brand) VALUES (?, ?, ?)`,
+			rowid, lf.Food.FoodName, lf.Food.BrandName); err != nil {
+			return fmt.Errorf("failed to index food %s: %w", lf.Food.FoodID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit import: %w", err)
+	}
+	return nil
+}
+
+// Count returns how many foods the store holds
+func (ls *LocalFoodStore) Count(ctx context.Context) (int, error) {
+	var n int
+	if err := ls.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM foods`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count local foods: %w", err)
+	}
+	return n, nil
+}
+
+func (ls *LocalFoodStore) Close() error {
+	return ls.db.Close()
+}
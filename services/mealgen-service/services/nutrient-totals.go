@@ -0,0 +1,249 @@
+package services
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// referenceIntakeData is the bundled reference intake table. vitamin_b is totalled but
+// not compared, since the food data does not say which B vitamin it is.
+//
+//go:embed reference-intakes.json
+var referenceIntakeData []byte
+
+const (
+	defaultReferenceAge = 30
+	minReferenceAge     = 9 // Youngest group in the table
+)
+
+// intakeNutrients are the nutrients compared, in report order
+var intakeNutrients = []models.Nutrient{
+	models.NutrientFiber, models.NutrientSodium, models.NutrientPotassium, models.NutrientCalcium,
+	models.NutrientIron, models.NutrientVitaminA, models.NutrientVitaminC, models.NutrientVitaminD,
+}
+
+type intakeValue struct {
+	Target float64 `json:"target"`
+	Upper  float64 `json:"upper"`
+}
+
+type referenceIntakeTable struct {
+	Source string            `json:"source"`
+	Units  map[string]string `json:"units"`
+	Groups []struct {
+		Gender  string                 `json:"gender"`
+		MinAge  int                    `json:"min_age"`
+		MaxAge  int                    `json:"max_age"`
+		Intakes map[string]intakeValue `json:"intakes"`
+	} `json:"groups"`
+	LifeStages []struct {
+		Name    string                 `json:"name"`
+		Match   []string               `json:"match"`
+		Intakes map[string]intakeValue `json:"intakes"`
+	} `json:"life_stages"`
+}
+
+var referenceIntakeTableData = mustParseReferenceIntakes(referenceIntakeData)
+
+func mustParseReferenceIntakes(data []byte) referenceIntakeTable {
+	var table referenceIntakeTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		panic(fmt.Sprintf("invalid bundled reference intakes: %v", err))
+	}
+	return table
+}
+
+// ReferenceIntakes are the daily targets and upper limits that apply to one user
+type ReferenceIntakes struct {
+	Group   string
+	units   map[string]string
+	intakes map[string]intakeValue
+}
+
+// ReferenceIntakesFor picks the table group for an age and gender, then applies any
+// pregnancy or lactation overrides. Unknown ages use an adult; an unknown gender takes
+// the higher target and the lower upper limit of the male and female groups.
+func ReferenceIntakesFor(age int, gender string, lifeStages []string) *ReferenceIntakes {
+	if age <= 0 {
+		age = defaultReferenceAge
+	}
+	if age < minReferenceAge {
+		age = minReferenceAge
+	}
+
+	genders := []string{"male", "female"}
+	label := "adult"
+	switch g := strings.ToLower(strings.TrimSpace(gender)); {
+	case g == "male" || g == "m" || g == "man":
+		genders, label = []string{"male"}, "male"
+	case g == "female" || g == "f" || g == "woman":
+		genders, label = []string{"female"}, "female"
+	}
+
+	ref := &ReferenceIntakes{units: referenceIntakeTableData.Units, intakes: make(map[string]intakeValue)}
+	for _, group := range referenceIntakeTableData.Groups {
+		if age < group.MinAge || age > group.MaxAge || !slices.Contains(genders, group.Gender) {
+			continue
+		}
+		if ref.Group == "" {
+			if group.MaxAge >= 200 {
+				ref.Group = fmt.Sprintf("%s %d+", label, group.MinAge)
+			} else {
+				ref.Group = fmt.Sprintf("%s %d-%d", label, group.MinAge, group.MaxAge)
+			}
+		}
+		for nutrient, value := range group.Intakes {
+			existing, ok := ref.intakes[nutrient]
+			if !ok {
+				ref.intakes[nutrient] = value
+				continue
+			}
+			existing.Target = math.Max(existing.Target, value.Target)
+			if value.Upper > 0 && (existing.Upper == 0 || value.Upper < existing.Upper) {
+				existing.Upper = value.Upper
+			}
+			ref.intakes[nutrient] = existing
+		}
+	}
+
+	for _, stage := range referenceIntakeTableData.LifeStages {
+		if !matchesAnyTerm(lifeStages, stage.Match) {
+			continue
+		}
+		ref.Group += ", " + stage.Name
+		for nutrient, value := range stage.Intakes {
+			ref.intakes[nutrient] = value
+		}
+	}
+	return ref
+}
+
+// Compare checks a day's totals against every reference intake. Nutrients no food
+// reported are marked unknown rather than counted as a shortfall.
+func (ref *ReferenceIntakes) Compare(totals models.NutrientVector) []models.IntakeComparison {
+	if ref == nil {
+		return nil
+	}
+	var comparisons []models.IntakeComparison
+	for _, nutrient := range intakeNutrients {
+		intake, ok := ref.intakes[nutrient.String()]
+		if !ok || intake.Target <= 0 {
+			continue
+		}
+		amount, known := totals.Get(nutrient)
+		status := models.IntakeOK
+		switch {
+		case !known:
+			status = models.IntakeUnknown
+		case intake.Upper > 0 && amount > intake.Upper:
+			status = models.IntakeExcess
+		case amount < intake.Target:
+			status = models.IntakeShortfall
+		}
+		comparisons = append(comparisons, models.IntakeComparison{
+			Nutrient:        nutrient.String(),
+			Unit:            ref.units[nutrient.String()],
+			Amount:          roundTarget(amount),
+			Target:          intake.Target,
+			Upper:           intake.Upper,
+			PercentOfTarget: math.Round(amount / intake.Target * 100),
+			Status:          status,
+			Incomplete:      known && totals.Partial(nutrient),
+		})
+	}
+	return comparisons
+}
+
+// AddNutritionTotals fills in the nutrient totals of every meal and day, compares each
+// day with the reference intakes, and returns the plan-level summary. Reserved
+// placeholder meals count with their estimated macros only.
+func AddNutritionTotals(data map[string]models.DayAPIMeals, ref *ReferenceIntakes) *models.PlanNutrition {
+	if len(data) == 0 {
+		return nil
+	}
+
+	var plan models.NutrientVector
+	for key, day := range data {
+		var dayTotals models.NutrientVector
+		for i := range day.Meals {
+			meal := &day.Meals[i]
+			mealTotals := SumNutrients(meal.Foods)
+			if meal.Reserved != nil {
+				mealTotals = models.NutrientVector{}
+				mealTotals.Set(models.NutrientCalories, meal.Macros.Calories)
+				mealTotals.Set(models.NutrientProtein, meal.Macros.Proteins)
+				mealTotals.Set(models.NutrientCarbohydrate, meal.Macros.Carbs)
+				mealTotals.Set(models.NutrientFat, meal.Macros.Fats)
+			}
+			rounded := roundNutrients(mealTotals)
+			meal.Nutrients = &rounded
+			dayTotals = dayTotals.Add(mealTotals)
+		}
+
+		rounded := roundNutrients(dayTotals)
+		day.Nutrients = &rounded
+		day.Intake = ref.Compare(dayTotals)
+		data[key] = day
+		plan = plan.Add(dayTotals)
+	}
+
+	average := plan.Scale(1 / float64(len(data)))
+	summary := &models.PlanNutrition{
+		Days:         len(data),
+		Totals:       roundNutrients(plan),
+		DailyAverage: roundNutrients(average),
+		Intake:       ref.Compare(average),
+	}
+	if ref != nil {
+		summary.ReferenceGroup = ref.Group
+	}
+	for _, comparison := range summary.Intake {
+		switch comparison.Status {
+		case models.IntakeShortfall:
+			summary.Shortfalls = append(summary.Shortfalls, comparison.Nutrient)
+		case models.IntakeExcess:
+			summary.Excesses = append(summary.Excesses, comparison.Nutrient)
+		}
+	}
+	return summary
+}
+
+// SumNutrients totals the selected serving of every food
+func SumNutrients(foods []models.Food) models.NutrientVector {
+	var totals models.NutrientVector
+	for _, food := range foods {
+		if len(food.Servings) == 0 {
+			continue
+		}
+		totals = totals.Add(food.Servings[0].Nutrients())
+	}
+	return totals
+}
+
+// MealNutrients returns the rounded nutrient totals of a meal's foods
+func MealNutrients(foods []models.Food) models.NutrientTotals {
+	return roundNutrients(SumNutrients(foods))
+}
+
+func roundNutrients(v models.NutrientVector) models.NutrientTotals {
+	return v.Map(roundTarget).Totals()
+}
+
+// matchesAnyTerm reports whether any selected value contains one of the terms as words
+func matchesAnyTerm(selected, terms []string) bool {
+	for _, value := range selected {
+		words := paddedWords(value)
+		for _, term := range terms {
+			if strings.Contains(words, paddedWords(term)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"math"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// Energy per gram of each macronutrient
+const (
+	kcalPerGramProtein = 4.0
+	kcalPerGramCarbs   = 4.0
+	kcalPerGramFat     = 9.0
+)
+
+const (
+	defaultDailyCalories = 2000.0
+	minDailyCalories     = 1200.0
+	defaultActivity      = 1.2
+	formulaMifflinStJeor = "mifflin-st-jeor"
+	formulaKatchMcArdle  = "katch-mcardle"
+	formulaDefault       = "default"
+	defaultMacroPreset   = "balanced"
+)
+
+// activityFactors multiply BMR into TDEE. Keywords match whole words and are checked
+// in order, so "inactive" and "not very active" are read as sedentary before "very",
+// and "lightly active" as light before "active".
+var activityFactors = []struct {
+	keywords []string
+	factor   float64
+}{
+	{[]string{"sedentary", "inactive", "not active", "not very active", "no exercise"}, 1.2},
+	{[]string{"extra", "extremely", "athlete"}, 1.9},
+	{[]string{"light", "lightly"}, 1.375},
+	{[]string{"moderate", "moderately"}, 1.55},
+	{[]string{"very", "active"}, 1.725},
+}
+
+// goalAdjustments scale TDEE for the user's goal. Keywords match whole words and are
+// checked in order; "lean" alone is not a deficit, so "lean bulk" and "build lean
+// muscle" stay a surplus.
+var goalAdjustments = []struct {
+	keywords []string
+	factor   float64
+}{
+	{[]string{"maintain", "maintenance", "recomp", "recomposition"}, 0},
+	{[]string{"lose", "losing", "loss", "cut", "cutting", "lean out", "shred", "deficit"}, -0.20},
+	{[]string{"lean bulk"}, 0.10},
+	{[]string{"bulk", "bulking", "gain weight"}, 0.15},
+	{[]string{"gain", "build", "muscle", "surplus"}, 0.10},
+}
+
+// macroSplit is the share of calories from protein, carbs and fat
+type macroSplit struct {
+	protein, carbs, fat float64
+}
+
+// macroPresets map MacroPreference values to calorie splits
+var macroPresets = map[string]macroSplit{
+	"balanced":     {0.30, 0.40, 0.30},
+	"high protein": {0.40, 0.30, 0.30},
+	"low carb":     {0.35, 0.20, 0.45},
+	"keto":         {0.25, 0.05, 0.70},
+	"low fat":      {0.30, 0.50, 0.20},
+	"high carb":    {0.20, 0.55, 0.25},
+	"zone":         {0.30, 0.40, 0.30},
+}
+
+var macroPresetAliases = map[string]string{
+	"ketogenic": "keto",
+	"endurance": "high carb",
+	"protein":   "high protein",
+	"moderate":  "balanced",
+}
+
+// CompleteDailyTargets fills in any daily goal the request leaves at zero. Calories come
+// from, in order: the goal itself, CaloricIntake, or BMR x activity adjusted for the
+// goal. Missing macros split the calories not already claimed by the given ones using
+// the MacroPreference preset. The request is updated in place and the derivation is
+// returned so it can be echoed to the client.
+func CompleteDailyTargets(reqBody *models.RequestBody) models.DailyTargets {
+	targets := models.DailyTargets{}
+
+	bmr, formula := BasalMetabolicRate(reqBody.Weight, reqBody.Height, reqBody.Age, reqBody.Gender, reqBody.BodyFatPercentage)
+	activity := ActivityFactor(reqBody.ActivityLevel)
+	if bmr > 0 {
+		targets.BMR = roundTarget(bmr)
+		targets.TDEE = roundTarget(bmr * activity)
+		targets.Formula = formula
+		targets.ActivityFactor = activity
+	}
+
+	if reqBody.DailyCaloriesGoal <= 0 {
+		switch {
+		case reqBody.CaloricIntake > 0:
+			reqBody.DailyCaloriesGoal = float64(reqBody.CaloricIntake)
+		case bmr > 0:
+			adjustment := GoalAdjustment(reqBody.Goal)
+			targets.GoalAdjustment = roundTarget(bmr * activity * adjustment)
+			reqBody.DailyCaloriesGoal = math.Max(bmr*activity*(1+adjustment), minDailyCalories)
+		case reqBody.DailyProtiensGoal > 0 && reqBody.DailyCarbsGoal > 0 && reqBody.DailyFatsGoal > 0:
+			reqBody.DailyCaloriesGoal = reqBody.DailyProtiensGoal*kcalPerGramProtein +
+				reqBody.DailyCarbsGoal*kcalPerGramCarbs + reqBody.DailyFatsGoal*kcalPerGramFat
+		default:
+			reqBody.DailyCaloriesGoal = defaultDailyCalories
+			targets.Formula = formulaDefault
+		}
+		reqBody.DailyCaloriesGoal = roundTarget(reqBody.DailyCaloriesGoal)
+		targets.Computed = append(targets.Computed, "calories")
+	}
+
+	preset, split := macroPreset(reqBody.MacroPreference, reqBody.DietType)
+	targets.MacroPreference = preset
+	targets.Computed = append(targets.Computed, fillMissingMacros(reqBody, split)...)
+
+	targets.Calories = reqBody.DailyCaloriesGoal
+	targets.Proteins = reqBody.DailyProtiensGoal
+	targets.Carbs = reqBody.DailyCarbsGoal
+	targets.Fats = reqBody.DailyFatsGoal
+	return targets
+}
+
+// BasalMetabolicRate uses Katch-McArdle when body fat is known and Mifflin-St Jeor
+// otherwise. Weight is in kg and height in cm; it returns 0 when data is missing.
+func BasalMetabolicRate(weightKg, heightCm, age int, gender string, bodyFatPercentage float64) (float64, string) {
+	if weightKg <= 0 {
+		return 0, ""
+	}
+
+	if bodyFatPercentage > 0 && bodyFatPercentage < 70 {
+		leanMass := float64(weightKg) * (1 - bodyFatPercentage/100)
+		return 370 + 21.6*leanMass, formulaKatchMcArdle
+	}
+
+	if heightCm <= 0 || age <= 0 {
+		return 0, ""
+	}
+
+	bmr := 10*float64(weightKg) + 6.25*float64(heightCm) - 5*float64(age)
+	switch strings.ToLower(strings.TrimSpace(gender)) {
+	case "male", "m", "man":
+		bmr += 5
+	case "female", "f", "woman":
+		bmr -= 161
+	default:
+		// Midpoint of the male and female constants
+		bmr -= 78
+	}
+	return bmr, formulaMifflinStJeor
+}
+
+// ActivityFactor maps a free-form activity level to a TDEE multiplier
+func ActivityFactor(activityLevel string) float64 {
+	for _, a := range activityFactors {
+		if matchesAnyTerm([]string{activityLevel}, a.keywords) {
+			return a.factor
+		}
+	}
+	return defaultActivity
+}
+
+// GoalAdjustment returns the fraction of TDEE to add (negative for a deficit)
+func GoalAdjustment(goal string) float64 {
+	for _, adj := range goalAdjustments {
+		if matchesAnyTerm([]string{goal}, adj.keywords) {
+			return adj.factor
+		}
+	}
+	return 0
+}
+
+// macroPreset resolves a MacroPreference to a preset name and split. A keto diet with no
+// explicit preference uses the keto split; anything unknown is balanced.
+func macroPreset(preference, dietType string) (string, macroSplit) {
+	name := strings.TrimSpace(strings.ReplaceAll(strings.ToLower(preference), "-", " "))
+	if alias, ok := macroPresetAliases[name]; ok {
+		name = alias
+	}
+	if name == "" && strings.Contains(strings.ToLower(dietType), "keto") {
+		name = "keto"
+	}
+	if split, ok := macroPresets[name]; ok {
+		return name, split
+	}
+	return defaultMacroPreset, macroPresets[defaultMacroPreset]
+}
+
+// fillMissingMacros splits the calories left after the supplied macros across the
+// missing ones in proportion to the preset, and returns the names it filled
+func fillMissingMacros(reqBody *models.RequestBody, split macroSplit) []string {
+	type macro struct {
+		name   string
+		goal   *float64
+		share  float64
+		kcalPG float64
+	}
+	macros := []macro{
+		{"proteins", &reqBody.DailyProtiensGoal, split.protein, kcalPerGramProtein},
+		{"carbs", &reqBody.DailyCarbsGoal, split.carbs, kcalPerGramCarbs},
+		{"fats", &reqBody.DailyFatsGoal, split.fat, kcalPerGramFat},
+	}
+
+	remaining := reqBody.DailyCaloriesGoal
+	missingShare := 0.0
+	for _, m := range macros {
+		if *m.goal > 0 {
+			remaining -= *m.goal * m.kcalPG
+		} else {
+			missingShare += m.share
+		}
+	}
+	if missingShare == 0 {
+		return nil
+	}
+	remaining = math.Max(remaining, 0)
+
+	var filled []string
+	for _, m := range macros {
+		if *m.goal > 0 {
+			continue
+		}
+		*m.goal = roundTarget(remaining * m.share / missingShare / m.kcalPG)
+		filled = append(filled, m.name)
+	}
+	return filled
+}
+
+func roundTarget(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,62 @@
+package services
+
+import "testing"
+
+func TestActivityFactor(t *testing.T) {
+	tests := []struct {
+		level string
+		want  float64
+	}{
+		{"Sedentary", 1.2},
+		{"Inactive", 1.2},
+		{"not very active", 1.2},
+		{"Not active", 1.2},
+		{"Lightly active", 1.375},
+		{"light", 1.375},
+		{"Very lightly active", 1.375},
+		{"Moderately active", 1.55},
+		{"moderate", 1.55},
+		{"Very active", 1.725},
+		{"very-active", 1.725},
+		{"Active", 1.725},
+		{"Extra active", 1.9},
+		{"Extremely active", 1.9},
+		{"Athlete", 1.9},
+		{"", defaultActivity},
+		{"unknown", defaultActivity},
+		{"Reactive", defaultActivity},
+	}
+	for _, tt := range tests {
+		if got := ActivityFactor(tt.level); got != tt.want {
+			t.Errorf("ActivityFactor(%q) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestGoalAdjustment(t *testing.T) {
+	tests := []struct {
+		goal string
+		want float64
+	}{
+		{"Lose weight", -0.20},
+		{"Fat loss", -0.20},
+		{"Cutting", -0.20},
+		{"Lean out", -0.20},
+		{"Lose fat, build muscle", -0.20},
+		{"Maintain weight", 0},
+		{"Body recomposition", 0},
+		{"Lean bulk", 0.10},
+		{"Build lean muscle", 0.10},
+		{"Gain muscle", 0.10},
+		{"Bulk", 0.15},
+		{"Gain weight", 0.15},
+		{"Stay lean", 0},
+		{"Executive health", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := GoalAdjustment(tt.goal); got != tt.want {
+			t.Errorf("GoalAdjustment(%q) = %v, want %v", tt.goal, got, tt.want)
+		}
+	}
+}
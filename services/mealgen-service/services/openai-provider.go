@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultOpenAIModel   = "gpt-4o-mini"
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+)
+
+// OpenAIProvider talks to any OpenAI-compatible chat completions endpoint
+type OpenAIProvider struct {
+	apiKey  string
+	model   string
+	baseURL string
+	client  *http.Client
+}
+
+type OpenAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []OpenAIChatMessage   `json:"messages"`
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type OpenAIJSONSchema struct {
+	Name   string      `json:"name"`
+	Schema *JSONSchema `json:"schema"`
+	Strict bool        `json:"strict"`
+}
+
+type OpenAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type OpenAIChatResponse struct {
+	Choices []OpenAIChatChoice `json:"choices"`
+}
+
+type OpenAIChatChoice struct {
+	Message OpenAIChatMessage `json:"message"`
+}
+
+func NewOpenAIProvider(apiKey, model, baseURL string) *OpenAIProvider {
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	return &OpenAIProvider{
+		apiKey:  apiKey,
+		model:   model,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{},
+	}
+}
+
+func (op *OpenAIProvider) Name() string {
+	return LLMProviderOpenAI + "/" + op.model
+}
+
+func (op *OpenAIProvider) Generate(ctx context.Context, llmReq LLMRequest) (string, error) {
+	requestBody := OpenAIChatRequest{
+		Model: op.model,
+		Messages: []OpenAIChatMessage{
+			{Role: "user", Content: llmReq.Prompt},
+		},
+	}
+
+	if llmReq.Schema != nil {
+		name := llmReq.SchemaName
+		if name == "" {
+			name = "response"
+		}
+		requestBody.ResponseFormat = &OpenAIResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &OpenAIJSONSchema{Name: name, Schema: llmReq.Schema},
+		}
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", op.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+op.apiKey)
+
+	resp, err := op.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %v", err)
+	}
+
+	var response OpenAIChatResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("error unmarshaling response: %v", err)
+	}
+
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+
+	return response.Choices[0].Message.Content, nil
+}
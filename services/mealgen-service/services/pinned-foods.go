@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// NormalizeBarcode strips spaces and dashes from a barcode and reports whether what is
+// left is an EAN-8, UPC-A, EAN-13 or GTIN-14 code
+func NormalizeBarcode(code string) (string, bool) {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return code, false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return code, false
+		}
+	}
+	return code, true
+}
+
+// BarcodeForms lists the ways a barcode may be stored: as given, without leading zeros
+// and zero-padded to UPC-A, EAN-13 and GTIN-14 length
+func BarcodeForms(code string) []string {
+	code, ok := NormalizeBarcode(code)
+	if !ok {
+		return nil
+	}
+	trimmed := strings.TrimLeft(code, "0")
+	forms := []string{code}
+	for _, form := range []string{trimmed, padBarcode(trimmed, 12), padBarcode(trimmed, 13), padBarcode(trimmed, 14)} {
+		if form != "" && !slices.Contains(forms, form) {
+			forms = append(forms, form)
+		}
+	}
+	return forms
+}
+
+func padBarcode(code string, length int) string {
+	if len(code) > length {
+		return ""
+	}
+	return strings.Repeat("0", length-len(code)) + code
+}
+
+// PinnedFoodsFor returns the resolved pins that go in the named meal on date. Pins
+// without a date apply every day, and an empty date matches pins on any day.
+func PinnedFoodsFor(pins []models.PinnedFood, date, mealName string) []models.PinnedFood {
+	var matched []models.PinnedFood
+	for _, pin := range pins {
+		if pin.Food == nil || (pin.Date != "" && date != "" && pin.Date != date) {
+			continue
+		}
+		if mealNameMatches(mealName, pin.MealName) {
+			matched = append(matched, pin)
+		}
+	}
+	return matched
+}
+
+// LabelServing picks the serving printed on a product's label: the first one that is
+// not a plain 100 g or 100 ml reference amount
+func LabelServing(food models.Food) (models.Serving, bool) {
+	for _, serving := range food.Servings {
+		description := strings.ToLower(strings.ReplaceAll(serving.ServingDescription, " ", ""))
+		if description != "100g" && description != "100ml" {
+			return serving, true
+		}
+	}
+	if len(food.Servings) > 0 {
+		return food.Servings[0], true
+	}
+	return models.Serving{}, false
+}
+
+// pinnedFoodPromptRules tells the model which meals already hold a pinned product, so it
+// plans the other foods around it instead of adding it again
+func pinnedFoodPromptRules(pins []models.PinnedFood) string {
+	prompt := ""
+	for _, pin := range pins {
+		if pin.Food == nil || len(pin.Food.Servings) == 0 {
+			continue
+		}
+		when := "every day"
+		if pin.Date != "" {
+			when = pin.Date
+		}
+		serving := pin.Food.Servings[0]
+		macros := serving.Nutrients().Macros()
+		prompt += fmt.Sprintf("- %s (%s): %s, %s (Calories: %.0f, Protein: %.0fg, Carbs: %.0fg, Fat: %.0fg)\n",
+			pin.MealName, when, pin.Food.FoodName, serving.ServingDescription,
+			macros.Calories, macros.Proteins, macros.Carbs, macros.Fats)
+	}
+	if prompt == "" {
+		return ""
+	}
+	return "PINNED PRODUCTS (already in these meals at a fixed amount; do not list them in foods, plan the other foods to complement them):\n" + prompt + "\n"
+}
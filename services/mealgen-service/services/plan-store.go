@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// Supported plan store backends
+const (
+	PlanStoreSQLite = "sqlite"
+	PlanStoreMemory = "memory"
+	PlanStoreNone   = "none"
+)
+
+const (
+	defaultPlanStorePath = "plans.db"
+	defaultPlanListLimit = 20
+	maxPlanListLimit     = 100
+)
+
+// ErrPlanNotFound is returned when no plan has the requested ID
+var ErrPlanNotFound = errors.New("plan not found")
+
+// PlanStore persists generated plans together with the request that produced them
+type PlanStore interface {
+	// SavePlan stores a new plan, assigning its ID and timestamps
+	SavePlan(ctx context.Context, plan *models.StoredPlan) error
+	// UpdatePlan replaces the plan body of an existing plan and bumps UpdatedAt
+	UpdatePlan(ctx context.Context, plan *models.StoredPlan) error
+	GetPlan(ctx context.Context, id string) (*models.StoredPlan, error)
+	// ListUserPlans returns a user's plans, newest first
+	ListUserPlans(ctx context.Context, userID string, limit, offset int) ([]models.StoredPlanSummary, error)
+	Close() error
+}
+
+// PlanStoreConfig selects and configures the plan store backend
+type PlanStoreConfig struct {
+	Backend string
+	Path    string // SQLite database file
+}
+
+// PlanStoreConfigFromEnv reads PLAN_STORE (sqlite, memory or none) and PLAN_STORE_PATH
+func PlanStoreConfigFromEnv() PlanStoreConfig {
+	cfg := PlanStoreConfig{
+		Backend: strings.ToLower(strings.TrimSpace(os.Getenv("PLAN_STORE"))),
+		Path:    os.Getenv("PLAN_STORE_PATH"),
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = PlanStoreSQLite
+	}
+	if cfg.Path == "" {
+		cfg.Path = defaultPlanStorePath
+	}
+	return cfg
+}
+
+// NewPlanStore builds the configured backend. It returns a nil store for "none".
+func NewPlanStore(cfg PlanStoreConfig) (PlanStore, error) {
+	switch cfg.Backend {
+	case PlanStoreSQLite:
+		return NewSQLitePlanStore(cfg.Path)
+	case PlanStoreMemory:
+		return NewMemoryPlanStore(), nil
+	case PlanStoreNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown plan store %q (want %s, %s or %s)", cfg.Backend, PlanStoreSQLite, PlanStoreMemory, PlanStoreNone)
+	}
+}
+
+// NewPlanID returns a random 128-bit hex ID
+func NewPlanID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms; keep IDs unique regardless
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// SummarizePlan builds the list entry for a stored plan
+func SummarizePlan(plan *models.StoredPlan) models.StoredPlanSummary {
+	dates := make([]string, 0, len(plan.Plan.Data))
+	for key := range plan.Plan.Data {
+		dates = append(dates, key)
+	}
+	sort.Strings(dates)
+
+	return models.StoredPlanSummary{
+		ID:        plan.ID,
+		UserID:    plan.UserID,
+		Days:      len(dates),
+		Dates:     dates,
+		CreatedAt: plan.CreatedAt,
+		UpdatedAt: plan.UpdatedAt,
+	}
+}
+
+// ClampPlanListLimit applies the default and maximum page size for plan listings
+func ClampPlanListLimit(limit int) int {
+	if limit <= 0 {
+		return defaultPlanListLimit
+	}
+	if limit > maxPlanListLimit {
+		return maxPlanListLimit
+	}
+	return limit
+}
+
+// MemoryPlanStore keeps plans in process memory. Plans are lost on restart, so it is
+// meant for local runs and tests. Plans are stored as JSON so callers never share maps
+// or slices with the store.
+type MemoryPlanStore struct {
+	mu    sync.RWMutex
+	plans map[string][]byte
+}
+
+func NewMemoryPlanStore() *MemoryPlanStore {
+	return &MemoryPlanStore{plans: make(map[string][]byte)}
+}
+
+func (ms *MemoryPlanStore) SavePlan(ctx context.Context, plan *models.StoredPlan) error {
+	now := time.Now().UTC()
+	plan.ID = NewPlanID()
+	plan.CreatedAt = now
+	plan.UpdatedAt = now
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.plans[plan.ID] = data
+	return nil
+}
+
+func (ms *MemoryPlanStore) UpdatePlan(ctx context.Context, plan *models.StoredPlan) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	existing, err := ms.decode(plan.ID)
+	if err != nil {
+		return err
+	}
+	plan.CreatedAt = existing.CreatedAt
+	plan.UpdatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	ms.plans[plan.ID] = data
+	return nil
+}
+
+func (ms *MemoryPlanStore) GetPlan(ctx context.Context, id string) (*models.StoredPlan, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.decode(id)
+}
+
+func (ms *MemoryPlanStore) ListUserPlans(ctx context.Context, userID string, limit, offset int) ([]models.StoredPlanSummary, error) {
+	ms.mu.RLock()
+	var plans []models.StoredPlan
+	for id := range ms.plans {
+		plan, err := ms.decode(id)
+		if err != nil {
+			ms.mu.RUnlock()
+			return nil, err
+		}
+		if plan.UserID == userID {
+			plans = append(plans, *plan)
+		}
+	}
+	ms.mu.RUnlock()
+
+	sort.Slice(plans, func(i, j int) bool { return plans[i].CreatedAt.After(plans[j].CreatedAt) })
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(plans) {
+		return []models.StoredPlanSummary{}, nil
+	}
+	plans = plans[offset:]
+	if limit = ClampPlanListLimit(limit); len(plans) > limit {
+		plans = plans[:limit]
+	}
+
+	summaries := make([]models.StoredPlanSummary, 0, len(plans))
+	for i := range plans {
+		summaries = append(summaries, SummarizePlan(&plans[i]))
+	}
+	return summaries, nil
+}
+
+func (ms *MemoryPlanStore) Close() error {
+	return nil
+}
+
+// decode returns a fresh copy of a stored plan; callers must hold ms.mu
+func (ms *MemoryPlanStore) decode(id string) (*models.StoredPlan, error) {
+	data, ok := ms.plans[id]
+	if !ok {
+		return nil, ErrPlanNotFound
+	}
+	var plan models.StoredPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode plan %s: %w", id, err)
+	}
+	return &plan, nil
+}
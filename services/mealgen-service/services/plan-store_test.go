@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// planWithGaps is a one-food plan whose serving reports calories and protein only
+func planWithGaps() models.MealPlanAPIResponse {
+	var v models.NutrientVector
+	v.Set(models.NutrientCalories, 130)
+	v.Set(models.NutrientProtein, 2.7)
+	serving := models.Serving{ServingID: "1", MetricServingAmount: "100", MetricServingUnit: "g"}
+	serving.SetNutrients(v)
+
+	return models.MealPlanAPIResponse{Data: map[string]models.DayAPIMeals{
+		"2026-10-16": {Date: "2026-10-16", Meals: []models.MealAPIItems{{
+			MealName: "Lunch",
+			Foods:    []models.Food{{FoodID: "rice", FoodName: "Rice", Servings: []models.Serving{serving}}},
+		}}},
+	}}
+}
+
+func TestPlanStoresKeepUnknownNutrientsLikeResponses(t *testing.T) {
+	sqlite, err := NewSQLitePlanStore(filepath.Join(t.TempDir(), "plans.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+
+	live, err := json.Marshal(planWithGaps().Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]PlanStore{"memory": NewMemoryPlanStore(), "sqlite": sqlite} {
+		plan := &models.StoredPlan{Plan: planWithGaps()}
+		if err := store.SavePlan(context.Background(), plan); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		stored, err := store.GetPlan(context.Background(), plan.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		read, err := json.Marshal(stored.Plan.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(read) != string(live) {
+			t.Errorf("%s: stored plan reads back as\n%s\nwant the live response\n%s", name, read, live)
+		}
+		nutrients := stored.Plan.Data["2026-10-16"].Meals[0].Foods[0].Servings[0].Nutrients()
+		if !nutrients.Known(models.NutrientCalories) || nutrients.Known(models.NutrientFiber) {
+			t.Errorf("%s: calories known %v, fiber known %v; want true and false", name,
+				nutrients.Known(models.NutrientCalories), nutrients.Known(models.NutrientFiber))
+		}
+	}
+}
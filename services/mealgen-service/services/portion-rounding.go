@@ -0,0 +1,125 @@
+package services
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// Portion categories used to pick a rounding increment
+const (
+	PortionOil     = "oil"
+	PortionFat     = "fat"
+	PortionGrain   = "grain"
+	PortionProtein = "protein"
+	PortionProduce = "produce"
+	PortionOther   = "other"
+)
+
+// defaultPortionIncrements are the gram steps portions are rounded to by category
+var defaultPortionIncrements = map[string]float64{
+	PortionOil:     1,
+	PortionFat:     5,
+	PortionGrain:   5,
+	PortionProtein: 5,
+	PortionProduce: 10,
+	PortionOther:   5,
+}
+
+// uncountableWords mark foods that share a name with a countable one but are not eaten
+// in whole pieces, such as "apple juice" or "egg salad"
+var uncountableWords = []string{"juice", "sauce", "salad", "powder", "flour", "chips", "pie", "milk", "crumbs", "butter", "jam"}
+
+// PortionIncrements maps a portion category to its rounding step in grams
+type PortionIncrements map[string]float64
+
+// PortionIncrementsFromEnv reads PORTION_INCREMENTS, e.g. "grain=5,oil=1,produce=10",
+// on top of the defaults
+func PortionIncrementsFromEnv() PortionIncrements {
+	increments := make(PortionIncrements, len(defaultPortionIncrements))
+	for category, step := range defaultPortionIncrements {
+		increments[category] = step
+	}
+	for _, pair := range strings.Split(os.Getenv("PORTION_INCREMENTS"), ",") {
+		category, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		step, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		category = strings.ToLower(strings.TrimSpace(category))
+		if _, known := defaultPortionIncrements[category]; !known || err != nil || step <= 0 {
+			log.Printf("⚠️ Ignoring portion increment %q", pair)
+			continue
+		}
+		increments[category] = step
+	}
+	return increments
+}
+
+// StepFor returns the rounding step for a classified food
+func (pi PortionIncrements) StepFor(c FoodClassification) float64 {
+	if step := pi[PortionCategoryOf(c)]; step > 0 {
+		return step
+	}
+	return defaultPortionIncrements[PortionOther]
+}
+
+// PortionCategoryOf places a classified food in a rounding category. Pure fats such as
+// oil are measured finely, and fat-dominant dairy such as cheese is rounded like fat.
+func PortionCategoryOf(c FoodClassification) string {
+	switch c.Class {
+	case ClassFat:
+		if c.PureFat() {
+			return PortionOil
+		}
+		return PortionFat
+	case ClassDairy:
+		if c.FatShare() >= fatShare {
+			return PortionFat
+		}
+		return PortionProtein
+	case ClassProtein:
+		return PortionProtein
+	case ClassStarchyCarb:
+		return PortionGrain
+	case ClassFruitVegetable:
+		return PortionProduce
+	default:
+		return PortionOther
+	}
+}
+
+// CountablePiece returns the weight and name of one piece for foods eaten whole, such
+// as eggs, slices of bread, tortillas and pieces of fruit. Only the head noun counts, so
+// "Banana bread" is sliced like bread rather than counted in bananas.
+func CountablePiece(food models.Food) (float64, string, bool) {
+	words := paddedWords(food.FoodName)
+	for _, word := range uncountableWords {
+		if containsWord(words, word) {
+			return 0, "", false
+		}
+	}
+
+	measure := ""
+	if len(food.Servings) > 0 {
+		measure = food.Servings[0].HouseholdMeasure
+	}
+	head := headPhrase(food.FoodName)
+	for _, piece := range pieceWeights {
+		if !isHeadNoun(head, piece.keyword) {
+			continue
+		}
+		if piece.unit == "" {
+			break
+		}
+		size, factor := pieceSize(measure)
+		if size != "" {
+			return piece.grams * factor, size + " " + piece.unit, true
+		}
+		return piece.grams, piece.unit, true
+	}
+	return 0, "", false
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+func TestCountablePieceMatchesHeadNoun(t *testing.T) {
+	tests := []struct {
+		name      string
+		countable bool
+		unit      string
+	}{
+		{"Orange Chicken", false, ""},
+		{"Banana Bread", true, "slice"},
+		{"Egg Noodles", false, ""},
+		{"Egg Fried Rice", false, ""},
+		{"Apple juice", false, ""},
+		{"Eggs, whole, raw", true, "egg"},
+		{"Egg whites", true, "egg white"},
+		{"2 large eggs (boiled)", true, "egg"},
+		{"Bananas, raw", true, "banana"},
+		{"Oranges, raw, navels", true, "orange"},
+		{"Bread, whole-wheat, commercially prepared", true, "slice"},
+		{"Chocolate protein bar", true, "bar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, unit, ok := CountablePiece(models.Food{FoodName: tt.name})
+			if ok != tt.countable || unit != tt.unit {
+				t.Errorf("CountablePiece(%q) = %q, %v; want %q, %v", tt.name, unit, ok, tt.unit, tt.countable)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// Kinds of reserved meal slots
+const (
+	ReservedTreat  = "treat"
+	ReservedSocial = "social"
+	ReservedDrinks = "drinks"
+)
+
+// Estimated macros held back for each reserved slot. A treat is a typical dessert or
+// snack, a social meal a restaurant main with sides. Drinks are per standard drink; the
+// calories include ~100 kcal of alcohol, which none of the macros account for.
+var (
+	treatEstimate  = models.MacroTarget{Calories: 450, Proteins: 6, Carbs: 55, Fats: 22}
+	socialEstimate = models.MacroTarget{Calories: 950, Proteins: 40, Carbs: 90, Fats: 45}
+	drinkEstimate  = models.MacroTarget{Calories: 140, Proteins: 0, Carbs: 10, Fats: 0}
+)
+
+const (
+	maxReservedDrinks = 12
+	// Planned meals keep at least this share of their normal target. A day whose
+	// reservations exceed the budget runs over rather than leaving meals empty.
+	minPlannedMealShare = 0.4
+)
+
+// ReservationsFor returns the slots reserved on a date. Treats and social meals take
+// the place of the planned meal they name; drinks are added on top of the day.
+func ReservationsFor(reqBody models.RequestBody, date string) []models.ReservedMeal {
+	var reserved []models.ReservedMeal
+	for _, option := range []struct {
+		kind     string
+		meals    *models.MealOption
+		estimate models.MacroTarget
+	}{
+		{ReservedTreat, reqBody.TreatMeals, treatEstimate},
+		{ReservedSocial, reqBody.SocialMeals, socialEstimate},
+	} {
+		if option.meals == nil || !option.meals.IsSelected {
+			continue
+		}
+		for _, entry := range option.meals.Entries {
+			if entry.Date != date {
+				continue
+			}
+			reserved = append(reserved, models.ReservedMeal{
+				Kind:      option.kind,
+				Replaces:  strings.TrimSpace(entry.MealName),
+				Estimated: option.estimate,
+			})
+		}
+	}
+
+	if reqBody.IsDrinks {
+		for _, entry := range reqBody.DrinkEntries {
+			if entry.Date != date {
+				continue
+			}
+			drinks := parseDrinkCount(entry.NumberOfDrinks)
+			reserved = append(reserved, models.ReservedMeal{
+				Kind:      ReservedDrinks,
+				WithMeal:  strings.TrimSpace(entry.MealName),
+				Drinks:    drinks,
+				Estimated: scaleMacros(drinkEstimate, float64(drinks)),
+			})
+		}
+	}
+	return reserved
+}
+
+// ApplyReservations turns the meals a treat or social meal replaces into placeholders,
+// appends placeholders for the remaining reservations, and spreads what is left of the
+// daily targets over the planned meals
+func ApplyReservations(day models.DayLLMMeals, reserved []models.ReservedMeal, daily models.MacroTarget, mealsPerDay int) models.DayLLMMeals {
+	meals := make([]models.MealLLMItems, 0, len(day.Meals)+len(reserved))
+	meals = append(meals, day.Meals...)
+
+	remaining := daily
+	for _, slot := range reserved {
+		remaining = subtractMacros(remaining, slot.Estimated)
+
+		index := -1
+		if slot.Replaces != "" {
+			for i := range meals {
+				if meals[i].Reserved == nil && mealNameMatches(meals[i].MealName, slot.Replaces) {
+					index = i
+					break
+				}
+			}
+		}
+		if index >= 0 {
+			meals[index].Reserved = &slot
+			meals[index].Foods = nil
+			meals[index].MacroTarget = slot.Estimated
+			continue
+		}
+
+		// Nothing planned to replace, so the slot becomes a meal of its own
+		placeholder := models.MealLLMItems{MealName: reservedMealName(slot), MacroTarget: slot.Estimated}
+		slot.Replaces = ""
+		placeholder.Reserved = &slot
+		// Drinks are listed with the meal they accompany
+		if anchor := findMeal(meals, slot.WithMeal); anchor >= 0 {
+			placeholder.MealTime = meals[anchor].MealTime
+			placeholder.Meridiem = meals[anchor].Meridiem
+			meals = append(meals[:anchor+1], append([]models.MealLLMItems{placeholder}, meals[anchor+1:]...)...)
+			continue
+		}
+		meals = append(meals, placeholder)
+	}
+
+	planned := 0
+	for _, meal := range meals {
+		if meal.Reserved == nil {
+			planned++
+		}
+	}
+	if planned > 0 {
+		perMeal := plannedMealTarget(remaining, daily, planned, mealsPerDay)
+		for i := range meals {
+			if meals[i].Reserved == nil {
+				meals[i].MacroTarget = perMeal
+			}
+		}
+	}
+
+	day.Meals = meals
+	return day
+}
+
+// reservationPromptRules tells the LLM which slots are taken and what the other meals
+// on those dates should aim for
+func reservationPromptRules(reqBody models.RequestBody, dates []string, mealsPerDay int) string {
+	daily := models.MacroTarget{
+		Calories: reqBody.DailyCaloriesGoal,
+		Proteins: reqBody.DailyProtiensGoal,
+		Carbs:    reqBody.DailyCarbsGoal,
+		Fats:     reqBody.DailyFatsGoal,
+	}
+
+	prompt := ""
+	for _, date := range dates {
+		reserved := ReservationsFor(reqBody, date)
+		if len(reserved) == 0 {
+			continue
+		}
+
+		planned := mealsPerDay
+		remaining := daily
+		var slots []string
+		for _, slot := range reserved {
+			remaining = subtractMacros(remaining, slot.Estimated)
+			switch slot.Kind {
+			case ReservedDrinks:
+				slots = append(slots, fmt.Sprintf("%d drink(s) (~%.0f kcal)", slot.Drinks, slot.Estimated.Calories))
+			default:
+				if slot.Replaces != "" {
+					planned--
+					slots = append(slots, fmt.Sprintf("%s is a %s meal (~%.0f kcal)", slot.Replaces, slot.Kind, slot.Estimated.Calories))
+				} else {
+					slots = append(slots, fmt.Sprintf("a %s (~%.0f kcal)", slot.Kind, slot.Estimated.Calories))
+				}
+			}
+		}
+		if planned < 1 {
+			planned = 1
+		}
+		perMeal := plannedMealTarget(remaining, daily, planned, mealsPerDay)
+		prompt += fmt.Sprintf("- %s: %s. Output a replaced meal with an empty foods array; plan the other meals for about Calories: %.0f, Protein: %.0fg, Carbs: %.0fg, Fat: %.0fg each\n",
+			date, strings.Join(slots, "; "), perMeal.Calories, perMeal.Proteins, perMeal.Carbs, perMeal.Fats)
+	}
+
+	if prompt == "" {
+		return ""
+	}
+	return "RESERVED MEALS (budget held for treats, eating out and drinks):\n" + prompt + "\n"
+}
+
+// plannedMealTarget splits what the reservations leave of the day over the planned
+// meals. Reservations are mostly carbs and fat, so protein is kept and carbs and fat are
+// trimmed until the macros fit the calories. Meals never drop below a floor share of
+// their normal target.
+func plannedMealTarget(remaining, daily models.MacroTarget, planned, mealsPerDay int) models.MacroTarget {
+	if mealsPerDay <= 0 {
+		mealsPerDay = planned
+	}
+	floor := scaleMacros(daily, minPlannedMealShare/float64(mealsPerDay))
+	perMeal := scaleMacros(remaining, 1/float64(planned))
+	if perMeal.Calories <= floor.Calories {
+		return floor
+	}
+
+	perMeal.Proteins = math.Max(perMeal.Proteins, floor.Proteins)
+	perMeal.Carbs = math.Max(perMeal.Carbs, 0)
+	perMeal.Fats = math.Max(perMeal.Fats, 0)
+
+	proteinKcal := perMeal.Proteins * kcalPerGramProtein
+	if proteinKcal > perMeal.Calories {
+		perMeal.Proteins = perMeal.Calories / kcalPerGramProtein
+		perMeal.Carbs, perMeal.Fats = 0, 0
+		return perMeal
+	}
+	otherKcal := perMeal.Carbs*kcalPerGramCarbs + perMeal.Fats*kcalPerGramFat
+	if budget := perMeal.Calories - proteinKcal; otherKcal > budget {
+		scale := budget / otherKcal
+		perMeal.Carbs *= scale
+		perMeal.Fats *= scale
+	}
+	return perMeal
+}
+
+func reservedMealName(slot models.ReservedMeal) string {
+	if slot.Replaces != "" {
+		return slot.Replaces
+	}
+	switch slot.Kind {
+	case ReservedTreat:
+		return "Treat"
+	case ReservedSocial:
+		return "Eating Out"
+	default:
+		return "Drinks"
+	}
+}
+
+func mealNameMatches(mealName, entry string) bool {
+	if strings.EqualFold(strings.TrimSpace(mealName), strings.TrimSpace(entry)) {
+		return true
+	}
+	want := paddedWords(entry)
+	return strings.TrimSpace(want) != "" && strings.Contains(paddedWords(mealName), want)
+}
+
+func findMeal(meals []models.MealLLMItems, name string) int {
+	if name == "" {
+		return -1
+	}
+	for i := range meals {
+		if mealNameMatches(meals[i].MealName, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseDrinkCount reads counts such as "2", "2-3" or "3 beers", taking the upper end
+// of a range. Missing or unreadable counts mean one drink.
+func parseDrinkCount(value string) int {
+	count := 0
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool { return !unicode.IsDigit(r) }) {
+		if n, err := strconv.Atoi(field); err == nil && n > count {
+			count = n
+		}
+	}
+	if count <= 0 {
+		return 1
+	}
+	if count > maxReservedDrinks {
+		return maxReservedDrinks
+	}
+	return count
+}
+
+func scaleMacros(m models.MacroTarget, factor float64) models.MacroTarget {
+	return models.MacroTarget{
+		Calories: m.Calories * factor,
+		Proteins: m.Proteins * factor,
+		Carbs:    m.Carbs * factor,
+		Fats:     m.Fats * factor,
+	}
+}
+
+func subtractMacros(a, b models.MacroTarget) models.MacroTarget {
+	return models.MacroTarget{
+		Calories: a.Calories - b.Calories,
+		Proteins: a.Proteins - b.Proteins,
+		Carbs:    a.Carbs - b.Carbs,
+		Fats:     a.Fats - b.Fats,
+	}
+}
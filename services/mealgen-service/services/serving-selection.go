@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// Limits applied to the model's percentage adjustments
+const (
+	minPercentageAdjustment = -90.0
+	maxPercentageAdjustment = 400.0
+)
+
+// SelectServings asks the LLM to pick one serving per food and a percentage adjustment
+// so each meal lands on its macro target. Every food in the request gets a choice: when
+// the model output cannot be used the first serving is chosen unadjusted.
+func (gs *GeminiService) SelectServings(ctx context.Context, reqBody models.ServingSelectionRequest) (*models.ServingSelectionLLMResponse, error) {
+	prompt := gs.buildServingSelectionPrompt(reqBody)
+	output, err := gs.generateStructured(ctx, prompt, SchemaFor(models.ServingSelectionLLMResponse{}), "serving_selection")
+	if err != nil {
+		return nil, fmt.Errorf("error calling LLM provider %s for serving selection: %w", gs.llm.Name(), err)
+	}
+	return gs.parseServingSelectionResponse(output, reqBody), nil
+}
+
+func (gs *GeminiService) buildServingSelectionPrompt(reqBody models.ServingSelectionRequest) string {
+	prompt := "You are a professional nutritionist. For every food below, choose the single best serving option and a percentage adjustment of that serving so the meal totals match the meal's macro targets as closely as possible.\n\n"
+
+	for i, meal := range reqBody.Meals {
+		prompt += fmt.Sprintf("MEAL %d: %s (%s %s)\n", i+1, meal.MealName, meal.MealTime, meal.Meridiem)
+		prompt += fmt.Sprintf("- Targets: Calories: %.1f, Protein: %.1fg, Carbs: %.1fg, Fat: %.1fg\n",
+			meal.MacroTarget.Calories, meal.MacroTarget.Proteins, meal.MacroTarget.Carbs, meal.MacroTarget.Fats)
+		for j, food := range meal.Foods {
+			prompt += fmt.Sprintf("- Food %d (food_id %s): %s\n", j+1, food.FoodID, food.FoodName)
+			for _, serving := range food.Servings {
+				macros := serving.Nutrients().Macros()
+				prompt += fmt.Sprintf("  * serving_id %s: %s (%s %s) = %.1f kcal, %.1fg protein, %.1fg carbs, %.1fg fat\n",
+					serving.ServingID, serving.ServingDescription, serving.MetricServingAmount, serving.MetricServingUnit,
+					macros.Calories, macros.Proteins, macros.Carbs, macros.Fats)
+			}
+		}
+		prompt += "\n"
+	}
+
+	prompt += "RULES:\n"
+	prompt += "- percentage_adjustment is the percent change from ONE listed serving: 0 = as listed, 50 = 1.5x, -25 = 0.75x\n"
+	prompt += fmt.Sprintf("- Keep percentage_adjustment between %.0f and %.0f\n", minPercentageAdjustment, maxPercentageAdjustment)
+	prompt += "- Prefer servings that are realistic for the meal time\n"
+	prompt += "- Include EVERY food of EVERY meal exactly once, using the given meal and food numbers as meal_index and food_index and the given food_id and serving_id values\n"
+	prompt += "- The same food can appear more than once in a meal; choose a serving for each entry separately\n\n"
+
+	prompt += "RESPONSE FORMAT:\n"
+	prompt += "Return ONLY a valid JSON object in this exact structure:\n"
+	prompt += "{\n"
+	prompt += "  \"meals\": [\n"
+	prompt += "    {\n"
+	prompt += "      \"meal_index\": 1,\n"
+	prompt += "      \"meal_name\": \"Breakfast\",\n"
+	prompt += "      \"foods\": [\n"
+	prompt += "        {\"food_index\": 1, \"food_id\": \"12345\", \"serving_id\": \"1\", \"percentage_adjustment\": 20}\n"
+	prompt += "      ]\n"
+	prompt += "    }\n"
+	prompt += "  ]\n"
+	prompt += "}\n\n"
+
+	prompt += "Select the servings now:"
+
+	return prompt
+}
+
+func (gs *GeminiService) parseServingSelectionResponse(output structuredOutput, reqBody models.ServingSelectionRequest) *models.ServingSelectionLLMResponse {
+	var parsed models.ServingSelectionLLMResponse
+	if len(output.Problems) > 0 {
+		log.Printf("Serving selection output invalid after %d attempts, using first servings", output.Attempts)
+	} else if err := json.Unmarshal([]byte(output.JSON), &parsed); err != nil {
+		log.Printf("Failed to parse serving selection JSON response: %v", err)
+	}
+
+	// Index the model's choices by meal and food position, so repeated foods in a meal
+	// keep their own choice. Positions the model left out fall back to list order.
+	choices := make(map[string]models.ServingSelectionLLMFood)
+	for i, meal := range parsed.Meals {
+		mealIndex := i
+		if meal.MealIndex > 0 {
+			mealIndex = meal.MealIndex - 1
+		}
+		for j, food := range meal.Foods {
+			foodIndex := j
+			if food.FoodIndex > 0 {
+				foodIndex = food.FoodIndex - 1
+			}
+			choices[servingChoiceKey(mealIndex, foodIndex)] = food
+		}
+	}
+
+	// Rebuild the selection from the request so every food is present exactly once
+	result := &models.ServingSelectionLLMResponse{
+		Meals:    make([]models.ServingSelectionLLMMeal, len(reqBody.Meals)),
+		Fallback: len(parsed.Meals) == 0,
+	}
+	for i, meal := range reqBody.Meals {
+		result.Meals[i].MealIndex = i + 1
+		result.Meals[i].MealName = meal.MealName
+		for j, food := range meal.Foods {
+			choice, ok := choices[servingChoiceKey(i, j)]
+			if !ok || choice.FoodID != food.FoodID || !hasServing(food, choice.ServingID) {
+				if len(parsed.Meals) > 0 {
+					log.Printf("Serving selection: no usable choice for %s in %s, using first serving", food.FoodName, meal.MealName)
+				}
+				choice = models.ServingSelectionLLMFood{FoodID: food.FoodID}
+				if len(food.Servings) > 0 {
+					choice.ServingID = food.Servings[0].ServingID
+				}
+			}
+			choice.FoodIndex = j + 1
+			choice.PercentageAdjustment = clampPercentage(choice.PercentageAdjustment)
+			result.Meals[i].Foods = append(result.Meals[i].Foods, choice)
+		}
+	}
+
+	return result
+}
+
+func servingChoiceKey(mealIndex, foodIndex int) string {
+	return fmt.Sprintf("%d|%d", mealIndex, foodIndex)
+}
+
+func hasServing(food models.Food, servingID string) bool {
+	for _, serving := range food.Servings {
+		if serving.ServingID == servingID {
+			return true
+		}
+	}
+	return false
+}
+
+func clampPercentage(p float64) float64 {
+	if p < minPercentageAdjustment {
+		return minPercentageAdjustment
+	}
+	if p > maxPercentageAdjustment {
+		return maxPercentageAdjustment
+	}
+	return p
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+func servingFood(id string, servingIDs ...string) models.Food {
+	food := models.Food{FoodID: id, FoodName: "Food " + id}
+	for _, servingID := range servingIDs {
+		food.Servings = append(food.Servings, models.Serving{ServingID: servingID})
+	}
+	return food
+}
+
+func TestParseServingSelectionKeepsRepeatedFoodsApart(t *testing.T) {
+	reqBody := models.ServingSelectionRequest{Meals: []models.MealWithFoods{
+		{MealName: "Breakfast", Foods: []models.Food{servingFood("egg", "1", "2"), servingFood("toast", "1"), servingFood("egg", "1", "2")}},
+		{MealName: "Lunch", Foods: []models.Food{servingFood("egg", "1", "2")}},
+	}}
+	// Meals and foods out of order, matched by their indexes
+	output := structuredOutput{JSON: `{"meals": [
+		{"meal_index": 2, "meal_name": "Lunch", "foods": [
+			{"food_index": 1, "food_id": "egg", "serving_id": "1", "percentage_adjustment": 10}]},
+		{"meal_index": 1, "meal_name": "Breakfast", "foods": [
+			{"food_index": 3, "food_id": "egg", "serving_id": "2", "percentage_adjustment": -50},
+			{"food_index": 1, "food_id": "egg", "serving_id": "1", "percentage_adjustment": 100},
+			{"food_index": 2, "food_id": "toast", "serving_id": "1", "percentage_adjustment": 0}]}
+	]}`}
+
+	got := (&GeminiService{}).parseServingSelectionResponse(output, reqBody)
+
+	want := [][]models.ServingSelectionLLMFood{
+		{{FoodIndex: 1, FoodID: "egg", ServingID: "1", PercentageAdjustment: 100}, {FoodIndex: 2, FoodID: "toast", ServingID: "1"}, {FoodIndex: 3, FoodID: "egg", ServingID: "2", PercentageAdjustment: -50}},
+		{{FoodIndex: 1, FoodID: "egg", ServingID: "1", PercentageAdjustment: 10}},
+	}
+	if got.Fallback {
+		t.Error("a usable selection was marked as a fallback")
+	}
+	for i, meal := range want {
+		for j, food := range meal {
+			if got.Meals[i].Foods[j] != food {
+				t.Errorf("meal %d food %d = %+v, want %+v", i+1, j+1, got.Meals[i].Foods[j], food)
+			}
+		}
+	}
+}
+
+func TestParseServingSelectionFallsBackPerFood(t *testing.T) {
+	reqBody := models.ServingSelectionRequest{Meals: []models.MealWithFoods{
+		{MealName: "Dinner", Foods: []models.Food{servingFood("rice", "a", "b"), servingFood("beans", "c")}},
+	}}
+	// The first choice names another food at that position, the second an unknown serving
+	output := structuredOutput{JSON: `{"meals": [{"meal_index": 1, "meal_name": "Dinner", "foods": [
+		{"food_index": 1, "food_id": "beans", "serving_id": "c", "percentage_adjustment": 20},
+		{"food_index": 2, "food_id": "beans", "serving_id": "x", "percentage_adjustment": 900}]}]}`}
+
+	got := (&GeminiService{}).parseServingSelectionResponse(output, reqBody)
+
+	for j, want := range []models.ServingSelectionLLMFood{
+		{FoodIndex: 1, FoodID: "rice", ServingID: "a"},
+		{FoodIndex: 2, FoodID: "beans", ServingID: "c"},
+	} {
+		if got.Meals[0].Foods[j] != want {
+			t.Errorf("food %d = %+v, want %+v", j+1, got.Meals[0].Foods[j], want)
+		}
+	}
+}
+
+func TestParseServingSelectionClampsAdjustments(t *testing.T) {
+	reqBody := models.ServingSelectionRequest{Meals: []models.MealWithFoods{
+		{Foods: []models.Food{servingFood("oats", "1"), servingFood("milk", "1")}},
+	}}
+	output := structuredOutput{JSON: `{"meals": [{"meal_index": 1, "meal_name": "", "foods": [
+		{"food_index": 1, "food_id": "oats", "serving_id": "1", "percentage_adjustment": 900},
+		{"food_index": 2, "food_id": "milk", "serving_id": "1", "percentage_adjustment": -100}]}]}`}
+
+	got := (&GeminiService{}).parseServingSelectionResponse(output, reqBody)
+
+	if p := got.Meals[0].Foods[0].PercentageAdjustment; p != maxPercentageAdjustment {
+		t.Errorf("oats adjustment = %v, want %v", p, maxPercentageAdjustment)
+	}
+	if p := got.Meals[0].Foods[1].PercentageAdjustment; p != minPercentageAdjustment {
+		t.Errorf("milk adjustment = %v, want %v", p, minPercentageAdjustment)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	_ "modernc.org/sqlite"
+)
+
+const sqlitePlanSchema = `
+CREATE TABLE IF NOT EXISTS plans (
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL DEFAULT '',
+	request    TEXT NOT NULL,
+	plan       TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS plans_user_created ON plans (user_id, created_at DESC);
+`
+
+// SQLitePlanStore stores plans in a SQLite file. Request and plan bodies are kept as
+// JSON so model changes do not need migrations.
+type SQLitePlanStore struct {
+	db *sql.DB
+}
+
+func NewSQLitePlanStore(path string) (*SQLitePlanStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plan store: %w", err)
+	}
+	// SQLite allows one writer at a time; a single connection avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqlitePlanSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise plan store: %w", err)
+	}
+
+	return &SQLitePlanStore{db: db}, nil
+}
+
+func (ss *SQLitePlanStore) SavePlan(ctx context.Context, plan *models.StoredPlan) error {
+	request, body, err := encodeStoredPlan(plan)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	plan.ID = NewPlanID()
+	plan.CreatedAt = now
+	plan.UpdatedAt = now
+
+	_, err = ss.db.ExecContext(ctx,
+		`INSERT INTO plans (id, user_id, request, plan, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		plan.ID, plan.UserID, request, body, formatPlanTime(now), formatPlanTime(now))
+	if err != nil {
+		return fmt.Errorf("failed to save plan: %w", err)
+	}
+	return nil
+}
+
+func (ss *SQLitePlanStore) UpdatePlan(ctx context.Context, plan *models.StoredPlan) error {
+	request, body, err := encodeStoredPlan(plan)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	result, err := ss.db.ExecContext(ctx,
+		`UPDATE plans SET request = ?, plan = ?, updated_at = ? WHERE id = ?`,
+		request, body, formatPlanTime(now), plan.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update plan %s: %w", plan.ID, err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrPlanNotFound
+	}
+	plan.UpdatedAt = now
+	return nil
+}
+
+func (ss *SQLitePlanStore) GetPlan(ctx context.Context, id string) (*models.StoredPlan, error) {
+	row := ss.db.QueryRowContext(ctx,
+		`SELECT id, user_id, request, plan, created_at, updated_at FROM plans WHERE id = ?`, id)
+
+	var plan models.StoredPlan
+	var request, body, createdAt, updatedAt string
+	if err := row.Scan(&plan.ID, &plan.UserID, &request, &body, &createdAt, &updatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, fmt.Errorf("failed to load plan %s: %w", id, err)
+	}
+
+	if err := json.Unmarshal([]byte(request), &plan.Request); err != nil {
+		return nil, fmt.Errorf("failed to decode request of plan %s: %w", id, err)
+	}
+	if err := json.Unmarshal([]byte(body), &plan.Plan); err != nil {
+		return nil, fmt.Errorf("failed to decode plan %s: %w", id, err)
+	}
+	plan.CreatedAt = parsePlanTime(createdAt)
+	plan.UpdatedAt = parsePlanTime(updatedAt)
+
+	return &plan, nil
+}
+
+func (ss *SQLitePlanStore) ListUserPlans(ctx context.Context, userID string, limit, offset int) ([]models.StoredPlanSummary, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := ss.db.QueryContext(ctx,
+		`SELECT id, user_id, plan, created_at, updated_at FROM plans WHERE user_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?`,
+		userID, ClampPlanListLimit(limit), offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plans for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	summaries := []models.StoredPlanSummary{}
+	for rows.Next() {
+		var plan models.StoredPlan
+		var body, createdAt, updatedAt string
+		if err := rows.Scan(&plan.ID, &plan.UserID, &body, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read plan row: %w", err)
+		}
+		if err := json.Unmarshal([]byte(body), &plan.Plan); err != nil {
+			return nil, fmt.Errorf("failed to decode plan %s: %w", plan.ID, err)
+		}
+		plan.CreatedAt = parsePlanTime(createdAt)
+		plan.UpdatedAt = parsePlanTime(updatedAt)
+		summaries = append(summaries, SummarizePlan(&plan))
+	}
+	return summaries, rows.Err()
+}
+
+func (ss *SQLitePlanStore) Close() error {
+	return ss.db.Close()
+}
+
+// encodeStoredPlan encodes the request and plan for their columns
+func encodeStoredPlan(plan *models.StoredPlan) (string, string, error) {
+	request, err := json.Marshal(plan.Request)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode plan request: %w", err)
+	}
+	body, err := json.Marshal(plan.Plan)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode plan: %w", err)
+	}
+	return string(request), string(body), nil
+}
+
+// Timestamps are fixed-width UTC strings so they sort correctly as text
+const planTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+func formatPlanTime(t time.Time) string {
+	return t.UTC().Format(planTimeLayout)
+}
+
+func parsePlanTime(value string) time.Time {
+	t, err := time.Parse(planTimeLayout, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
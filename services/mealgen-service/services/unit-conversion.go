@@ -0,0 +1,298 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+const (
+	gramsPerOunce   = 28.3495
+	gramsPerPound   = 453.592
+	mlPerCup        = 236.588
+	mlPerTablespoon = 14.787
+	mlPerTeaspoon   = 4.929
+	mlPerFluidOunce = 29.574
+
+	defaultDensity    = 1.0   // g per ml, water
+	defaultPieceGrams = 100.0 // Used when nothing about a serving can be weighed
+)
+
+// GramsAccuracy ranks how a serving's gram weight was worked out, most exact first
+type GramsAccuracy int
+
+const (
+	GramsExact     GramsAccuracy = iota // Already in grams
+	GramsMetric                         // Converted from the metric amount, e.g. oz or ml
+	GramsHousehold                      // Estimated from a household measure, e.g. cup or medium
+	GramsGuess                          // Nothing to convert from
+)
+
+var massUnits = map[string]float64{
+	"g": 1, "gram": 1, "grams": 1, "kg": 1000, "mg": 0.001,
+	"oz": gramsPerOunce, "ounce": gramsPerOunce, "ounces": gramsPerOunce,
+	"lb": gramsPerPound, "lbs": gramsPerPound, "pound": gramsPerPound, "pounds": gramsPerPound,
+}
+
+var volumeUnits = map[string]float64{
+	"ml": 1, "milliliter": 1, "milliliters": 1, "l": 1000, "liter": 1000, "liters": 1000,
+	"cup": mlPerCup, "cups": mlPerCup,
+	"tbsp": mlPerTablespoon, "tablespoon": mlPerTablespoon, "tablespoons": mlPerTablespoon,
+	"tsp": mlPerTeaspoon, "teaspoon": mlPerTeaspoon, "teaspoons": mlPerTeaspoon,
+	"fl oz": mlPerFluidOunce, "fluid ounce": mlPerFluidOunce, "fluid ounces": mlPerFluidOunce,
+}
+
+// foodDensities are grams per ml for measuring foods by volume. The first keyword found
+// as a word in the name wins, so liquids such as "almond milk" come before solids.
+var foodDensities = []struct {
+	keyword string
+	density float64
+}{
+	{"oil", 0.92},
+	{"honey", 1.42},
+	{"syrup", 1.33},
+	{"milk", 1.03},
+	{"juice", 1.05},
+	{"yogurt", 1.05},
+	{"yoghurt", 1.05},
+	{"sauce", 1.05},
+	{"peanut butter", 1.09},
+	{"almond butter", 1.07},
+	{"butter", 0.96},
+	{"cream cheese", 1.0},
+	{"cream", 1.0},
+	{"cottage cheese", 0.96},
+	{"cheese", 0.45}, // Shredded
+	{"flour", 0.53},
+	{"sugar", 0.85},
+	{"protein powder", 0.4},
+	{"oat", 0.38},
+	{"oatmeal", 0.38},
+	{"granola", 0.5},
+	{"cereal", 0.15},
+	{"rice", 0.79},
+	{"quinoa", 0.78},
+	{"couscous", 0.66},
+	{"pasta", 0.59},
+	{"bean", 0.75},
+	{"lentil", 0.8},
+	{"chickpea", 0.69},
+	{"berry", 0.62},
+	{"blueberry", 0.62},
+	{"strawberry", 0.62},
+	{"raspberry", 0.62},
+	{"blackberry", 0.62},
+	{"cranberry", 0.62},
+	{"grape", 0.64},
+	{"spinach", 0.13},
+	{"kale", 0.28},
+	{"lettuce", 0.2},
+	{"broccoli", 0.37},
+	{"almond", 0.6},
+	{"nut", 0.55},
+	{"walnut", 0.55},
+	{"peanut", 0.55},
+	{"cashew", 0.55},
+	{"pecan", 0.55},
+	{"seed", 0.6},
+}
+
+// pieceWeights are grams for one medium item. The first keyword that is the head noun of
+// the name, or a word of the measure, wins. Foods with a unit are eaten in whole pieces and portions snap
+// to a whole number of them.
+var pieceWeights = []struct {
+	keyword string
+	grams   float64
+	unit    string
+}{
+	{"egg white", 33, "egg white"},
+	{"egg", 50, "egg"},
+	{"banana", 118, "banana"},
+	{"apple", 182, "apple"},
+	{"orange", 131, "orange"},
+	{"pear", 178, "pear"},
+	{"peach", 150, "peach"},
+	{"kiwi", 69, "kiwi"},
+	{"plum", 66, "plum"},
+	{"mango", 200, ""},
+	{"avocado", 150, ""},
+	{"sweet potato", 130, ""},
+	{"potato", 173, ""},
+	{"tomato", 123, ""},
+	{"onion", 110, ""},
+	{"carrot", 61, ""},
+	{"bell pepper", 119, ""},
+	{"cucumber", 300, ""},
+	{"zucchini", 196, ""},
+	{"tortilla", 45, "tortilla"},
+	{"pita", 60, "pita"},
+	{"bagel", 105, "bagel"},
+	{"english muffin", 57, "english muffin"},
+	{"muffin", 113, "muffin"},
+	{"bread", 30, "slice"},
+	{"rice cake", 9, "rice cake"},
+	{"chicken breast", 174, ""},
+	{"chicken thigh", 116, ""},
+	{"sausage", 68, "sausage"},
+	{"bacon", 8, "slice"},
+	{"date", 7, "date"},
+	{"strawberry", 12, ""},
+	{"strawberries", 12, ""},
+	{"cookie", 15, "cookie"},
+	{"bar", 50, "bar"},
+}
+
+// sizeFactors scale a medium piece weight, longest size first
+var sizeFactors = []struct {
+	size   string
+	factor float64
+}{
+	{"extra large", 1.4},
+	{"jumbo", 1.5},
+	{"large", 1.25},
+	{"small", 0.75},
+}
+
+var leadingAmountPattern = regexp.MustCompile(`^\s*[\d./]+\s*`)
+
+// ServingGrams returns the gram weight of a serving and how it was worked out. The food
+// name picks the density for volume measures and the weight of one piece.
+func ServingGrams(foodName string, serving models.Serving) (float64, GramsAccuracy) {
+	if IsGramServing(serving) {
+		if grams := parseAmount(serving.MetricServingAmount); grams > 0 {
+			return grams, GramsExact
+		}
+		if grams := parseAmount(serving.NumberOfUnits); grams > 0 {
+			return grams, GramsExact
+		}
+	}
+
+	if amount := parseAmount(serving.MetricServingAmount); amount > 0 {
+		if grams, ok := convertToGrams(foodName, amount, serving.MetricServingUnit); ok {
+			return grams, GramsMetric
+		}
+	}
+
+	units := parseAmount(serving.NumberOfUnits)
+	if units <= 0 {
+		units = 1
+	}
+	measure := householdMeasure(serving)
+	if grams, ok := convertToGrams(foodName, units, measure); ok {
+		return grams, GramsHousehold
+	}
+	if grams, ok := pieceGrams(foodName, measure); ok {
+		return units * grams, GramsHousehold
+	}
+	return units * defaultPieceGrams, GramsGuess
+}
+
+// GramServings converts every serving of a food to grams, most exact first. The
+// original measure is kept in HouseholdMeasure and HouseholdAmount for display.
+func GramServings(food models.Food) []models.Serving {
+	type converted struct {
+		serving  models.Serving
+		accuracy GramsAccuracy
+	}
+	var all []converted
+	for _, serving := range food.Servings {
+		grams, accuracy := ServingGrams(food.FoodName, serving)
+		if accuracy != GramsExact {
+			serving.HouseholdMeasure = householdMeasure(serving)
+			serving.HouseholdAmount = parseAmount(serving.NumberOfUnits)
+			if serving.HouseholdAmount <= 0 {
+				serving.HouseholdAmount = 1
+			}
+			serving.MeasurementDescription = "g"
+			serving.NumberOfUnits = fmt.Sprintf("%.3f", grams)
+		}
+		serving.MetricServingAmount = fmt.Sprintf("%.3f", grams)
+		serving.MetricServingUnit = "g"
+		all = append(all, converted{serving, accuracy})
+	}
+
+	// Stable so the provider's own ordering breaks ties
+	sort.SliceStable(all, func(i, j int) bool { return all[i].accuracy < all[j].accuracy })
+
+	// A guess is only worth keeping when nothing better exists
+	servings := make([]models.Serving, 0, len(all))
+	for _, c := range all {
+		if c.accuracy == GramsGuess && len(servings) > 0 {
+			break
+		}
+		servings = append(servings, c.serving)
+	}
+	return servings
+}
+
+// convertToGrams converts an amount in a mass or volume unit to grams
+func convertToGrams(foodName string, amount float64, unit string) (float64, bool) {
+	unit = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(unit)), ".")
+	if factor, ok := massUnits[unit]; ok {
+		return amount * factor, true
+	}
+	if ml, ok := volumeUnits[unit]; ok {
+		return amount * ml * densityOf(foodName), true
+	}
+	return 0, false
+}
+
+// pieceGrams weighs one piece, such as "1 large" egg or "1 slice" of bread
+func pieceGrams(foodName, measure string) (float64, bool) {
+	measureWords := paddedWords(measure)
+	for _, piece := range pieceWeights {
+		if isHeadNoun(headPhrase(foodName), piece.keyword) || containsWord(measureWords, piece.keyword) {
+			_, factor := pieceSize(measure)
+			return piece.grams * factor, true
+		}
+	}
+	return 0, false
+}
+
+// pieceSize finds a size such as "large" in a measure, with its weight factor
+func pieceSize(measure string) (string, float64) {
+	words := paddedWords(measure)
+	for _, size := range sizeFactors {
+		if strings.Contains(words, paddedWords(size.size)) {
+			return size.size, size.factor
+		}
+	}
+	return "", 1
+}
+
+// densityOf matches whole words, so "boiled" rice is not measured as oil. Singular forms
+// are added so "berries" finds "berry".
+func densityOf(foodName string) float64 {
+	words := paddedWords(foodName)
+	for _, word := range strings.Fields(words) {
+		words += singular(word) + " "
+	}
+	for _, d := range foodDensities {
+		if containsWord(words, d.keyword) {
+			return d.density
+		}
+	}
+	return defaultDensity
+}
+
+// parseAmount reads a decimal amount such as a serving's metric amount, returning 0
+// when it is empty or not a number
+func parseAmount(value string) float64 {
+	amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0
+	}
+	return amount
+}
+
+// householdMeasure is the serving's measure without its count, e.g. "cup" for "1 cup"
+func householdMeasure(serving models.Serving) string {
+	if measure := strings.TrimSpace(serving.MeasurementDescription); measure != "" {
+		return measure
+	}
+	return strings.TrimSpace(leadingAmountPattern.ReplaceAllString(serving.ServingDescription, ""))
+}
@@ -0,0 +1,578 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+)
+
+// USDA FoodData Central data types, as stored in the local food store
+const (
+	USDAFoundation = "foundation"
+	USDASRLegacy   = "sr_legacy"
+	USDASurvey     = "survey"
+	USDABranded    = "branded"
+)
+
+// DefaultUSDADataTypes are imported when no types are given. Branded foods are left
+// out since they are most of the data and mostly duplicate the generic foods.
+var DefaultUSDADataTypes = []string{USDAFoundation, USDASRLegacy, USDASurvey}
+
+const usdaImportBatch = 1000
+
+// usdaNutrients maps FoodData Central nutrient numbers to the nutrients the food data
+// carries. FDC splits the B vitamins, so vitamin_b is left unknown.
+var usdaNutrients = map[string]models.Nutrient{
+	"208": models.NutrientCalories,
+	"203": models.NutrientProtein,
+	"205": models.NutrientCarbohydrate,
+	"204": models.NutrientFat,
+	"269": models.NutrientSugar,
+	"291": models.NutrientFiber,
+	"606": models.NutrientSaturatedFat,
+	"645": models.NutrientMonounsaturatedFat,
+	"646": models.NutrientPolyunsaturatedFat,
+	"601": models.NutrientCholesterol,
+	"307": models.NutrientSodium,
+	"306": models.NutrientPotassium,
+	"301": models.NutrientCalcium,
+	"303": models.NutrientIron,
+	"320": models.NutrientVitaminA, // µg RAE
+	"401": models.NutrientVitaminC, // mg
+	"328": models.NutrientVitaminD, // µg
+}
+
+// usdaAtwaterEnergy are the energy numbers Foundation foods report instead of 208,
+// specific factors first
+var usdaAtwaterEnergy = []string{"958", "957"}
+
+// USDAImportStats counts what an import did
+type USDAImportStats struct {
+	Imported int
+	Skipped  int // Foods of other data types or without usable nutrients
+}
+
+// usdaFood collects one food from either export format before it is converted
+type usdaFood struct {
+	id          string
+	description string
+	dataType    string
+	brand       string
+	gtin        string
+	nutrients   map[string]float64 // Per 100 g, by nutrient number
+	portions    []usdaPortion
+
+	// Label serving of branded foods
+	servingSize float64
+	servingUnit string
+	household   string
+}
+
+type usdaPortion struct {
+	seq         string
+	amount      float64
+	unit        string // Measure unit, empty when undetermined
+	modifier    string
+	description string
+	grams       float64
+}
+
+// ImportUSDA loads every FoodData Central export found under root in fsys into the
+// store: directories holding the CSV export (food.csv and friends) and JSON exports.
+// fsys may be a directory or an opened zip archive.
+func ImportUSDA(ctx context.Context, store *LocalFoodStore, fsys fs.FS, root string, dataTypes []string) (USDAImportStats, error) {
+	wanted := make(map[string]bool, len(dataTypes))
+	for _, t := range dataTypes {
+		if normalized := normalizeUSDADataType(t); normalized != "" {
+			wanted[normalized] = true
+		} else {
+			return USDAImportStats{}, fmt.Errorf("unknown FoodData Central data type %q", t)
+		}
+	}
+
+	var stats USDAImportStats
+	found := false
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch {
+		case path.Base(p) == "food.csv":
+			found = true
+			log.Printf("📥 Importing FoodData Central CSV export from %s", path.Dir(p))
+			return importUSDACSV(ctx, store, fsys, path.Dir(p), wanted, &stats)
+		case strings.EqualFold(path.Ext(p), ".json"):
+			found = true
+			log.Printf("📥 Importing FoodData Central JSON export %s", p)
+			return importUSDAJSON(ctx, store, fsys, p, wanted, &stats)
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	if !found {
+		return stats, fmt.Errorf("no FoodData Central export (food.csv or .json) found in %s", root)
+	}
+	return stats, nil
+}
+
+// normalizeUSDADataType maps the CSV and JSON spellings, e.g. "sr_legacy_food" and
+// "SR Legacy", to one name. Other data types, such as sample foods, map to "".
+func normalizeUSDADataType(dataType string) string {
+	t := strings.ToLower(dataType)
+	switch {
+	case strings.Contains(t, "foundation"):
+		return USDAFoundation
+	case strings.Contains(t, "legacy"):
+		return USDASRLegacy
+	case strings.Contains(t, "survey"), strings.Contains(t, "fndds"):
+		return USDASurvey
+	case strings.Contains(t, "branded"):
+		return USDABranded
+	}
+	return ""
+}
+
+// usdaImportBatcher saves converted foods in batches
+type usdaImportBatcher struct {
+	ctx   context.Context
+	store *LocalFoodStore
+	stats *USDAImportStats
+	batch []LocalFood
+}
+
+func (b *usdaImportBatcher) add(food *usdaFood) error {
+	lf, ok := food.toLocalFood()
+	if !ok {
+		b.stats.Skipped++
+		return nil
+	}
+	b.batch = append(b.batch, lf)
+	if len(b.batch) >= usdaImportBatch {
+		return b.flush()
+	}
+	return nil
+}
+
+func (b *usdaImportBatcher) flush() error {
+	if len(b.batch) == 0 {
+		return nil
+	}
+	if err := b.store.SaveFoods(b.ctx, b.batch); err != nil {
+		return err
+	}
+	b.stats.Imported += len(b.batch)
+	if b.stats.Imported%(usdaImportBatch*10) < len(b.batch) {
+		log.Printf("💾 Imported %d foods", b.stats.Imported)
+	}
+	b.batch = b.batch[:0]
+	return nil
+}
+
+// importUSDAJSON streams one JSON export, e.g. {"FoundationFoods": [...]}, decoding a
+// food at a time so large exports are not held in memory
+func importUSDAJSON(ctx context.Context, store *LocalFoodStore, fsys fs.FS, name string, wanted map[string]bool, stats *USDAImportStats) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("%s: expected a JSON object of food lists", name)
+	}
+
+	batcher := &usdaImportBatcher{ctx: ctx, store: store, stats: stats}
+	for dec.More() {
+		if _, err := dec.Token(); err != nil { // The list's key, e.g. "SRLegacyFoods"
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return fmt.Errorf("%s: expected a list of foods", name)
+		}
+		for dec.More() {
+			var item usdaJSONFood
+			if err := dec.Decode(&item); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			food := item.toUSDAFood()
+			if !wanted[food.dataType] {
+				stats.Skipped++
+				continue
+			}
+			if err := batcher.add(food); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return batcher.flush()
+}
+
+type usdaJSONFood struct {
+	FdcID                    int     `json:"fdcId"`
+	Description              string  `json:"description"`
+	DataType                 string  `json:"dataType"`
+	BrandOwner               string  `json:"brandOwner"`
+	BrandName                string  `json:"brandName"`
+	GTINUPC                  string  `json:"gtinUpc"`
+	ServingSize              float64 `json:"servingSize"`
+	ServingSizeUnit          string  `json:"servingSizeUnit"`
+	HouseholdServingFullText string  `json:"householdServingFullText"`
+	FoodNutrients            []struct {
+		Nutrient struct {
+			Number string `json:"number"`
+		} `json:"nutrient"`
+		Amount *float64 `json:"amount"`
+	} `json:"foodNutrients"`
+	FoodPortions []struct {
+		ID                 int     `json:"id"`
+		Amount             float64 `json:"amount"`
+		GramWeight         float64 `json:"gramWeight"`
+		Modifier           string  `json:"modifier"`
+		PortionDescription string  `json:"portionDescription"`
+		MeasureUnit        struct {
+			Name string `json:"name"`
+		} `json:"measureUnit"`
+	} `json:"foodPortions"`
+}
+
+func (j usdaJSONFood) toUSDAFood() *usdaFood {
+	food := &usdaFood{
+		id:          strconv.Itoa(j.FdcID),
+		description: j.Description,
+		dataType:    normalizeUSDADataType(j.DataType),
+		brand:       firstNonEmpty(j.BrandName, j.BrandOwner),
+		gtin:        j.GTINUPC,
+		nutrients:   make(map[string]float64, len(j.FoodNutrients)),
+		servingSize: j.ServingSize,
+		servingUnit: j.ServingSizeUnit,
+		household:   j.HouseholdServingFullText,
+	}
+	for _, n := range j.FoodNutrients {
+		if n.Amount != nil && n.Nutrient.Number != "" {
+			food.nutrients[normalizeNutrientNumber(n.Nutrient.Number)] = *n.Amount
+		}
+	}
+	for _, p := range j.FoodPortions {
+		food.portions = append(food.portions, usdaPortion{
+			seq:         strconv.Itoa(p.ID),
+			amount:      p.Amount,
+			unit:        usdaMeasureUnit(p.MeasureUnit.Name),
+			modifier:    p.Modifier,
+			description: p.PortionDescription,
+			grams:       p.GramWeight,
+		})
+	}
+	return food
+}
+
+// importUSDACSV loads the CSV export in dir. Foods are read first so the much larger
+// nutrient file can be streamed, keeping only rows for wanted foods.
+func importUSDACSV(ctx context.Context, store *LocalFoodStore, fsys fs.FS, dir string, wanted map[string]bool, stats *USDAImportStats) error {
+	measureUnits := make(map[string]string)
+	if err := readUSDACSV(fsys, path.Join(dir, "measure_unit.csv"), false, func(row usdaCSVRow) error {
+		measureUnits[row.get("id")] = usdaMeasureUnit(row.get("name"))
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	nutrientNumbers := make(map[string]string)
+	if err := readUSDACSV(fsys, path.Join(dir, "nutrient.csv"), true, func(row usdaCSVRow) error {
+		nutrientNumbers[row.get("id")] = normalizeNutrientNumber(row.get("nutrient_nbr"))
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	foods := make(map[string]*usdaFood)
+	var order []string
+	if err := readUSDACSV(fsys, path.Join(dir, "food.csv"), true, func(row usdaCSVRow) error {
+		dataType := normalizeUSDADataType(row.get("data_type"))
+		if !wanted[dataType] {
+			stats.Skipped++
+			return nil
+		}
+		id := row.get("fdc_id")
+		foods[id] = &usdaFood{id: id, description: row.get("description"), dataType: dataType, nutrients: make(map[string]float64)}
+		order = append(order, id)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if wanted[USDABranded] {
+		if err := readUSDACSV(fsys, path.Join(dir, "branded_food.csv"), false, func(row usdaCSVRow) error {
+			if food := foods[row.get("fdc_id")]; food != nil {
+				food.brand = firstNonEmpty(row.get("brand_name"), row.get("brand_owner"))
+				food.gtin = row.get("gtin_upc")
+				food.servingSize, _ = strconv.ParseFloat(row.get("serving_size"), 64)
+				food.servingUnit = row.get("serving_size_unit")
+				food.household = row.get("household_serving_fulltext")
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := readUSDACSV(fsys, path.Join(dir, "food_nutrient.csv"), true, func(row usdaCSVRow) error {
+		food := foods[row.get("fdc_id")]
+		if food == nil {
+			return nil
+		}
+		if amount, err := strconv.ParseFloat(row.get("amount"), 64); err == nil {
+			food.nutrients[nutrientNumbers[row.get("nutrient_id")]] = amount
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := readUSDACSV(fsys, path.Join(dir, "food_portion.csv"), false, func(row usdaCSVRow) error {
+		food := foods[row.get("fdc_id")]
+		if food == nil {
+			return nil
+		}
+		amount, _ := strconv.ParseFloat(row.get("amount"), 64)
+		grams, _ := strconv.ParseFloat(row.get("gram_weight"), 64)
+		food.portions = append(food.portions, usdaPortion{
+			seq:         firstNonEmpty(row.get("seq_num"), row.get("id")),
+			amount:      amount,
+			unit:        measureUnits[row.get("measure_unit_id")],
+			modifier:    row.get("modifier"),
+			description: row.get("portion_description"),
+			grams:       grams,
+		})
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	batcher := &usdaImportBatcher{ctx: ctx, store: store, stats: stats}
+	for _, id := range order {
+		if err := batcher.add(foods[id]); err != nil {
+			return err
+		}
+	}
+	return batcher.flush()
+}
+
+// usdaCSVRow reads fields by header name
+type usdaCSVRow struct {
+	columns map[string]int
+	record  []string
+}
+
+func (r usdaCSVRow) get(column string) string {
+	if i, ok := r.columns[column]; ok && i < len(r.record) {
+		return strings.TrimSpace(r.record[i])
+	}
+	return ""
+}
+
+// readUSDACSV calls fn for every row of a CSV file. A missing optional file is skipped.
+func readUSDACSV(fsys fs.FS, name string, required bool, fn func(usdaCSVRow) error) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read %s header: %w", name, err)
+	}
+	row := usdaCSVRow{columns: make(map[string]int, len(header))}
+	for i, column := range header {
+		row.columns[strings.TrimPrefix(strings.TrimSpace(column), "\ufeff")] = i
+	}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		row.record = record
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// normalizeNutrientNumber turns "208.0" into "208"
+func normalizeNutrientNumber(number string) string {
+	if v, err := strconv.ParseFloat(strings.TrimSpace(number), 64); err == nil {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strings.TrimSpace(number)
+}
+
+func usdaMeasureUnit(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.EqualFold(name, "undetermined") {
+		return ""
+	}
+	return name
+}
+
+// toLocalFood converts a FoodData Central food: a 100 g serving, then one serving per
+// household portion, each with the per-100 g nutrients scaled to its gram weight
+func (uf *usdaFood) toLocalFood() (LocalFood, bool) {
+	per100g, ok := uf.nutrientVector()
+	if !ok || uf.description == "" {
+		return LocalFood{}, false
+	}
+
+	food := models.Food{
+		FoodID:    "usda-" + uf.id,
+		FoodName:  uf.description,
+		FoodType:  "Generic",
+		BrandName: uf.brand,
+	}
+	if uf.brand != "" {
+		food.FoodType = "Brand"
+	}
+
+	serving := func(id, description, measure string, units, amount float64, unit string, grams float64) models.Serving {
+		s := models.Serving{
+			ServingID:              uf.id + "-" + id,
+			ServingDescription:     description,
+			MeasurementDescription: measure,
+			MetricServingAmount:    strconv.FormatFloat(amount, 'f', 3, 64),
+			MetricServingUnit:      unit,
+			NumberOfUnits:          strconv.FormatFloat(units, 'f', 3, 64),
+		}
+		s.SetNutrientFields(per100g.Scale(grams / 100))
+		return s
+	}
+
+	food.Servings = append(food.Servings, serving("100g", "100 g", "g", 100, 100, "g", 100))
+
+	// Branded foods report nutrients per 100 g (or 100 ml) and the label serving size
+	if uf.servingSize > 0 {
+		unit := strings.ToLower(uf.servingUnit)
+		switch unit {
+		case "grm", "gm", "":
+			unit = "g"
+		case "mlt":
+			unit = "ml"
+		}
+		description := uf.household
+		if description == "" {
+			description = fmt.Sprintf("%s %s", strconv.FormatFloat(uf.servingSize, 'f', -1, 64), unit)
+		}
+		measure := strings.TrimSpace(leadingAmountPattern.ReplaceAllString(description, ""))
+		units := leadingAmount(description)
+		if units <= 0 {
+			units = 1
+		}
+		food.Servings = append(food.Servings, serving("label", description, measure, units, uf.servingSize, unit, uf.servingSize))
+	}
+
+	for _, p := range uf.portions {
+		if p.grams <= 0 {
+			continue
+		}
+		amount := p.amount
+		if amount <= 0 {
+			amount = leadingAmount(p.description)
+		}
+		if amount <= 0 {
+			amount = 1
+		}
+
+		measure := p.unit
+		if measure == "" {
+			measure = firstNonEmpty(p.modifier, strings.TrimSpace(leadingAmountPattern.ReplaceAllString(p.description, "")))
+		}
+		if measure == "" {
+			continue
+		}
+		description := strconv.FormatFloat(amount, 'f', -1, 64) + " " + measure
+		if p.unit != "" && p.modifier != "" {
+			description += ", " + p.modifier
+		}
+		food.Servings = append(food.Servings, serving(p.seq, description, measure, amount, p.grams, "g", p.grams))
+	}
+
+	return LocalFood{Food: food, DataType: uf.dataType, GTIN: uf.gtin}, true
+}
+
+// nutrientVector builds the per-100 g nutrients. Foods without protein, carbs and fat
+// are not usable; energy falls back to the Atwater values, then to the macros.
+func (uf *usdaFood) nutrientVector() (models.NutrientVector, bool) {
+	var v models.NutrientVector
+	for number, amount := range uf.nutrients {
+		if n, ok := usdaNutrients[number]; ok {
+			v.Set(n, amount)
+		}
+	}
+	for _, n := range []models.Nutrient{models.NutrientProtein, models.NutrientCarbohydrate, models.NutrientFat} {
+		if !v.Known(n) {
+			return v, false
+		}
+	}
+	if !v.Known(models.NutrientCalories) {
+		calories := macroEnergy(v.Macros())
+		for _, number := range usdaAtwaterEnergy {
+			if amount, ok := uf.nutrients[number]; ok {
+				calories = amount
+				break
+			}
+		}
+		v.Set(models.NutrientCalories, calories)
+	}
+	return v, true
+}
+
+// leadingAmount reads the count at the start of a measure, such as 2 in "2 slices" or
+// 0.5 in "1/2 cup"
+func leadingAmount(measure string) float64 {
+	number := strings.TrimSpace(leadingAmountPattern.FindString(measure))
+	if numerator, denominator, ok := strings.Cut(number, "/"); ok {
+		n, err1 := strconv.ParseFloat(numerator, 64)
+		d, err2 := strconv.ParseFloat(denominator, 64)
+		if err1 != nil || err2 != nil || d == 0 {
+			return 0
+		}
+		return n / d
+	}
+	return parseAmount(number)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
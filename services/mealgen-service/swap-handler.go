@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/models"
+	"github.com/MacroPath/macro-path-backend/services/mealgen-service/services"
+)
+
+const (
+	defaultSwapLimit = 5
+	maxSwapLimit     = 20
+)
+
+// swapHandler suggests substitutes for one resolved food without asking the LLM. The
+// candidates come from the food cache and a fixed list per food class, and each one is
+// scaled to the macros of the food it replaces.
+func swapHandler(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var reqBody models.SwapRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.Food.FoodName == "" || len(reqBody.Food.Servings) == 0 {
+		http.Error(w, "Invalid request: food needs a name and a selected serving", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	result := swapFood(ctx, reqBody)
+	log.Printf("🔁 Swap for %s: %d %s substitutes", result.Original, len(result.Substitutes), result.Category)
+
+	response := models.SwapResponse{Success: true, Data: result}
+	if len(result.Substitutes) == 0 {
+		response.Message = fmt.Sprintf("No compliant %s substitutes found", result.Category)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// swapFood ranks same-class substitutes for the requested food and scales the best to
+// its macros
+func swapFood(ctx context.Context, reqBody models.SwapRequest) models.SwapResult {
+	original := reqBody.Food
+	class := foodClasses.Classify(original)
+	target := calculateMealMacros([]models.Food{original})
+
+	health := healthRules.ProfileFor(reqBody.HealthConditions, reqBody.LifePhases)
+	profile := services.NewComplianceProfile(reqBody.DietType, reqBody.FoodsToAvoid)
+	profile.UseClassifier(foodClasses)
+	health.AddExclusionsTo(profile)
+
+	exclude := make(map[string]bool, len(reqBody.Exclude))
+	for _, name := range reqBody.Exclude {
+		exclude[services.NormalizeFoodName(name)] = true
+	}
+
+	limit := reqBody.Limit
+	if limit <= 0 {
+		limit = defaultSwapLimit
+	}
+	limit = min(limit, maxSwapLimit)
+
+	ranked := foodClasses.RankSwaps(original, swapCandidateFoods(ctx, class.Class), profile, exclude)
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	result := models.SwapResult{
+		Original:    original.FoodName,
+		Category:    class.Class,
+		Macros:      target,
+		Substitutes: make([]models.FoodSwap, 0, len(ranked)),
+	}
+	for _, swap := range ranked {
+		food := swap.Food
+		food.Servings = gramServings(food)
+		if len(food.Servings) == 0 {
+			continue
+		}
+		food.Servings[0] = ensureServingFields(food.Servings[0], food.Servings)
+
+		// Solve the gram amount against the original's macros, then round it like a meal
+		scaled, _ := solvePortions([]models.Food{food}, target)
+		scaled, residual := roundPortions(scaled, target)
+
+		result.Substitutes = append(result.Substitutes, models.FoodSwap{
+			Food:     scaled[0],
+			Distance: math.Round(swap.Distance*1000) / 1000,
+			Macros:   calculateMealMacros(scaled),
+			Residual: residual,
+		})
+	}
+	return result
+}
+
+// swapCandidateFoods gathers resolved foods to rank: everything in the food cache, plus
+// the class's candidate list, which is served from the cache when already looked up
+func swapCandidateFoods(ctx context.Context, class string) []models.Food {
+	cached := foodCache.CachedFoods()
+
+	toFetch := make(map[string]bool)
+	for _, name := range services.SwapCandidateNames(class) {
+		if cached[services.NormalizeFoodName(name)] == nil {
+			toFetch[name] = true
+		}
+	}
+	fetched, _ := batchFetchFoods(ctx, toFetch)
+
+	candidates := make([]models.Food, 0, len(cached)+len(fetched))
+	for _, foods := range []map[string]*models.Food{cached, fetched} {
+		for _, food := range foods {
+			if food != nil {
+				candidates = append(candidates, *food)
+			}
+		}
+	}
+	return candidates
+}